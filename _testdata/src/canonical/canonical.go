@@ -0,0 +1,9 @@
+package canonical // import "canonical"
+
+import (
+	"sort"
+)
+
+var (
+	_ = sort.Strings
+)
@@ -0,0 +1,9 @@
+package sub /* import "canonical/sub" */
+
+import (
+	"sort"
+)
+
+var (
+	_ = sort.Strings
+)
@@ -0,0 +1,7 @@
+package sub_test // import "something/else"
+
+import (
+	"testing"
+)
+
+func TestSub(t *testing.T) {}
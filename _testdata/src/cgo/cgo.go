@@ -0,0 +1,8 @@
+package cgo
+
+// #include "helper.h"
+import "C"
+
+import "sort"
+
+var _ = sort.Strings
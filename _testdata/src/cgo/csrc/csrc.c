@@ -0,0 +1,3 @@
+#include "csrc.h"
+
+int csrc(void) { return 1; }
@@ -0,0 +1 @@
+int csrc(void);
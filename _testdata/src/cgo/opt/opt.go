@@ -0,0 +1,5 @@
+package opt
+
+import "sort"
+
+var _ = sort.Strings
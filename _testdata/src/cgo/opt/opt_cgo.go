@@ -0,0 +1,5 @@
+// +build cgo
+
+package opt
+
+import "C"
@@ -0,0 +1,3 @@
+// +build cgo
+
+package tagged
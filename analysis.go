@@ -2,16 +2,18 @@ package gps
 
 import (
 	"fmt"
+	"go/ast"
 	"go/build"
 	"go/parser"
 	gscan "go/scanner"
 	"go/token"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"sync"
 )
 
 var (
@@ -67,7 +69,24 @@ func doIsStdLib(path string) bool {
 // A PackageTree is returned, which contains the ImportRoot and map of import path
 // to PackageOrErr - each path under the root that exists will have either a
 // Package, or an error describing why the directory is not a valid package.
+//
+// Directories are parsed concurrently, by up to one worker per CPU.
 func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
+	return listPackages(fileRoot, importRoot, false, runtime.NumCPU())
+}
+
+// ListPackagesWithFiles behaves identically to ListPackages, except that it
+// also records per-file information in the Files field of each Package: each
+// file's imports, build constraints, and whether it is a test file.
+//
+// This is useful for answering questions like "which file pulls in this
+// dependency?" It also allows the errors returned from ToReachMap to identify
+// the specific files making problematic imports.
+func ListPackagesWithFiles(fileRoot, importRoot string) (PackageTree, error) {
+	return listPackages(fileRoot, importRoot, true, runtime.NumCPU())
+}
+
+func listPackages(fileRoot, importRoot string, withFiles bool, workers int) (PackageTree, error) {
 	ptree := PackageTree{
 		ImportRoot: importRoot,
 		Packages:   make(map[string]PackageOrErr),
@@ -79,6 +98,9 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		return PackageTree{}, err
 	}
 
+	// First, find all the directories to be analyzed. Walking is cheap in
+	// comparison to parsing, so this is done serially.
+	var dirs []string
 	err = filepath.Walk(fileRoot, func(wp string, fi os.FileInfo, err error) error {
 		if err != nil && err != filepath.SkipDir {
 			return err
@@ -112,184 +134,403 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		// would have an err with the same path as is called this time, as only
 		// then will filepath.Walk have attempted to descend into the directory
 		// and encountered an error.
-		_, err = os.Open(wp)
+		f, err := os.Open(wp)
 		if err != nil {
 			if os.IsPermission(err) {
 				return filepath.SkipDir
 			}
 			return err
 		}
+		f.Close()
 
-		// Compute the import path. Run the result through ToSlash(), so that
-		// windows file paths are normalized to slashes, as is expected of
-		// import paths.
-		ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
+		dirs = append(dirs, wp)
+		return nil
+	})
 
-		// Find all the imports, across all os/arch combos
-		//p, err := fullPackageInDir(wp)
-		p := &build.Package{
-			Dir: wp,
-		}
-		err = fillPackage(p)
+	if err != nil {
+		return PackageTree{}, err
+	}
 
-		var pkg Package
-		if err == nil {
-			pkg = Package{
-				ImportPath:  ip,
-				CommentPath: p.ImportComment,
-				Name:        p.Name,
-				Imports:     p.Imports,
-				TestImports: dedupeStrings(p.TestImports, p.XTestImports),
+	// Then, parse the contents of each directory with a bounded pool of
+	// workers. Results are slotted in by index, so that if errors occur, the
+	// one reported is the same as it would be were the work done serially.
+	type result struct {
+		ip  string
+		poe PackageOrErr
+		err error
+	}
+	results := make([]result, len(dirs))
+
+	if workers > len(dirs) {
+		workers = len(dirs)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for k := range work {
+				r := &results[k]
+				r.ip, r.poe, r.err = listPackage(dirs[k], fileRoot, importRoot, withFiles)
 			}
-		} else {
-			switch err.(type) {
-			case gscan.ErrorList, *gscan.Error, *build.NoGoError:
-				// This happens if we encounter malformed or nonexistent Go
-				// source code
-				ptree.Packages[ip] = PackageOrErr{
-					Err: err,
+		}()
+	}
+
+	for k := range dirs {
+		work <- k
+	}
+	close(work)
+	wg.Wait()
+
+	for _, r := range results {
+		if r.err != nil {
+			return PackageTree{}, r.err
+		}
+		ptree.Packages[r.ip] = r.poe
+	}
+
+	return ptree, nil
+}
+
+// listPackage analyzes the single directory at wp, returning its import path
+// and the resulting PackageOrErr. An error is returned only if something
+// other than malformed or missing Go code prevented analysis.
+func listPackage(wp, fileRoot, importRoot string, withFiles bool) (string, PackageOrErr, error) {
+	// Compute the import path. Run the result through ToSlash(), so that
+	// windows file paths are normalized to slashes, as is expected of
+	// import paths.
+	ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
+
+	// Find all the imports, across all os/arch combos
+	//p, err := fullPackageInDir(wp)
+	p := &build.Package{
+		Dir: wp,
+	}
+	files, others, err := fillPackage(p)
+
+	var pkg Package
+	if err == nil {
+		pkg = Package{
+			ImportPath:            ip,
+			CommentPath:           p.ImportComment,
+			Name:                  p.Name,
+			Imports:               p.Imports,
+			TestImports:           dedupeStrings(p.TestImports, p.XTestImports),
+			ImportConstraints:     importConstraints(files, false),
+			TestImportConstraints: importConstraints(files, true),
+			Cgo:                   len(p.CgoFiles) > 0,
+			RequiresCgo:           requiresCgo(files),
+			OtherFiles:            others,
+		}
+		if withFiles {
+			pkg.Files = sourceFiles(files)
+		}
+	} else {
+		switch err.(type) {
+		case *build.NoGoError:
+			// A directory with no Go code can't be imported, but any
+			// non-Go sources in it are still recorded.
+			poe := PackageOrErr{Err: err}
+			if len(others) > 0 {
+				poe.P = Package{
+					ImportPath: ip,
+					OtherFiles: others,
 				}
-				return nil
-			default:
-				return err
 			}
+			return ip, poe, nil
+		case gscan.ErrorList, *gscan.Error:
+			// This happens if we encounter malformed Go source code
+			return ip, PackageOrErr{Err: err}, nil
+		default:
+			return "", PackageOrErr{}, err
 		}
+	}
 
-		// This area has some...fuzzy rules, but check all the imports for
-		// local/relative/dot-ness, and record an error for the package if we
-		// see any.
-		var lim []string
-		for _, imp := range append(pkg.Imports, pkg.TestImports...) {
-			switch {
-			// Do allow the single-dot, at least for now
-			case imp == "..":
-				lim = append(lim, imp)
-			case strings.HasPrefix(imp, "./"):
-				lim = append(lim, imp)
-			case strings.HasPrefix(imp, "../"):
-				lim = append(lim, imp)
-			}
+	// This area has some...fuzzy rules, but check all the imports for
+	// local/relative/dot-ness, and record an error for the package if we
+	// see any.
+	var lim []string
+	for _, imp := range append(pkg.Imports, pkg.TestImports...) {
+		if isLocalImport(imp) {
+			lim = append(lim, imp)
 		}
+	}
 
-		if len(lim) > 0 {
-			ptree.Packages[ip] = PackageOrErr{
-				Err: &LocalImportsError{
-					Dir:          wp,
-					ImportPath:   ip,
-					LocalImports: lim,
-				},
-			}
-		} else {
-			ptree.Packages[ip] = PackageOrErr{
-				P: pkg,
+	if len(lim) == 0 {
+		return ip, PackageOrErr{P: pkg}, nil
+	}
+
+	var lfiles []string
+	for _, f := range files {
+		for _, imp := range f.imports {
+			if isLocalImport(imp) {
+				lfiles = append(lfiles, f.name)
+				break
 			}
 		}
+	}
 
-		return nil
-	})
+	return ip, PackageOrErr{
+		Err: &LocalImportsError{
+			Dir:          wp,
+			ImportPath:   ip,
+			LocalImports: lim,
+			Files:        lfiles,
+		},
+	}, nil
+}
 
-	if err != nil {
-		return PackageTree{}, err
+// isLocalImport reports whether the import path is a relative one.
+func isLocalImport(imp string) bool {
+	// Do allow the single-dot, at least for now
+	return imp == ".." || strings.HasPrefix(imp, "./") || strings.HasPrefix(imp, "../")
+}
+
+// goFile holds the information gathered from a single Go source file by
+// fillPackage.
+type goFile struct {
+	name        string
+	test, xtest bool
+	// Whether the file imports "C"
+	cgo bool
+	// Whether the file is excluded from all builds by the "ignore" tag
+	ignored    bool
+	imports    []string
+	constraint BuildConstraint
+}
+
+// requiresCgo reports whether none of the non-test files gathered from a
+// package could be built with cgo disabled - that is, whether all of them
+// either import "C" or are constrained to builds with the "cgo" tag set.
+func requiresCgo(files []goFile) bool {
+	var any bool
+	for _, f := range files {
+		if f.test || f.ignored {
+			continue
+		}
+		if !f.cgo && !f.constraint.requiresTag("cgo") {
+			return false
+		}
+		any = true
 	}
+	return any
+}
 
-	return ptree, nil
+// sourceFiles converts the gathered goFiles into their exported form.
+func sourceFiles(files []goFile) []SourceFile {
+	sfs := make([]SourceFile, len(files))
+	for k, f := range files {
+		imps := make([]string, len(f.imports))
+		copy(imps, f.imports)
+		sfs[k] = SourceFile{
+			Name:       f.name,
+			Imports:    uniq(imps),
+			Constraint: f.constraint,
+			Test:       f.test,
+			XTest:      f.xtest,
+			Cgo:        f.cgo,
+		}
+	}
+	return sfs
 }
 
-// fillPackage full of info. Assumes p.Dir is set at a minimum
-func fillPackage(p *build.Package) error {
+// fillPackage full of info. Assumes p.Dir is set at a minimum.
+//
+// Imports are collected across all os/arch combos and build tags; the returned
+// per-file information records the build constraints under which each file,
+// and thus each of its imports, applies. The pseudo-import "C" is not recorded
+// as an import; files that make it are instead listed in p.CgoFiles (or
+// p.TestGoFiles, for tests), and marked in their per-file information.
+//
+// The names of any non-Go source files the go tool might use in a build (C,
+// assembly, etc.) are also returned. They're returned even for a directory
+// with no Go files, alongside the *build.NoGoError.
+func fillPackage(p *build.Package) ([]goFile, []string, error) {
 	var buildPrefix = "// +build "
-	var buildFieldSplit = func(r rune) bool {
-		return unicode.IsSpace(r) || r == ','
-	}
 
-	gofiles, err := filepath.Glob(filepath.Join(p.Dir, "*.go"))
+	entries, err := filepath.Glob(filepath.Join(p.Dir, "*"))
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	var gofiles, others []string
+	for _, e := range entries {
+		switch ext := filepath.Ext(e); {
+		case ext == ".go":
+			gofiles = append(gofiles, e)
+		case buildFileExts[ext]:
+			others = append(others, filepath.Base(e))
+		}
 	}
 
 	if len(gofiles) == 0 {
-		return &build.NoGoError{Dir: p.Dir}
+		return nil, others, &build.NoGoError{Dir: p.Dir}
 	}
 
+	var files []goFile
 	var testImports []string
 	var imports []string
 	for _, file := range gofiles {
-		pf, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly|parser.ParseComments)
+		fset := token.NewFileSet()
+		pf, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly|parser.ParseComments)
 		if err != nil {
 			if os.IsPermission(err) {
 				continue
 			}
-			return err
+			return nil, nil, err
 		}
 		testFile := strings.HasSuffix(file, "_test.go")
 		fname := filepath.Base(file)
 
-		var ignored bool
+		var blines []string
 		for _, c := range pf.Comments {
 			if c.Pos() > pf.Package { // +build comment must come before package
 				continue
 			}
 
-			var ct string
 			for _, cl := range c.List {
 				if strings.HasPrefix(cl.Text, buildPrefix) {
-					ct = cl.Text
-					break
+					blines = append(blines, cl.Text[len(buildPrefix):])
 				}
 			}
-			if ct == "" {
-				continue
-			}
+		}
 
-			for _, t := range strings.FieldsFunc(ct[len(buildPrefix):], buildFieldSplit) {
-				// hardcoded (for now) handling for the "ignore" build tag
-				// We "soft" ignore the files tagged with ignore so that we pull in their imports.
+		gf := goFile{
+			name:       fname,
+			test:       testFile,
+			xtest:      testFile && strings.HasSuffix(pf.Name.Name, "_test"),
+			constraint: parseBuildConstraint(fname, blines),
+		}
+
+		// hardcoded (for now) handling for the "ignore" build tag
+		// We "soft" ignore the files tagged with ignore so that we pull in their imports.
+		for _, terms := range gf.constraint {
+			for _, t := range terms {
 				if t == "ignore" {
-					ignored = true
+					gf.ignored = true
 				}
 			}
 		}
+		ignored := gf.ignored
 
-		if testFile {
-			p.TestGoFiles = append(p.TestGoFiles, fname)
-			if p.Name == "" && !ignored {
-				p.Name = strings.TrimSuffix(pf.Name.Name, "_test")
-			}
-		} else {
-			if p.Name == "" && !ignored {
-				p.Name = pf.Name.Name
-			}
-			p.GoFiles = append(p.GoFiles, fname)
+		// As with go/build, the import comment is taken from any file that
+		// isn't an external test.
+		if p.ImportComment == "" && !ignored && !strings.HasSuffix(pf.Name.Name, "_test") {
+			p.ImportComment = findImportComment(fset, pf)
 		}
 
 		for _, is := range pf.Imports {
 			name, err := strconv.Unquote(is.Path.Value)
 			if err != nil {
-				return err // can't happen?
+				return nil, nil, err // can't happen?
 			}
+			if name == "C" {
+				gf.cgo = true
+				continue
+			}
+			gf.imports = append(gf.imports, name)
 			if testFile {
 				testImports = append(testImports, name)
 			} else {
 				imports = append(imports, name)
 			}
 		}
+
+		if testFile {
+			p.TestGoFiles = append(p.TestGoFiles, fname)
+			if p.Name == "" && !ignored {
+				p.Name = strings.TrimSuffix(pf.Name.Name, "_test")
+			}
+		} else {
+			if p.Name == "" && !ignored {
+				p.Name = pf.Name.Name
+			}
+			if gf.cgo {
+				p.CgoFiles = append(p.CgoFiles, fname)
+			} else {
+				p.GoFiles = append(p.GoFiles, fname)
+			}
+		}
+		files = append(files, gf)
 	}
 
 	imports = uniq(imports)
 	testImports = uniq(testImports)
 	p.Imports = imports
 	p.TestImports = testImports
-	return nil
+	return files, others, nil
+}
+
+// findImportComment returns the path given in an import comment (e.g.,
+// `package foo // import "github.com/foo/bar"`) on the parsed file's package
+// clause, or the empty string if there is none.
+func findImportComment(fset *token.FileSet, pf *ast.File) string {
+	line := fset.Position(pf.Package).Line
+	for _, c := range pf.Comments {
+		if c.Pos() < pf.Name.End() {
+			continue
+		}
+		if fset.Position(c.Pos()).Line != line {
+			break
+		}
+
+		text := c.List[0].Text
+		if strings.HasPrefix(text, "//") {
+			text = text[2:]
+		} else {
+			text = strings.TrimSuffix(text[2:], "*/")
+		}
+
+		text = strings.TrimSpace(text)
+		if !strings.HasPrefix(text, "import ") {
+			continue
+		}
+		path, err := strconv.Unquote(strings.TrimSpace(text[len("import "):]))
+		if err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// CgoRequiredError indicates that a package can't be built because it requires
+// cgo, but cgo is disabled.
+type CgoRequiredError struct {
+	ImportPath string
+}
+
+func (e *CgoRequiredError) Error() string {
+	return fmt.Sprintf("package %s requires cgo, but cgo is disabled", e.ImportPath)
+}
+
+// withoutCgo returns a copy of the PackageTree in which every package that
+// requires cgo (see Package.RequiresCgo) is replaced with a
+// *CgoRequiredError, as is appropriate when building with CGO_ENABLED=0.
+func (t PackageTree) withoutCgo() PackageTree {
+	t2 := t.dup()
+	for ip, poe := range t2.Packages {
+		if poe.Err == nil && poe.P.RequiresCgo {
+			t2.Packages[ip] = PackageOrErr{
+				Err: &CgoRequiredError{ImportPath: ip},
+			}
+		}
+	}
+	return t2
 }
 
 // LocalImportsError indicates that a package contains at least one relative
 // import that will prevent it from compiling.
-//
-// TODO(sdboyer) add a Files property once we're doing our own per-file parsing
 type LocalImportsError struct {
 	ImportPath   string
 	Dir          string
 	LocalImports []string
+	// Files lists the names of the files, within Dir, that make local imports.
+	Files []string
 }
 
 func (e *LocalImportsError) Error() string {
@@ -298,10 +539,57 @@ func (e *LocalImportsError) Error() string {
 		// shouldn't be possible, but just cover the case
 		return fmt.Sprintf("import path %s had bad local imports", e.ImportPath)
 	case 1:
-		return fmt.Sprintf("import path %s had a local import: %q", e.ImportPath, e.LocalImports[0])
+		return fmt.Sprintf("import path %s had a local import: %q%s", e.ImportPath, e.LocalImports[0], e.inFiles())
 	default:
-		return fmt.Sprintf("import path %s had local imports: %q", e.ImportPath, strings.Join(e.LocalImports, "\", \""))
+		return fmt.Sprintf("import path %s had local imports: %q%s", e.ImportPath, strings.Join(e.LocalImports, "\", \""), e.inFiles())
+	}
+}
+
+func (e *LocalImportsError) inFiles() string {
+	if len(e.Files) == 0 {
+		return ""
 	}
+	return fmt.Sprintf(" (in %s)", strings.Join(e.Files, ", "))
+}
+
+// ImportCommentError indicates that a package's import comment declares a
+// canonical import path other than the one under which it is being imported.
+type ImportCommentError struct {
+	// ImportPath is the path under which the package is being imported.
+	ImportPath string
+	// CommentPath is the path declared by the package's import comment.
+	CommentPath string
+}
+
+func (e *ImportCommentError) Error() string {
+	return fmt.Sprintf("package %s is imported under a non-canonical path; its import comment requires %q", e.ImportPath, e.CommentPath)
+}
+
+type importCommentErrs []*ImportCommentError
+
+func (s importCommentErrs) Len() int           { return len(s) }
+func (s importCommentErrs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s importCommentErrs) Less(i, j int) bool { return s[i].ImportPath < s[j].ImportPath }
+
+// importCommentErrors returns an ImportCommentError for each of the named
+// packages that has an import comment disagreeing with its import path.
+// Packages that are not present in the tree, or have errors, are skipped.
+func (t PackageTree) importCommentErrors(pkgs []string) []*ImportCommentError {
+	var errs []*ImportCommentError
+	for _, pkg := range pkgs {
+		poe, has := t.Packages[pkg]
+		if !has || poe.Err != nil {
+			continue
+		}
+
+		if poe.P.CommentPath != "" && poe.P.CommentPath != pkg {
+			errs = append(errs, &ImportCommentError{
+				ImportPath:  pkg,
+				CommentPath: poe.P.CommentPath,
+			})
+		}
+	}
+	return errs
 }
 
 // A PackageTree represents the results of recursively parsing a tree of
@@ -336,6 +624,26 @@ func (t PackageTree) dup() PackageTree {
 			poe2.P.TestImports = make([]string, len(poe.P.TestImports))
 			copy(poe2.P.TestImports, poe.P.TestImports)
 		}
+		if poe.P.ImportConstraints != nil {
+			poe2.P.ImportConstraints = make(map[string]BuildConstraint, len(poe.P.ImportConstraints))
+			for imp, c := range poe.P.ImportConstraints {
+				poe2.P.ImportConstraints[imp] = c
+			}
+		}
+		if poe.P.Files != nil {
+			poe2.P.Files = make([]SourceFile, len(poe.P.Files))
+			copy(poe2.P.Files, poe.P.Files)
+		}
+		if len(poe.P.OtherFiles) > 0 {
+			poe2.P.OtherFiles = make([]string, len(poe.P.OtherFiles))
+			copy(poe2.P.OtherFiles, poe.P.OtherFiles)
+		}
+		if poe.P.TestImportConstraints != nil {
+			poe2.P.TestImportConstraints = make(map[string]BuildConstraint, len(poe.P.TestImportConstraints))
+			for imp, c := range poe.P.TestImportConstraints {
+				poe2.P.TestImportConstraints[imp] = c
+			}
+		}
 
 		t2.Packages[path] = poe2
 	}
@@ -347,10 +655,29 @@ type wm struct {
 	err error
 	ex  map[string]bool
 	in  map[string]bool
+	// files maps each import to the files making it, if known
+	files map[string][]string
+}
+
+// filesFor returns the files within the wm's package that make the import
+// responsible for the provided error.
+func (w wm) filesFor(e *ProblemImportError) []string {
+	if len(e.Cause) > 0 {
+		return w.files[e.Cause[0]]
+	}
+	if ierr, is := e.Err.(*InternalImportError); is {
+		return w.files[ierr.Internal]
+	}
+	return nil
 }
 
 // PackageOrErr stores the results of attempting to parse a single directory for
 // Go source code.
+//
+// If Err is set, the package can't be imported, and P is generally empty. The
+// exception is a directory with only non-Go source files, which has a
+// *build.NoGoError as its Err, and a P with only its ImportPath and OtherFiles
+// set.
 type PackageOrErr struct {
 	P   Package
 	Err error
@@ -378,19 +705,87 @@ type ProblemImportError struct {
 	// The actual error from ListPackages that is undermining importability for
 	// this package.
 	Err error
+	// The files within the package at ImportPath that make the problematic
+	// import - that of the first package in Cause or, if the package itself
+	// has a disallowed import, of the internal package. This is only
+	// populated if the PackageTree was created by ListPackagesWithFiles.
+	Files []string
 }
 
 // Error formats the ProblemImportError as a string, reflecting whether the
 // error represents a direct or transitive problem.
 func (e *ProblemImportError) Error() string {
+	problem := "contains malformed code"
+	switch e.Err.(type) {
+	case *InternalImportError:
+		problem = "has a disallowed import"
+	case *CgoRequiredError:
+		problem = "is unusable"
+	}
+
+	var in string
+	if len(e.Files) > 0 {
+		in = fmt.Sprintf(" (in %s)", strings.Join(e.Files, ", "))
+	}
+
 	switch len(e.Cause) {
 	case 0:
-		return fmt.Sprintf("%q contains malformed code: %s", e.ImportPath, e.Err.Error())
+		return fmt.Sprintf("%q %s%s: %s", e.ImportPath, problem, in, e.Err.Error())
 	case 1:
-		return fmt.Sprintf("%q imports %q, which contains malformed code: %s", e.ImportPath, e.Cause[0], e.Err.Error())
+		return fmt.Sprintf("%q imports %q%s, which %s: %s", e.ImportPath, e.Cause[0], in, problem, e.Err.Error())
 	default:
-		return fmt.Sprintf("%q transitively (through %v packages) imports %q, which contains malformed code: %s", e.ImportPath, len(e.Cause)-1, e.Cause[len(e.Cause)-1], e.Err.Error())
+		return fmt.Sprintf("%q transitively (through %v packages) imports %q, which %s: %s", e.ImportPath, len(e.Cause)-1, e.Cause[len(e.Cause)-1], problem, e.Err.Error())
+	}
+}
+
+// InternalImportError indicates that a package imports an internal package
+// that Go's visibility rules do not permit it to import. A package whose path
+// contains an "internal" element may only be imported by packages rooted at
+// the parent of that element; "a/b/internal/c" may be imported by "a/b" and
+// "a/b/d", but not by "a/e".
+//
+// It appears as the Err in the ProblemImportError returned from ToReachMap
+// for the importing package.
+type InternalImportError struct {
+	// ImportPath is the path of the package making the disallowed import.
+	ImportPath string
+	// Internal is the path of the internal package being imported.
+	Internal string
+}
+
+func (e *InternalImportError) Error() string {
+	parent, _ := internalParent(e.Internal)
+	if parent == "" {
+		return fmt.Sprintf("%q may not import %q, as it is internal to the standard library", e.ImportPath, e.Internal)
+	}
+	return fmt.Sprintf("%q may not import %q, as it is only visible within %q", e.ImportPath, e.Internal, parent)
+}
+
+// internalParent returns the path of the parent of the last "internal"
+// element in the provided import path, following the same rules as the go
+// tool. The bool indicates whether there was an "internal" element at all.
+func internalParent(path string) (string, bool) {
+	switch {
+	case strings.HasSuffix(path, "/internal"):
+		return path[:len(path)-len("/internal")], true
+	case strings.Contains(path, "/internal/"):
+		return path[:strings.LastIndex(path, "/internal/")], true
+	case path == "internal", strings.HasPrefix(path, "internal/"):
+		return "", true
+	}
+	return "", false
+}
+
+// internalImportAllowed reports whether Go's internal package visibility rules
+// permit the package at importer to import the package at path.
+func internalImportAllowed(importer, path string) bool {
+	parent, has := internalParent(path)
+	if !has {
+		return true
 	}
+	// Only the standard library may import its own internal packages, and
+	// nothing we analyze is the standard library.
+	return parent != "" && eqOrSlashedPrefix(importer, parent)
 }
 
 // ToReachMap looks through a PackageTree and computes the list of external
@@ -442,7 +837,9 @@ func (e *ProblemImportError) Error() string {
 // 	"A/bar": []string{"B/baz"},
 //  }
 //
-// If there are no packages to ignore, it is safe to pass a nil map.
+// If there are no packages to ignore, it is safe to pass a nil map. Keys in the
+// map may also be package patterns, such as "A/..." or "*/testutil", in which
+// case every matching import path is ignored.
 //
 // Finally, if an internal PackageOrErr contains an error, it is always omitted
 // from the result set. If backprop is true, then the error from that internal
@@ -466,10 +863,13 @@ func (e *ProblemImportError) Error() string {
 // 	"A": []string{},
 // 	"A/bar": []string{"B/baz"},
 //  }
+//
+// A package that imports an internal package it is not permitted to see (per
+// Go's internal package rules) is treated exactly as though it contained an
+// error; its entry in the returned error map will have an *InternalImportError
+// as its Err.
 func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bool) (ReachMap, map[string]*ProblemImportError) {
-	if ignore == nil {
-		ignore = make(map[string]bool)
-	}
+	igm := newPkgMatcher(ignore)
 
 	// world's simplest adjacency list
 	workmap := make(map[string]wm)
@@ -489,7 +889,7 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bo
 			continue
 		}
 		// Skip ignored packages
-		if ignore[ip] {
+		if igm.match(ip) {
 			continue
 		}
 
@@ -505,13 +905,34 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore map[string]bo
 			in: make(map[string]bool),
 		}
 
+		if p.Files != nil {
+			w.files = make(map[string][]string)
+			for _, f := range p.Files {
+				if f.Test && !tests {
+					continue
+				}
+				for _, imp := range f.Imports {
+					w.files[imp] = append(w.files[imp], f.Name)
+				}
+			}
+		}
+
 		// For each import, decide whether it should be ignored, or if it
 		// belongs in the external or internal imports list.
 		for _, imp := range imps {
-			if ignore[imp] {
+			if igm.match(imp) {
 				continue
 			}
 
+			// An import of an internal package the importer can't see
+			// renders the importer unusable, just as malformed code would.
+			if w.err == nil && !internalImportAllowed(ip, imp) {
+				w.err = &InternalImportError{
+					ImportPath: ip,
+					Internal:   imp,
+				}
+			}
+
 			if !eqOrSlashedPrefix(imp, t.ImportRoot) {
 				w.ex[imp] = true
 			} else {
@@ -579,6 +1000,7 @@ func wmToReach(workmap map[string]wm, backprop bool) (ReachMap, map[string]*Prob
 				// reuse the slice
 				kerr.Cause = err.Cause[k+1:]
 			}
+			kerr.Files = workmap[ppkg].filesFor(kerr)
 
 			// Both black and white cases can have the final element be a
 			// package that doesn't exist. If that's the case, don't write it
@@ -669,10 +1091,12 @@ func wmToReach(workmap map[string]wm, backprop bool) (ReachMap, map[string]*Prob
 				} else if exists {
 					// Only record something in the errmap if there's actually a
 					// package there, per the semantics of the errmap
-					errmap[pkg] = &ProblemImportError{
+					perr := &ProblemImportError{
 						ImportPath: pkg,
 						Err:        w.err,
 					}
+					perr.Files = w.filesFor(perr)
+					errmap[pkg] = perr
 				}
 
 				// we know we're done here, so mark it black
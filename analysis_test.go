@@ -508,6 +508,86 @@ func TestListPackages(t *testing.T) {
 				},
 			},
 		},
+		"import comments": {
+			fileRoot:   j("canonical"),
+			importRoot: "canonical",
+			out: PackageTree{
+				ImportRoot: "canonical",
+				Packages: map[string]PackageOrErr{
+					"canonical": {
+						P: Package{
+							ImportPath:  "canonical",
+							CommentPath: "canonical",
+							Name:        "canonical",
+							Imports: []string{
+								"sort",
+							},
+						},
+					},
+					"canonical/sub": {
+						P: Package{
+							ImportPath:  "canonical/sub",
+							CommentPath: "canonical/sub",
+							Name:        "sub",
+							Imports: []string{
+								"sort",
+							},
+							TestImports: []string{
+								"testing",
+							},
+						},
+					},
+				},
+			},
+		},
+		"cgo and non-go sources": {
+			fileRoot:   j("cgo"),
+			importRoot: "cgo",
+			out: PackageTree{
+				ImportRoot: "cgo",
+				Packages: map[string]PackageOrErr{
+					"cgo": {
+						P: Package{
+							ImportPath: "cgo",
+							Name:       "cgo",
+							Imports: []string{
+								"sort",
+							},
+							Cgo:         true,
+							RequiresCgo: true,
+							OtherFiles:  []string{"helper.c", "helper.h"},
+						},
+					},
+					"cgo/csrc": {
+						P: Package{
+							ImportPath: "cgo/csrc",
+							OtherFiles: []string{"csrc.c", "csrc.h"},
+						},
+						Err: &build.NoGoError{
+							Dir: j("cgo/csrc"),
+						},
+					},
+					"cgo/opt": {
+						P: Package{
+							ImportPath: "cgo/opt",
+							Name:       "opt",
+							Imports: []string{
+								"sort",
+							},
+							Cgo: true,
+						},
+					},
+					"cgo/tagged": {
+						P: Package{
+							ImportPath:  "cgo/tagged",
+							Name:        "tagged",
+							Imports:     []string{},
+							RequiresCgo: true,
+						},
+					},
+				},
+			},
+		},
 		"impose import path": {
 			fileRoot:   j("simple"),
 			importRoot: "arbitrary",
@@ -857,6 +937,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							ImportConstraints: map[string]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -878,6 +961,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							ImportConstraints: map[string]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -899,6 +985,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							ImportConstraints: map[string]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 						},
 					},
 				},
@@ -920,6 +1009,9 @@ func TestListPackages(t *testing.T) {
 								"sort",
 								"unicode",
 							},
+							ImportConstraints: map[string]BuildConstraint{
+								"unicode": {{"ignore"}},
+							},
 							TestImports: []string{
 								"math/rand",
 								"strconv",
@@ -1109,6 +1201,7 @@ func TestListPackages(t *testing.T) {
 							LocalImports: []string{
 								"..",
 							},
+							Files: []string{"a.go"},
 						},
 					},
 					"relimport/dotslash": {
@@ -1118,6 +1211,7 @@ func TestListPackages(t *testing.T) {
 							LocalImports: []string{
 								"./simple",
 							},
+							Files: []string{"a.go"},
 						},
 					},
 					"relimport/dotdotslash": {
@@ -1127,6 +1221,7 @@ func TestListPackages(t *testing.T) {
 							LocalImports: []string{
 								"../github.com/sdboyer/gps",
 							},
+							Files: []string{"a.go"},
 						},
 					},
 				},
@@ -1272,7 +1367,7 @@ func TestListPackages(t *testing.T) {
 							for path, perr := range fix.out.Packages {
 								seen[path] = true
 								if operr, exists := out.Packages[path]; !exists {
-									t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%s", path, perr)
+									t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%#v", path, perr)
 								} else {
 									if !reflect.DeepEqual(perr, operr) {
 										t.Errorf("PkgOrErr for path %s was not as expected:\n\t(GOT): %#v\n\t(WNT): %#v", path, operr, perr)
@@ -1285,7 +1380,7 @@ func TestListPackages(t *testing.T) {
 									continue
 								}
 
-								t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%s", path, operr)
+								t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%#v", path, operr)
 							}
 						}
 					}
@@ -1824,6 +1919,32 @@ func TestToReachMap(t *testing.T) {
 		b("namemismatch"),
 	)
 	validate()
+
+	// a subtree pattern takes out varied/simple and everything beneath it
+	name = "ignore varied/simple/..."
+	ignore = map[string]bool{
+		b("simple/..."): true,
+	}
+	except(
+		bl("", "simple", "simple/another")+" hash encoding/binary go/parser",
+		b("simple"),
+		b("simple/another"),
+	)
+	validate()
+
+	// glob patterns apply equally to external imports
+	name = "ignore github.com/*/gps"
+	ignore = map[string]bool{
+		"github.com/*/gps": true,
+	}
+	except(
+		b("")+" github.com/sdboyer/gps",
+		b("m1p")+" github.com/sdboyer/gps",
+		b("otherpath")+" github.com/sdboyer/gps",
+		b("simple")+" github.com/sdboyer/gps",
+		b("simple/another")+" github.com/sdboyer/gps",
+	)
+	validate()
 }
 
 // Verify that we handle import cycles correctly - drop em all
@@ -1848,6 +1969,237 @@ func TestToReachMapCycle(t *testing.T) {
 	}
 }
 
+func TestToReachMapInternal(t *testing.T) {
+	mkpkg := func(path string, imports ...string) PackageOrErr {
+		return PackageOrErr{
+			P: Package{
+				ImportPath: path,
+				Name:       "foo",
+				Imports:    imports,
+			},
+		}
+	}
+
+	ptree := PackageTree{
+		ImportRoot: "A",
+		Packages: map[string]PackageOrErr{
+			"A":              mkpkg("A", "A/internal/x", "A/bar"),
+			"A/internal/x":   mkpkg("A/internal/x", "B/baz"),
+			"A/foo":          mkpkg("A/foo", "A/foo/internal"),
+			"A/foo/internal": mkpkg("A/foo/internal"),
+			"A/bar":          mkpkg("A/bar", "A/foo/internal"),
+			"A/quux":         mkpkg("A/quux", "B/internal/y"),
+			"A/std":          mkpkg("A/std", "internal/race"),
+			"A/qux":          mkpkg("A/qux", "A/quux"),
+		},
+	}
+
+	rm, em := ptree.ToReachMap(true, false, true, nil)
+
+	for _, pkg := range []string{"A/internal/x", "A/foo", "A/foo/internal"} {
+		if _, has := rm[pkg]; !has {
+			t.Errorf("expected %s to be present in reach map, but it was not", pkg)
+		}
+	}
+
+	wantem := map[string]*ProblemImportError{
+		"A/bar": {
+			ImportPath: "A/bar",
+			Err:        &InternalImportError{ImportPath: "A/bar", Internal: "A/foo/internal"},
+		},
+		"A": {
+			ImportPath: "A",
+			Cause:      []string{"A/bar"},
+			Err:        &InternalImportError{ImportPath: "A/bar", Internal: "A/foo/internal"},
+		},
+		"A/quux": {
+			ImportPath: "A/quux",
+			Err:        &InternalImportError{ImportPath: "A/quux", Internal: "B/internal/y"},
+		},
+		"A/qux": {
+			ImportPath: "A/qux",
+			Cause:      []string{"A/quux"},
+			Err:        &InternalImportError{ImportPath: "A/quux", Internal: "B/internal/y"},
+		},
+		"A/std": {
+			ImportPath: "A/std",
+			Err:        &InternalImportError{ImportPath: "A/std", Internal: "internal/race"},
+		},
+	}
+	if !reflect.DeepEqual(em, wantem) {
+		t.Errorf("did not get expected error map:\n\t(GOT): %s\n\t(WNT): %s", em, wantem)
+	}
+
+	for pkg := range wantem {
+		if _, has := rm[pkg]; has {
+			t.Errorf("expected %s to be omitted from reach map", pkg)
+		}
+	}
+}
+
+func TestListPackagesConcurrency(t *testing.T) {
+	root := filepath.Join(getwd(t), "_testdata", "src")
+	serial, err := listPackages(root, "", true, 1)
+	if err != nil {
+		t.Fatalf("serial listPackages failed: %s", err)
+	}
+
+	for _, workers := range []int{2, 8, 64} {
+		ptree, err := listPackages(root, "", true, workers)
+		if err != nil {
+			t.Fatalf("listPackages with %v workers failed: %s", workers, err)
+		}
+		if !reflect.DeepEqual(serial, ptree) {
+			t.Errorf("listPackages with %v workers produced a different PackageTree than with one", workers)
+		}
+	}
+}
+
+func BenchmarkListPackages(b *testing.B) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	root := filepath.Join(cwd, "_testdata", "src")
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%v", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := listPackages(root, "", false, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestListPackagesWithFiles(t *testing.T) {
+	ptree, err := ListPackagesWithFiles(filepath.Join(getwd(t), "_testdata", "src", "canonical"), "canonical")
+	if err != nil {
+		t.Fatalf("ListPackagesWithFiles failed: %s", err)
+	}
+
+	want := map[string][]SourceFile{
+		"canonical": {
+			{
+				Name:    "canonical.go",
+				Imports: []string{"sort"},
+			},
+		},
+		"canonical/sub": {
+			{
+				Name:    "sub.go",
+				Imports: []string{"sort"},
+			},
+			{
+				Name:    "sub_test.go",
+				Imports: []string{"testing"},
+				Test:    true,
+				XTest:   true,
+			},
+		},
+	}
+
+	for ip, files := range want {
+		poe, has := ptree.Packages[ip]
+		if !has || poe.Err != nil {
+			t.Errorf("expected package %s to be present without error", ip)
+			continue
+		}
+		if !reflect.DeepEqual(poe.P.Files, files) {
+			t.Errorf("wrong files for %s:\n\t(GOT): %#v\n\t(WNT): %#v", ip, poe.P.Files, files)
+		}
+	}
+
+	if got := ptree.Packages["canonical/sub"].P.FilesImporting("testing"); !reflect.DeepEqual(got, []string{"sub_test.go"}) {
+		t.Errorf("expected only sub_test.go to import testing, got %v", got)
+	}
+
+	// Plain ListPackages shouldn't record any file information
+	ptree, err = ListPackages(filepath.Join(getwd(t), "_testdata", "src", "canonical"), "canonical")
+	if err != nil {
+		t.Fatalf("ListPackages failed: %s", err)
+	}
+	if files := ptree.Packages["canonical"].P.Files; files != nil {
+		t.Errorf("expected no files from ListPackages, got %#v", files)
+	}
+}
+
+func TestToReachMapFiles(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "A",
+		Packages: map[string]PackageOrErr{
+			"A": {
+				P: Package{
+					ImportPath:  "A",
+					Name:        "A",
+					Imports:     []string{"A/foo", "sort"},
+					TestImports: []string{"A/foo"},
+					Files: []SourceFile{
+						{Name: "a.go", Imports: []string{"sort"}},
+						{Name: "b.go", Imports: []string{"A/foo", "sort"}},
+						{Name: "a_test.go", Imports: []string{"A/foo"}, Test: true},
+					},
+				},
+			},
+			"A/foo": {
+				P: Package{
+					ImportPath: "A/foo",
+					Name:       "foo",
+					Imports:    []string{"A/missing", "B/internal/bar"},
+					Files: []SourceFile{
+						{Name: "foo.go", Imports: []string{"A/missing"}},
+						{Name: "foo_linux.go", Imports: []string{"B/internal/bar"}},
+					},
+				},
+			},
+		},
+	}
+
+	_, em := ptree.ToReachMap(false, false, true, nil)
+	if want := []string{"b.go"}; !reflect.DeepEqual(em["A"].Files, want) {
+		t.Errorf("expected files %v for A, got %v", want, em["A"].Files)
+	}
+	if want := []string{"foo_linux.go"}; !reflect.DeepEqual(em["A/foo"].Files, want) {
+		t.Errorf("expected files %v for A/foo, got %v", want, em["A/foo"].Files)
+	}
+
+	// Test files are only considered when tests are
+	_, em = ptree.ToReachMap(false, true, true, nil)
+	if want := []string{"b.go", "a_test.go"}; !reflect.DeepEqual(em["A"].Files, want) {
+		t.Errorf("expected files %v for A, got %v", want, em["A"].Files)
+	}
+
+	// Without backprop, only the direct problem is recorded
+	_, em = ptree.ToReachMap(false, false, false, nil)
+	if want := []string{"foo_linux.go"}; !reflect.DeepEqual(em["A/foo"].Files, want) {
+		t.Errorf("expected files %v for A/foo, got %v", want, em["A/foo"].Files)
+	}
+}
+
+func TestInternalImportAllowed(t *testing.T) {
+	table := []struct {
+		importer, path string
+		allowed        bool
+	}{
+		{"a/b", "a/b/internal/c", true},
+		{"a/b/d", "a/b/internal/c", true},
+		{"a/b", "a/b/internal", true},
+		{"a/e", "a/b/internal/c", false},
+		{"a/bb", "a/b/internal/c", false},
+		{"a/b/internal/c", "a/b/internal/c/internal/d", true},
+		{"a/b", "a/b/internal/c/internal/d", false},
+		{"a/b", "internal/race", false},
+		{"a/b", "a/internals/c", true},
+	}
+
+	for _, fix := range table {
+		if got := internalImportAllowed(fix.importer, fix.path); got != fix.allowed {
+			t.Errorf("internalImportAllowed(%q, %q) = %v, expected %v", fix.importer, fix.path, got, fix.allowed)
+		}
+	}
+}
+
 func getwd(t *testing.T) string {
 	cwd, err := os.Getwd()
 	if err != nil {
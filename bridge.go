@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync/atomic"
+	"time"
 )
 
 // sourceBridges provide an adapter to SourceManagers that tailor operations
@@ -18,6 +19,8 @@ type sourceBridge interface {
 	matches(id ProjectIdentifier, c Constraint, v Version) bool
 	matchesAny(id ProjectIdentifier, c1, c2 Constraint) bool
 	intersect(id ProjectIdentifier, c1, c2 Constraint) Constraint
+	retractions(id ProjectIdentifier) []retraction
+	versionTime(id ProjectIdentifier, v Version) (time.Time, bool)
 	breakLock()
 }
 
@@ -53,6 +56,16 @@ type bridge struct {
 	// current solve run
 	vlists map[ProjectIdentifier][]Version
 
+	// Map of projects to their retracted versions.
+	retracted map[ProjectIdentifier][]retraction
+
+	// Map of projects to the manifest at their newest version, or nil if it
+	// couldn't be read. Shared by retractions and versionScheme.
+	newest map[ProjectIdentifier]Manifest
+
+	// Map of projects to the commit times of their versions.
+	vtimes map[ProjectIdentifier]map[UnpairedVersion]time.Time
+
 	// Indicates whether lock breaking has already been run
 	lockbroken int32
 }
@@ -61,10 +74,13 @@ type bridge struct {
 // override it with a custom bridge and sm.
 var mkBridge = func(s *solver, sm SourceManager, down bool) sourceBridge {
 	return &bridge{
-		sm:     sm,
-		s:      s,
-		down:   down,
-		vlists: make(map[ProjectIdentifier][]Version),
+		sm:        sm,
+		s:         s,
+		down:      down,
+		vlists:    make(map[ProjectIdentifier][]Version),
+		retracted: make(map[ProjectIdentifier][]retraction),
+		newest:    make(map[ProjectIdentifier]Manifest),
+		vtimes:    make(map[ProjectIdentifier]map[UnpairedVersion]time.Time),
 	}
 }
 
@@ -101,12 +117,36 @@ func (b *bridge) ListVersions(id ProjectIdentifier) ([]Version, error) {
 	} else {
 		SortForUpgrade(vl)
 	}
+	if vs := b.versionScheme(id, vl); vs != nil {
+		sortInScheme(vl, vs, b.down)
+	}
 
 	b.vlists[id] = vl
 	b.s.mtr.pop()
 	return vl, nil
 }
 
+func (b *bridge) VersionTimes(id ProjectIdentifier) (map[UnpairedVersion]time.Time, error) {
+	b.s.mtr.push("b-version-times")
+	vt, err := b.sm.VersionTimes(id)
+	b.s.mtr.pop()
+	return vt, err
+}
+
+func (b *bridge) CommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	b.s.mtr.push("b-commits-between")
+	n, err := b.sm.CommitsBetween(id, from, to)
+	b.s.mtr.pop()
+	return n, err
+}
+
+func (b *bridge) DefaultBranch(id ProjectIdentifier) (PairedVersion, error) {
+	b.s.mtr.push("b-default-branch")
+	pv, err := b.sm.DefaultBranch(id)
+	b.s.mtr.pop()
+	return pv, err
+}
+
 func (b *bridge) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
 	b.s.mtr.push("b-rev-present-in")
 	i, e := b.sm.RevisionPresentIn(id, r)
@@ -139,27 +179,40 @@ func (b *bridge) pairVersion(id ProjectIdentifier, v UnpairedVersion) PairedVers
 	}
 
 	b.s.mtr.push("b-pair-version")
+	p := pairVersionIn(vl, v)
+	b.s.mtr.pop()
+	return p
+}
+
+func (b *bridge) pairRevision(id ProjectIdentifier, r Revision) []Version {
+	vl, err := b.ListVersions(id)
+	if err != nil {
+		return nil
+	}
+
+	b.s.mtr.push("b-pair-rev")
+	p := pairRevisionIn(vl, r)
+	b.s.mtr.pop()
+	return p
+}
+
+// pairVersionIn returns the PairedVersion from the version list that matches
+// the provided UnpairedVersion, or nil if there is none.
+func pairVersionIn(vl []Version, v UnpairedVersion) PairedVersion {
 	// doing it like this is a bit sloppy
 	for _, v2 := range vl {
 		if p, ok := v2.(PairedVersion); ok {
 			if p.Matches(v) {
-				b.s.mtr.pop()
 				return p
 			}
 		}
 	}
-
-	b.s.mtr.pop()
 	return nil
 }
 
-func (b *bridge) pairRevision(id ProjectIdentifier, r Revision) []Version {
-	vl, err := b.ListVersions(id)
-	if err != nil {
-		return nil
-	}
-
-	b.s.mtr.push("b-pair-rev")
+// pairRevisionIn returns the provided Revision, followed by all the versions
+// from the version list that are paired with it.
+func pairRevisionIn(vl []Version, r Revision) []Version {
 	p := []Version{r}
 	// doing it like this is a bit sloppy
 	for _, v2 := range vl {
@@ -169,8 +222,6 @@ func (b *bridge) pairRevision(id ProjectIdentifier, r Revision) []Version {
 			}
 		}
 	}
-
-	b.s.mtr.pop()
 	return p
 }
 
@@ -275,6 +326,147 @@ func (b *bridge) vtu(id ProjectIdentifier, v Version) versionTypeUnion {
 	return nil
 }
 
+// vtuIn creates a versionTypeUnion for the provided version from a project's
+// version list, in the same way as bridge.vtu.
+func vtuIn(vl []Version, v Version) versionTypeUnion {
+	switch tv := v.(type) {
+	case Revision:
+		return versionTypeUnion(pairRevisionIn(vl, tv))
+	case PairedVersion:
+		return versionTypeUnion(pairRevisionIn(vl, tv.Underlying()))
+	case UnpairedVersion:
+		pv := pairVersionIn(vl, tv)
+		if pv == nil {
+			return versionTypeUnion{tv}
+		}
+
+		return versionTypeUnion(pairRevisionIn(vl, pv.Underlying()))
+	}
+
+	return nil
+}
+
+// A retraction records a version of a project that should not be selected,
+// and whether it was denied by the root rather than retracted by the project.
+type retraction struct {
+	v    Version
+	root bool
+}
+
+// retractions returns the retracted versions of the given project: those
+// denied by the root manifest, followed by those declared through the
+// RetractionManifest at the project's newest version.
+func (b *bridge) retractions(id ProjectIdentifier) []retraction {
+	if rl, exists := b.retracted[id]; exists {
+		return rl
+	}
+
+	var rl []retraction
+	for _, v := range b.s.rd.deny[id.ProjectRoot] {
+		rl = append(rl, retraction{v: v, root: true})
+	}
+
+	// Failing to list versions or read the newest manifest isn't fatal here;
+	// it just means the project can't tell us about any retractions.
+	if vl, err := b.ListVersions(id); err == nil {
+		if rm, ok := b.newestManifest(id, vl).(RetractionManifest); ok {
+			for _, v := range rm.RetractedVersions() {
+				rl = append(rl, retraction{v: v})
+			}
+		}
+	}
+
+	if b.retracted == nil {
+		b.retracted = make(map[ProjectIdentifier][]retraction)
+	}
+	b.retracted[id] = rl
+	return rl
+}
+
+// versionScheme returns the VersionScheme followed by the given project's
+// versions: the one declared for it by the root manifest, or else the one
+// declared through the SchemeManifest at the project's newest version. It
+// returns nil if neither declares one.
+//
+// vl is the project's version list.
+func (b *bridge) versionScheme(id ProjectIdentifier, vl []Version) VersionScheme {
+	if vs, has := b.s.rd.schemes[id.ProjectRoot]; has {
+		return vs
+	}
+
+	// As with retractions, a manifest we can't read just means the project
+	// can't tell us about its scheme.
+	if sm, ok := b.newestManifest(id, vl).(SchemeManifest); ok {
+		return sm.VersionScheme()
+	}
+	return nil
+}
+
+// newestManifest returns the manifest at the given project's newest version
+// (the first in SortForUpgrade order) from its version list, vl, or nil if
+// there are no versions or the manifest can't be read. The result is cached,
+// so the manifest is read at most once per project in a solve run.
+func (b *bridge) newestManifest(id ProjectIdentifier, vl []Version) Manifest {
+	if m, exists := b.newest[id]; exists {
+		return m
+	}
+
+	var m Manifest
+	if len(vl) > 0 {
+		// vl may be sorted in this solve's direction, or in a scheme's order,
+		// so copy it before sorting to find the newest version.
+		up := make([]Version, len(vl))
+		copy(up, vl)
+		SortForUpgrade(up)
+
+		var err error
+		if m, _, err = b.GetManifestAndLock(id, up[0]); err != nil {
+			m = nil
+		}
+	}
+
+	if b.newest == nil {
+		b.newest = make(map[ProjectIdentifier]Manifest)
+	}
+	b.newest[id] = m
+	return m
+}
+
+// versionTime returns the time at which the given version of a project was
+// committed, if it is known.
+//
+// Failing to retrieve the project's version times isn't fatal; it just means
+// none of them are known.
+func (b *bridge) versionTime(id ProjectIdentifier, v Version) (time.Time, bool) {
+	vt, exists := b.vtimes[id]
+	if !exists {
+		vt, _ = b.VersionTimes(id)
+		if b.vtimes == nil {
+			b.vtimes = make(map[ProjectIdentifier]map[UnpairedVersion]time.Time)
+		}
+		b.vtimes[id] = vt
+	}
+
+	return lookupVersionTime(vt, v)
+}
+
+// lookupVersionTime returns the time recorded for the version in a map of the
+// kind returned by SourceManager.VersionTimes, if there is one.
+func lookupVersionTime(vt map[UnpairedVersion]time.Time, v Version) (time.Time, bool) {
+	var uv UnpairedVersion
+	switch tv := v.(type) {
+	case PairedVersion:
+		uv = tv.Unpair()
+	case UnpairedVersion:
+		uv = tv
+	default:
+		return time.Time{}, false
+	}
+
+	t, has := vt[uv]
+	return t, has
+}
+
 // listPackages lists all the packages contained within the given project at a
 // particular version.
 //
@@ -288,6 +480,9 @@ func (b *bridge) ListPackages(id ProjectIdentifier, v Version) (PackageTree, err
 	b.s.mtr.push("b-list-pkgs")
 	pt, err := b.sm.ListPackages(id, v)
 	b.s.mtr.pop()
+	if err == nil {
+		pt = b.s.rd.adaptTree(pt)
+	}
 	return pt, err
 }
 
@@ -0,0 +1,316 @@
+package gps
+
+import (
+	"go/build"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Platform identifies a target operating system and architecture, as would be
+// set via GOOS and GOARCH.
+type Platform struct {
+	OS, Arch string
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// A BuildTarget describes the platforms and build tags for which a build is
+// being performed. It is used to evaluate BuildConstraints, so that imports
+// which can only ever apply to other targets may be disregarded.
+type BuildTarget struct {
+	// Platforms is the list of platforms being targeted. An import is
+	// considered to apply if it would apply on any one of them. If empty,
+	// every known platform is targeted.
+	Platforms []Platform
+
+	// Tags is the list of additional build tags that are set - for example,
+	// "cgo", or "appengine". Tags for the current toolchain's compiler and Go
+	// release (e.g. "gc", "go1.7") are always considered to be set.
+	Tags []string
+}
+
+// Matches reports whether the provided BuildConstraint is satisfied for at
+// least one of the BuildTarget's platforms.
+func (bt BuildTarget) Matches(c BuildConstraint) bool {
+	return bt.matches(c, bt.tagSet())
+}
+
+// tagSet returns the set of all tags considered to be set for the target.
+func (bt BuildTarget) tagSet() map[string]bool {
+	tags := make(map[string]bool, len(bt.Tags)+len(build.Default.ReleaseTags)+1)
+	for _, t := range build.Default.ReleaseTags {
+		tags[t] = true
+	}
+	tags[runtime.Compiler] = true
+	for _, t := range bt.Tags {
+		tags[t] = true
+	}
+	return tags
+}
+
+func (bt BuildTarget) matches(c BuildConstraint, tags map[string]bool) bool {
+	if len(c) == 0 {
+		return true
+	}
+
+	if len(bt.Platforms) > 0 {
+		for _, p := range bt.Platforms {
+			if c.eval(p, tags) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, os := range osList {
+		for _, arch := range archList {
+			if c.eval(Platform{OS: os, Arch: arch}, tags) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A BuildConstraint describes the conditions, in terms of GOOS, GOARCH and
+// build tags, under which a file - or an import made by one or more files - is
+// included in a build.
+//
+// It takes the same form as a single "// +build" line: a list of
+// alternatives, any one of which must be satisfied, each of which is a list of
+// terms that must all be satisfied. A term is a tag name, optionally negated
+// with a leading "!". Multiple +build lines and filename suffixes are combined
+// into this single form.
+//
+// A nil or empty BuildConstraint imposes no conditions.
+type BuildConstraint [][]string
+
+// String renders the BuildConstraint in the syntax of a +build line; for
+// example, "linux,amd64 windows".
+func (c BuildConstraint) String() string {
+	opts := make([]string, len(c))
+	for k, terms := range c {
+		opts[k] = strings.Join(terms, ",")
+	}
+	return strings.Join(opts, " ")
+}
+
+func (c BuildConstraint) eval(p Platform, tags map[string]bool) bool {
+	for _, terms := range c {
+		ok := true
+		for _, term := range terms {
+			if strings.HasPrefix(term, "!") {
+				ok = !matchBuildTag(term[1:], p, tags)
+			} else {
+				ok = matchBuildTag(term, p, tags)
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchBuildTag reports whether the named tag is satisfied for the given
+// platform and set of tags.
+func matchBuildTag(name string, p Platform, tags map[string]bool) bool {
+	if name == p.OS || name == p.Arch || tags[name] {
+		return true
+	}
+	// As with go/build, android implies linux
+	return name == "linux" && p.OS == "android"
+}
+
+// parseBuildConstraint combines the constraints expressed by the provided
+// "// +build" lines (with the prefix already removed) and the file name into a
+// single BuildConstraint.
+func parseBuildConstraint(fname string, lines []string) BuildConstraint {
+	// Start with a single, empty alternative, then AND each line in
+	// (distributing across its alternatives) until we're done
+	c := BuildConstraint{nil}
+	for _, line := range lines {
+		opts := strings.FieldsFunc(line, unicode.IsSpace)
+		if len(opts) == 0 {
+			continue
+		}
+
+		c2 := make(BuildConstraint, 0, len(c)*len(opts))
+		for _, terms := range c {
+			for _, opt := range opts {
+				nt := make([]string, len(terms), len(terms)+1)
+				copy(nt, terms)
+				c2 = append(c2, append(nt, strings.Split(opt, ",")...))
+			}
+		}
+		c = c2
+	}
+
+	if suffix := fileNameConstraint(fname); len(suffix) > 0 {
+		for k := range c {
+			c[k] = append(c[k], suffix...)
+		}
+	}
+
+	return c.normalize()
+}
+
+// fileNameConstraint returns the terms implied by _GOOS, _GOARCH or
+// _GOOS_GOARCH suffixes on a file name, following the same rules as go/build.
+func fileNameConstraint(fname string) []string {
+	name := strings.TrimSuffix(fname, ".go")
+	name = strings.TrimSuffix(name, "_test")
+
+	// Everything before the first _ is ignored, so "linux.go" is unconstrained.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return nil
+	}
+
+	l := strings.Split(name[i:], "_")
+	n := len(l)
+	if n >= 2 && isKnown(osList, l[n-2]) && isKnown(archList, l[n-1]) {
+		return []string{l[n-2], l[n-1]}
+	}
+	if n >= 1 && (isKnown(osList, l[n-1]) || isKnown(archList, l[n-1])) {
+		return []string{l[n-1]}
+	}
+	return nil
+}
+
+func isKnown(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize sorts and dedupes the terms in each alternative, then sorts and
+// dedupes the alternatives themselves, so that equivalent constraints have
+// the same representation. A constraint consisting of any empty alternative
+// is always satisfied, and is normalized to nil.
+func (c BuildConstraint) normalize() BuildConstraint {
+	byKey := make(map[string][]string, len(c))
+	keys := make([]string, 0, len(c))
+	for _, terms := range c {
+		if len(terms) == 0 {
+			return nil
+		}
+
+		terms = uniq(terms)
+		key := strings.Join(terms, ",")
+		if _, seen := byKey[key]; !seen {
+			byKey[key] = terms
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	ret := make(BuildConstraint, len(keys))
+	for k, key := range keys {
+		ret[k] = byKey[key]
+	}
+	return ret
+}
+
+// importConstraints computes the conditions under which each of the imports
+// made by the provided files applies. An import made by any unconstrained
+// file applies unconditionally, and so is omitted from the returned map. If
+// there are no conditional imports at all, nil is returned.
+func importConstraints(files []goFile, tests bool) map[string]BuildConstraint {
+	conds := make(map[string]BuildConstraint)
+	always := make(map[string]bool)
+	for _, f := range files {
+		if f.test != tests {
+			continue
+		}
+
+		for _, imp := range f.imports {
+			if len(f.constraint) == 0 {
+				always[imp] = true
+			} else {
+				conds[imp] = append(conds[imp], f.constraint...)
+			}
+		}
+	}
+
+	for imp := range always {
+		delete(conds, imp)
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+
+	for imp, c := range conds {
+		conds[imp] = c.normalize()
+	}
+	return conds
+}
+
+// ForTarget returns a copy of the PackageTree in which each package's Imports
+// and TestImports are restricted to those that apply for the provided
+// BuildTarget, as determined by their ImportConstraints and
+// TestImportConstraints.
+//
+// The resulting PackageTree can be passed to ToReachMap in order to compute
+// reachability for only the targeted platforms and tags.
+func (t PackageTree) ForTarget(bt BuildTarget) PackageTree {
+	t2 := t.dup()
+	tags := bt.tagSet()
+	for ip, poe := range t2.Packages {
+		if poe.Err != nil {
+			continue
+		}
+
+		poe.P.Imports = bt.filterImports(poe.P.Imports, poe.P.ImportConstraints, tags)
+		poe.P.TestImports = bt.filterImports(poe.P.TestImports, poe.P.TestImportConstraints, tags)
+		t2.Packages[ip] = poe
+	}
+
+	return t2
+}
+
+// requiresTag reports whether the BuildConstraint can only be satisfied if the
+// named tag is set - that is, whether every alternative includes it.
+func (c BuildConstraint) requiresTag(tag string) bool {
+	if len(c) == 0 {
+		return false
+	}
+
+	for _, terms := range c {
+		var has bool
+		for _, t := range terms {
+			if t == tag {
+				has = true
+				break
+			}
+		}
+		if !has {
+			return false
+		}
+	}
+	return true
+}
+
+func (bt BuildTarget) filterImports(imps []string, conds map[string]BuildConstraint, tags map[string]bool) []string {
+	if len(conds) == 0 {
+		return imps
+	}
+
+	ret := imps[:0]
+	for _, imp := range imps {
+		if c, has := conds[imp]; !has || bt.matches(c, tags) {
+			ret = append(ret, imp)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,184 @@
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildConstraint(t *testing.T) {
+	table := []struct {
+		name  string
+		fname string
+		lines []string
+		out   BuildConstraint
+	}{
+		{
+			name:  "unconstrained",
+			fname: "foo.go",
+		},
+		{
+			name:  "leading word is not a suffix",
+			fname: "linux.go",
+		},
+		{
+			name:  "os suffix",
+			fname: "foo_windows.go",
+			out:   BuildConstraint{{"windows"}},
+		},
+		{
+			name:  "os and arch suffix",
+			fname: "foo_linux_amd64.go",
+			out:   BuildConstraint{{"amd64", "linux"}},
+		},
+		{
+			name:  "test file suffix",
+			fname: "foo_darwin_test.go",
+			out:   BuildConstraint{{"darwin"}},
+		},
+		{
+			name:  "single line",
+			fname: "foo.go",
+			lines: []string{"linux darwin"},
+			out:   BuildConstraint{{"darwin"}, {"linux"}},
+		},
+		{
+			name:  "multiple lines are ANDed",
+			fname: "foo.go",
+			lines: []string{"linux darwin", "!cgo"},
+			out:   BuildConstraint{{"!cgo", "darwin"}, {"!cgo", "linux"}},
+		},
+		{
+			name:  "line and suffix",
+			fname: "foo_amd64.go",
+			lines: []string{"linux,appengine"},
+			out:   BuildConstraint{{"amd64", "appengine", "linux"}},
+		},
+	}
+
+	for _, fix := range table {
+		c := parseBuildConstraint(fix.fname, fix.lines)
+		if !reflect.DeepEqual(c, fix.out) {
+			t.Errorf("(fix: %q) parseBuildConstraint returned %#v, expected %#v", fix.name, c, fix.out)
+		}
+	}
+}
+
+func TestBuildTargetMatches(t *testing.T) {
+	linux := BuildTarget{Platforms: []Platform{{OS: "linux", Arch: "amd64"}}}
+	all := BuildTarget{}
+	tagged := BuildTarget{
+		Platforms: []Platform{{OS: "linux", Arch: "amd64"}},
+		Tags:      []string{"appengine"},
+	}
+
+	table := []struct {
+		c                  BuildConstraint
+		linux, all, tagged bool
+	}{
+		{nil, true, true, true},
+		{BuildConstraint{{"linux"}}, true, true, true},
+		{BuildConstraint{{"windows"}}, false, true, false},
+		{BuildConstraint{{"!windows"}}, true, true, true},
+		{BuildConstraint{{"linux", "386"}}, false, true, false},
+		{BuildConstraint{{"appengine"}}, false, false, true},
+		{BuildConstraint{{"!appengine"}}, true, true, false},
+		{BuildConstraint{{"windows"}, {"appengine"}}, false, true, true},
+	}
+
+	for _, fix := range table {
+		if got := linux.Matches(fix.c); got != fix.linux {
+			t.Errorf("%q: linux/amd64 target returned %v, expected %v", fix.c, got, fix.linux)
+		}
+		if got := all.Matches(fix.c); got != fix.all {
+			t.Errorf("%q: empty target returned %v, expected %v", fix.c, got, fix.all)
+		}
+		if got := tagged.Matches(fix.c); got != fix.tagged {
+			t.Errorf("%q: tagged target returned %v, expected %v", fix.c, got, fix.tagged)
+		}
+	}
+}
+
+func TestBuildConstraintRequiresTag(t *testing.T) {
+	table := []struct {
+		c   BuildConstraint
+		req bool
+	}{
+		{nil, false},
+		{BuildConstraint{{"cgo"}}, true},
+		{BuildConstraint{{"cgo", "linux"}}, true},
+		{BuildConstraint{{"!cgo"}}, false},
+		{BuildConstraint{{"cgo"}, {"linux"}}, false},
+		{BuildConstraint{{"cgo", "darwin"}, {"cgo", "linux"}}, true},
+	}
+
+	for _, fix := range table {
+		if got := fix.c.requiresTag("cgo"); got != fix.req {
+			t.Errorf("%q: requiresTag returned %v, expected %v", fix.c, got, fix.req)
+		}
+	}
+}
+
+func TestImportConstraints(t *testing.T) {
+	files := []goFile{
+		{name: "a.go", imports: []string{"sort", "github.com/common/dep"}},
+		{name: "a_windows.go", imports: []string{"github.com/win/reg", "github.com/common/dep"}, constraint: BuildConstraint{{"windows"}}},
+		{name: "a_linux.go", imports: []string{"github.com/lin/x"}, constraint: BuildConstraint{{"linux"}}},
+		{name: "a_darwin.go", imports: []string{"github.com/lin/x"}, constraint: BuildConstraint{{"darwin"}}},
+		{name: "a_test.go", test: true, imports: []string{"github.com/test/dep"}},
+	}
+
+	got := importConstraints(files, false)
+	want := map[string]BuildConstraint{
+		"github.com/win/reg": {{"windows"}},
+		"github.com/lin/x":   {{"darwin"}, {"linux"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("importConstraints returned %#v, expected %#v", got, want)
+	}
+
+	if got = importConstraints(files, true); got != nil {
+		t.Errorf("expected nil constraints for unconditional test imports, got %#v", got)
+	}
+}
+
+func TestPackageTreeForTarget(t *testing.T) {
+	pt := PackageTree{
+		ImportRoot: "root",
+		Packages: map[string]PackageOrErr{
+			"root": {
+				P: Package{
+					ImportPath: "root",
+					Name:       "root",
+					Imports:    []string{"github.com/lin/x", "github.com/win/reg", "sort"},
+					ImportConstraints: map[string]BuildConstraint{
+						"github.com/lin/x":   {{"linux"}},
+						"github.com/win/reg": {{"windows"}},
+					},
+					TestImports: []string{"github.com/win/test"},
+					TestImportConstraints: map[string]BuildConstraint{
+						"github.com/win/test": {{"windows"}},
+					},
+				},
+			},
+		},
+	}
+
+	lt := pt.ForTarget(BuildTarget{Platforms: []Platform{{OS: "linux", Arch: "amd64"}}})
+	p := lt.Packages["root"].P
+	if want := []string{"github.com/lin/x", "sort"}; !reflect.DeepEqual(p.Imports, want) {
+		t.Errorf("expected imports %v for linux target, got %v", want, p.Imports)
+	}
+	if len(p.TestImports) != 0 {
+		t.Errorf("expected no test imports for linux target, got %v", p.TestImports)
+	}
+
+	// The original tree must be left untouched
+	if len(pt.Packages["root"].P.Imports) != 3 {
+		t.Errorf("ForTarget modified the original PackageTree: %v", pt.Packages["root"].P.Imports)
+	}
+
+	at := pt.ForTarget(BuildTarget{})
+	if len(at.Packages["root"].P.Imports) != 3 {
+		t.Errorf("expected all imports for empty target, got %v", at.Packages["root"].P.Imports)
+	}
+}
@@ -829,6 +829,346 @@ func TestVersionUnion(t *testing.T) {
 	}
 }
 
+func TestUnionConstraintOps(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	master := NewBranch("master")
+	c1 := NewUnionConstraint(mkSVC("^1.0.0"), master)
+
+	if _, ok := c1.(unionConstraint); !ok {
+		t.Fatalf("Expected a unionConstraint, got %T", c1)
+	}
+	if s := c1.String(); s != "^1.0.0 || master" {
+		t.Errorf("Unexpected string for union: %q", s)
+	}
+
+	// Construction simplifies
+	if c := NewUnionConstraint(); c != none {
+		t.Errorf("Empty union should be none, got %T", c)
+	}
+	if c := NewUnionConstraint(master, none); c != master {
+		t.Errorf("Union of a single non-none member should be that member, got %T", c)
+	}
+	if c := NewUnionConstraint(master, any); c != any {
+		t.Errorf("Union including any should be any, got %T", c)
+	}
+	if c := NewUnionConstraint(c1, master, NewBranch("dev")); len(c.(unionConstraint)) != 3 {
+		t.Errorf("Nested unions should be flattened and deduplicated, got %s", c)
+	}
+
+	// Matches
+	if !c1.Matches(NewVersion("1.2.0")) {
+		t.Errorf("Union should match a version in its semver range")
+	}
+	if !c1.Matches(master.Is(rev)) {
+		t.Errorf("Union should match its branch when paired")
+	}
+	if c1.Matches(NewVersion("2.0.0")) {
+		t.Errorf("Union should not match a version outside all its members")
+	}
+	if c1.Matches(NewBranch("dev")) {
+		t.Errorf("Union should not match a different branch")
+	}
+
+	// MatchesAny, in both directions
+	if !c1.MatchesAny(mkSVC("~1.2.0")) || !mkSVC("~1.2.0").MatchesAny(c1) {
+		t.Errorf("Union should match any on an overlapping semver range")
+	}
+	if !c1.MatchesAny(master) || !master.MatchesAny(c1) {
+		t.Errorf("Union should match any on its branch")
+	}
+	if c1.MatchesAny(mkSVC("^2.0.0")) || mkSVC("^2.0.0").MatchesAny(c1) {
+		t.Errorf("Union should not match any on a disjoint semver range")
+	}
+	if c1.MatchesAny(none) || !c1.MatchesAny(any) {
+		t.Errorf("Union should match any on any, but not on none")
+	}
+
+	// Intersect, in both directions
+	if rc := c1.Intersect(mkSVC("~1.2.0")); typedConstraintString(rc) != "svc-~1.2.0" {
+		t.Errorf("Union should intersect down to the overlapping range, got %s", typedConstraintString(rc))
+	}
+	if rc := master.Intersect(c1); rc != master {
+		t.Errorf("Branch should intersect with union down to the branch, got %s (%T)", rc, rc)
+	}
+	if rc := c1.Intersect(NewVersion("1.0.1")); rc != NewVersion("1.0.1") {
+		t.Errorf("Union should intersect with a matching version to that version, got %s (%T)", rc, rc)
+	}
+	if rc := c1.Intersect(mkSVC("^2.0.0")); rc != none {
+		t.Errorf("Union should not intersect with a disjoint range, got %s", rc)
+	}
+	c2 := NewUnionConstraint(mkSVC("~1.3.0"), NewBranch("dev"), master)
+	if rc := c1.Intersect(c2); typedConstraintString(rc) != "u-svc-~1.3.0 || b-master" {
+		t.Errorf("Unexpected intersection of unions: %s", typedConstraintString(rc))
+	}
+
+	// Cross-type comparisons through a versionTypeUnion
+	dev := NewBranch("dev").Is(rev)
+	uv := versionTypeUnion{dev, NewVersion("1.1.0").Is(rev)}
+	if c1.Matches(dev) {
+		t.Errorf("Union should not match the dev branch directly")
+	}
+	if !c1.Matches(uv) {
+		t.Errorf("Union should match a versionTypeUnion with a member in range")
+	}
+	if !uv.MatchesAny(c1) || !c1.MatchesAny(uv) {
+		t.Errorf("Union should match any on a versionTypeUnion with a member in range")
+	}
+	if rc := uv.Intersect(c1); rc == none {
+		t.Errorf("versionTypeUnion should intersect with a union that allows one of its members")
+	}
+
+	// Intersection with a versionTypeUnion is symmetric, yielding the first
+	// member the union allows
+	uv2 := versionTypeUnion{NewVersion("1.4.3").Is(rev), master.Is(rev)}
+	rc1, rc2 := c1.Intersect(uv2), uv2.Intersect(c1)
+	if rc1 != NewVersion("1.4.3").Is(rev) {
+		t.Errorf("Union intersected with a versionTypeUnion should be its first allowed member, got %s", rc1)
+	}
+	if rc1 != rc2 {
+		t.Errorf("Intersection with a versionTypeUnion should be symmetric, got %s and %s", rc1, rc2)
+	}
+	if rc := c1.Intersect(versionTypeUnion{dev}); rc != none {
+		t.Errorf("Union should not intersect with a versionTypeUnion with no allowed members, got %s", rc)
+	}
+}
+
+func TestExclusionConstraintOps(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	v143 := NewVersion("1.4.3")
+	c1 := NewExclusionConstraint(mkSVC("^1.2.0"), v143)
+
+	if _, ok := c1.(exclusionConstraint); !ok {
+		t.Fatalf("Expected an exclusionConstraint, got %T", c1)
+	}
+	if s := c1.String(); s != "^1.2.0 except 1.4.3" {
+		t.Errorf("Unexpected string for exclusion: %q", s)
+	}
+
+	// Construction simplifies
+	if c := NewExclusionConstraint(NewBranch("master")); c != NewBranch("master") {
+		t.Errorf("Exclusion without excluded versions should be the input constraint, got %T", c)
+	}
+	if c := NewExclusionConstraint(v143, v143); c != none {
+		t.Errorf("Exclusion of a version from itself should be none, got %T", c)
+	}
+	if c := NewExclusionConstraint(NewVersion("1.4.4"), v143); c != NewVersion("1.4.4") {
+		t.Errorf("Exclusion of a different version from a version should be the version, got %T", c)
+	}
+	if c := NewExclusionConstraint(c1, NewVersion("1.5.0"), v143); len(c.(exclusionConstraint).ex) != 2 {
+		t.Errorf("Nested exclusions should be merged, got %s", c)
+	}
+
+	// Matches
+	if !c1.Matches(NewVersion("1.4.4")) {
+		t.Errorf("Exclusion should match a non-excluded version in range")
+	}
+	if c1.Matches(v143) {
+		t.Errorf("Exclusion should not match an excluded version")
+	}
+	if c1.Matches(v143.Is(rev)) {
+		t.Errorf("Exclusion should not match an excluded version when paired")
+	}
+	if c1.Matches(NewVersion("2.0.0")) {
+		t.Errorf("Exclusion should not match a version outside its range")
+	}
+
+	// Excluding a revision rules out everything paired with it
+	c2 := NewExclusionConstraint(any, rev)
+	if c2.Matches(NewVersion("1.0.0").Is(rev)) || c2.Matches(rev) {
+		t.Errorf("Exclusion of a revision should not match versions paired with it")
+	}
+	if !c2.Matches(NewVersion("1.0.0")) || !c2.Matches(NewBranch("master").Is("other")) {
+		t.Errorf("Exclusion of a revision should match versions not paired with it")
+	}
+
+	// MatchesAny and Intersect, in both directions
+	if !c1.MatchesAny(mkSVC("~1.4.0")) || !mkSVC("~1.4.0").MatchesAny(c1) {
+		t.Errorf("Exclusion should match any on an overlapping range")
+	}
+	if c1.MatchesAny(v143) || v143.MatchesAny(c1) {
+		t.Errorf("Exclusion should not match any on the excluded version")
+	}
+	if c1.MatchesAny(v143.Is(rev)) || v143.Is(rev).Intersect(c1) != none {
+		t.Errorf("Exclusion should not match any on the excluded version when paired")
+	}
+	if rc := c1.Intersect(mkSVC("~1.4.0")); typedConstraintString(rc) != "ex-svc-~1.4.0 except sv-1.4.3" {
+		t.Errorf("Unexpected intersection with range: %s", typedConstraintString(rc))
+	}
+	if rc := mkSVC("~1.4.0").Intersect(c1); typedConstraintString(rc) != "ex-svc-~1.4.0 except sv-1.4.3" {
+		t.Errorf("Unexpected reverse intersection with range: %s", typedConstraintString(rc))
+	}
+	if rc := c1.Intersect(NewExclusionConstraint(any, NewVersion("1.5.0"))); typedConstraintString(rc) != "ex-svc-^1.2.0 except sv-1.4.3, sv-1.5.0" {
+		t.Errorf("Unexpected intersection of exclusions: %s", typedConstraintString(rc))
+	}
+	if rc := c1.Intersect(mkSVC("^2.0.0")); rc != none {
+		t.Errorf("Exclusion should not intersect with a disjoint range, got %s", rc)
+	}
+
+	// Exclusions distribute over unions
+	uc := NewUnionConstraint(mkSVC("~1.4.0"), NewBranch("master"))
+	if rc := NewExclusionConstraint(uc, NewBranch("master")); typedConstraintString(rc) != "svc-~1.4.0" {
+		t.Errorf("Exclusion should distribute over union members, got %s", typedConstraintString(rc))
+	}
+	if rc := uc.Intersect(c1); typedConstraintString(rc) != "ex-svc-~1.4.0 except sv-1.4.3" {
+		t.Errorf("Unexpected intersection of union with exclusion: %s", typedConstraintString(rc))
+	}
+
+	// Through a versionTypeUnion, a version is allowed if any of its
+	// equivalent versions is allowed
+	uv := versionTypeUnion{NewBranch("master").Is(rev), v143.Is(rev), NewVersion("1.4.4").Is(rev)}
+	if !c1.Matches(uv) || !c1.MatchesAny(uv) || !uv.MatchesAny(c1) {
+		t.Errorf("Exclusion should match a versionTypeUnion with a non-excluded member in range")
+	}
+	if rc := c1.Intersect(uv); rc != NewVersion("1.4.4").Is(rev) {
+		t.Errorf("Exclusion should intersect with a versionTypeUnion to its allowed member, got %s", rc)
+	}
+	uv = versionTypeUnion{NewBranch("master").Is(rev), v143.Is(rev)}
+	if c1.Matches(uv) || c1.MatchesAny(uv) || uv.MatchesAny(c1) {
+		t.Errorf("Exclusion should not match a versionTypeUnion whose only in-range member is excluded")
+	}
+}
+
+func TestSemverConstraintPrereleasePolicy(t *testing.T) {
+	rc1 := NewVersion("1.3.0-rc1")
+	rc1p := rc1.Is("rev")
+	rel := NewVersion("1.3.0")
+
+	c := mkSVC("^1.2.0")
+	for _, fix := range []struct {
+		p  PrereleasePolicy
+		ok bool
+	}{
+		{PrereleasesAllowed, true},
+		{PrereleasesIfNamed, false},
+		{PrereleasesNever, false},
+	} {
+		pc := withPrereleasePolicy(c, fix.p)
+		if pc.Matches(rc1) != fix.ok || pc.Matches(rc1p) != fix.ok {
+			t.Errorf("%s policy: expected %s matching %s to be %v", fix.p, pc, rc1, fix.ok)
+		}
+		if (pc.Intersect(rc1) != none) != fix.ok || (rc1.Intersect(pc) != none) != fix.ok || rc1p.MatchesAny(pc) != fix.ok {
+			t.Errorf("%s policy: expected %s intersecting %s to be non-empty: %v", fix.p, pc, rc1, fix.ok)
+		}
+		if !pc.Matches(rel) {
+			t.Errorf("%s policy: releases should always match", fix.p)
+		}
+		if prereleaseRejects(pc, rc1) == fix.ok {
+			t.Errorf("%s policy: expected prereleaseRejects to be %v", fix.p, !fix.ok)
+		}
+	}
+
+	named := withPrereleasePolicy(mkSVC(">=1.3.0-rc1, <2.0.0"), PrereleasesIfNamed)
+	if !named.Matches(NewVersion("1.3.0-rc2")) {
+		t.Errorf("A constraint naming a pre-release should match other pre-releases of the same version")
+	}
+	if named.Matches(NewVersion("1.4.0-beta")) {
+		t.Errorf("A constraint naming a pre-release should not match pre-releases of other versions")
+	}
+	if withPrereleasePolicy(mkSVC(">=1.3.0-rc1, <2.0.0"), PrereleasesNever).Matches(NewVersion("1.3.0-rc2")) {
+		t.Errorf("Never policy should reject pre-releases even if named")
+	}
+
+	// Intersections keep the stricter policy
+	if rc := withPrereleasePolicy(c, PrereleasesNever).Intersect(mkSVC("~1.3.0")); rc.Matches(rc1) || rc.(semverConstraint).pre != PrereleasesNever {
+		t.Errorf("Intersection should keep the stricter pre-release policy")
+	}
+	if rc := mkSVC("~1.3.0").Intersect(withPrereleasePolicy(c, PrereleasesNever)); rc.Matches(rc1) {
+		t.Errorf("Intersection should keep the stricter pre-release policy in either direction")
+	}
+
+	// Policy is applied through unions and exclusions
+	uc := withPrereleasePolicy(NewUnionConstraint(c, NewBranch("master")), PrereleasesNever)
+	if uc.Matches(rc1) || !uc.Matches(NewBranch("master")) {
+		t.Errorf("Pre-release policy should apply to semver members of unions")
+	}
+	ec := withPrereleasePolicy(NewExclusionConstraint(c, NewVersion("1.2.5")), PrereleasesNever)
+	if ec.Matches(rc1) || !ec.Matches(rel) {
+		t.Errorf("Pre-release policy should apply to the constraint in an exclusion")
+	}
+
+	// The policy doesn't affect the constraint's identity as input
+	if typedConstraintString(withPrereleasePolicy(c, PrereleasesNever)) != typedConstraintString(c) {
+		t.Errorf("Pre-release policy should not change the typed string of a constraint")
+	}
+}
+
+func TestDefaultBranchConstraintOps(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	c := DefaultBranchConstraint()
+	trunk := newDefaultBranch("trunk")
+
+	if c.String() != "(default branch)" {
+		t.Errorf("Unexpected string for default branch constraint: %q", c.String())
+	}
+
+	// Only branches marked as the default by a source match, whatever their name
+	matches := map[Version]bool{
+		trunk:                    true,
+		trunk.Is(rev):            true,
+		newDefaultBranch("main"): true,
+		NewBranch("trunk"):       false,
+		NewBranch("master"):      false,
+		NewVersion("1.0.0"):      false,
+		rev:                      false,
+	}
+	for v, want := range matches {
+		if got := c.Matches(v); got != want {
+			t.Errorf("Matches(%s) should be %v, got %v", v, want, got)
+		}
+	}
+	if !c.Matches(versionTypeUnion{NewBranch("master").Is(rev), trunk.Is(rev)}) {
+		t.Errorf("Default branch constraint should match a versionTypeUnion including the default branch")
+	}
+
+	// Intersect and MatchesAny, in both directions
+	if c.Intersect(any) != c || any.Intersect(c) != c || c.Intersect(c) != c {
+		t.Errorf("Default branch constraint should intersect with any and itself to itself")
+	}
+	if c.Intersect(none) != none || c.MatchesAny(none) {
+		t.Errorf("Default branch constraint should not intersect with none")
+	}
+	if rc := c.Intersect(trunk.Is(rev)); rc != trunk.Is(rev) {
+		t.Errorf("Intersection with the default branch should be the branch, got %s", rc)
+	}
+	if rc := trunk.Is(rev).Intersect(c); rc != trunk.Is(rev) {
+		t.Errorf("Reverse intersection with the default branch should be the branch, got %s", rc)
+	}
+	if rc := trunk.Intersect(c); rc != trunk {
+		t.Errorf("Reverse intersection with the unpaired default branch should be the branch, got %s", rc)
+	}
+	if c.MatchesAny(NewBranch("master")) || NewBranch("master").MatchesAny(c) {
+		t.Errorf("Default branch constraint should not match any on a non-default branch")
+	}
+	if c.MatchesAny(mkSVC("^1.0.0")) || mkSVC("^1.0.0").MatchesAny(c) {
+		t.Errorf("Default branch constraint should not match any on a semver range")
+	}
+
+	// Composes with unions and exclusions
+	uc := NewUnionConstraint(mkSVC("^1.0.0"), c)
+	if !uc.Matches(trunk) || !uc.Matches(NewVersion("1.2.0")) || uc.Matches(NewBranch("master")) {
+		t.Errorf("Union with the default branch constraint should match either member")
+	}
+	if rc := uc.Intersect(trunk.Is(rev)); rc != trunk.Is(rev) {
+		t.Errorf("Union should intersect with the default branch to the branch, got %s", rc)
+	}
+	if ec := NewExclusionConstraint(c, rev); ec.Matches(trunk.Is(rev)) || !ec.Matches(trunk.Is("other")) {
+		t.Errorf("Exclusion from the default branch constraint should rule out the excluded revision only")
+	}
+
+	// Typed and user strings
+	if ts := typedConstraintString(c); ts != "db-(default branch)" {
+		t.Errorf("Unexpected typed string: %q", ts)
+	}
+	for _, s := range []string{"db-(default branch)", "(default branch)"} {
+		if pc, err := ParseConstraint(s, nil); err != nil || pc != c {
+			t.Errorf("Expected %q to parse to the default branch constraint, got %v (err %v)", s, pc, err)
+		}
+	}
+	if pc, err := ParseConstraint("u-svc-^1.0.0 || db-(default branch)", nil); err != nil || !pc.Matches(trunk) {
+		t.Errorf("Expected a union including the default branch constraint to parse, got %v (err %v)", pc, err)
+	}
+}
+
 func TestVersionUnionPanicOnType(t *testing.T) {
 	// versionTypeUnions need to panic if Type() gets called
 	defer func() {
@@ -894,6 +1234,18 @@ func TestTypedConstraintString(t *testing.T) {
 			in:  v5,
 			out: "pv-2.0.5.2",
 		},
+		{
+			in:  NewUnionConstraint(mkSVC("1.x || 2.x"), v1, NewVersion("v3.0.0").Is(rev)),
+			out: "u-svc->=1.0.0, <3.0.0 || b-master || sv-v3.0.0-r-" + string(rev),
+		},
+		{
+			in:  NewExclusionConstraint(any, v3, NewBranch("bad-r-branch")),
+			out: "ex-any-* except b-bad-r-branch, sv-1.0.1",
+		},
+		{
+			in:  NewUnionConstraint(NewExclusionConstraint(any, rev), v1),
+			out: "u-ex-any-* except r-" + string(rev) + " || b-master",
+		},
 	}
 
 	for _, fix := range table {
@@ -901,5 +1253,116 @@ func TestTypedConstraintString(t *testing.T) {
 		if got != fix.out {
 			t.Errorf("Typed string for %v (%T) was not expected %q; got %q", fix.in, fix.in, fix.out, got)
 		}
+
+		// Typed strings must round-trip through ParseConstraint
+		c, err := ParseConstraint(got, nil)
+		if err != nil {
+			t.Errorf("Unexpected error parsing typed string %q: %s", got, err)
+		} else if rt := typedConstraintString(c); rt != got {
+			t.Errorf("Typed string %q did not round-trip; got %q (%T)", got, rt, c)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	rev := Revision("f6e74e8d")
+	table := []struct {
+		in  string
+		vl  []Version
+		out Version
+	}{
+		{in: "b-master", out: NewBranch("master")},
+		{in: "pv-1.0.0", out: plainVersion("1.0.0")},
+		{in: "sv-v1.0.0", out: NewVersion("v1.0.0")},
+		{in: "r-f6e74e8d", out: rev},
+		{in: "sv-v1.0.0-r-f6e74e8d", out: NewVersion("v1.0.0").Is(rev)},
+		// Without a list, "-r-" splits into a pair at the last occurrence
+		{in: "b-foo-r-bar-r-f6e74e8d", out: NewBranch("foo-r-bar").Is(rev)},
+		{
+			in:  "b-foo-r-bar-r-f6e74e8d",
+			vl:  []Version{NewBranch("foo").Is("bar-r-f6e74e8d")},
+			out: NewBranch("foo").Is("bar-r-f6e74e8d"),
+		},
+		{in: "sv-1.0.0-r-beta", out: NewVersion("1.0.0").Is("beta")},
+		{
+			in:  "sv-1.0.0-r-beta",
+			vl:  []Version{NewVersion("1.0.0-r-beta").Is(rev)},
+			out: NewVersion("1.0.0-r-beta"),
+		},
+	}
+
+	for _, fix := range table {
+		v, err := ParseVersion(fix.in, fix.vl)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", fix.in, err)
+			continue
+		}
+		if !v.Matches(fix.out) || v.Type() != fix.out.Type() || v.String() != fix.out.String() {
+			t.Errorf("Expected %q to parse to %q (%T), got %q (%T)", fix.in, fix.out, fix.out, v, v)
+		}
+		if pv, ok := fix.out.(PairedVersion); ok {
+			if v.(PairedVersion).Underlying() != pv.Underlying() {
+				t.Errorf("Expected %q to parse with revision %q, got %q", fix.in, pv.Underlying(), v.(PairedVersion).Underlying())
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "master", "b-", "sv-notsemver", "x-foo"} {
+		if _, err := ParseVersion(bad, nil); err == nil {
+			t.Errorf("Expected error parsing %q", bad)
+		}
+	}
+}
+
+func TestParseConstraintUserStrings(t *testing.T) {
+	rev := Revision("0123456789abcdef0123456789abcdef01234567")
+	vl := []Version{
+		NewBranch("master").Is("rev1"),
+		NewBranch("v1").Is("rev2"),
+		NewVersion("v1.0.0").Is("rev3"),
+		NewVersion("footag").Is("rev4"),
+		NewVersion("both").Is("rev5"),
+		NewBranch("both").Is("rev6"),
+	}
+
+	table := []struct {
+		in  string
+		vl  []Version
+		out string // typed string of the expected constraint, or "" for an error
+	}{
+		{in: "*", out: "any-*"},
+		{in: "", out: "any-*"},
+		{in: "^1.0.0", out: "svc-^1.0.0"},
+		{in: "v1.0.0", out: "sv-v1.0.0"},
+		{in: "master", out: ""},
+		{in: "master", vl: vl, out: "b-master"},
+		{in: "footag", vl: vl, out: "pv-footag"},
+		{in: "rev3", vl: vl, out: "r-rev3"},
+		{in: "v1", vl: vl, out: "b-v1"},
+		{in: "both", vl: vl, out: ""},
+		{in: "nope", vl: vl, out: ""},
+		{in: string(rev), out: "r-" + string(rev)},
+		{in: "1.x || 2.x", out: "svc->=1.0.0, <3.0.0"},
+		{in: "^2.0.0 || master", vl: vl, out: "u-svc-^2.0.0 || b-master"},
+		{in: "^2.0.0 || master", out: ""},
+		{in: "^1.0.0 except 1.4.3, v1.5.0", out: "ex-svc-^1.0.0 except sv-1.4.3, sv-v1.5.0"},
+		{in: "* except footag", vl: vl, out: "ex-any-* except pv-footag"},
+		{in: "* except ^1.0.0", out: ""},
+	}
+
+	for _, fix := range table {
+		c, err := ParseConstraint(fix.in, fix.vl)
+		if fix.out == "" {
+			if err == nil {
+				t.Errorf("Expected error parsing %q, got %q", fix.in, typedConstraintString(c))
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", fix.in, err)
+		} else if got := typedConstraintString(c); got != fix.out {
+			t.Errorf("Expected %q to parse to %q, got %q", fix.in, fix.out, got)
+		}
 	}
 }
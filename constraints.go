@@ -3,6 +3,7 @@ package gps
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/Masterminds/semver"
 )
@@ -43,18 +44,264 @@ func typedConstraintString(c Constraint) string {
 		return typedVersionString(tc)
 	case semverConstraint:
 		prefix = "svc"
+	case schemeConstraint:
+		prefix = "vs-" + tc.vs.Name()
 	case anyConstraint:
 		prefix = "any"
+	case defaultBranchConstraint:
+		prefix = "db"
 	case noneConstraint:
 		prefix = "none"
+	case unionConstraint:
+		strs := make([]string, len(tc))
+		for k, m := range tc {
+			strs[k] = typedConstraintString(m)
+		}
+		return "u-" + strings.Join(strs, " || ")
+	case exclusionConstraint:
+		strs := make([]string, len(tc.ex))
+		for k, v := range tc.ex {
+			strs[k] = typedVersionString(v)
+		}
+		return fmt.Sprintf("ex-%s except %s", typedConstraintString(tc.c), strings.Join(strs, ", "))
 	}
 
 	return fmt.Sprintf("%s-%s", prefix, c.String())
 }
 
-func (semverConstraint) _private() {}
-func (anyConstraint) _private()    {}
-func (noneConstraint) _private()   {}
+// ParseConstraint parses a string into the Constraint it represents.
+//
+// Strings in the typed form produced by typedConstraintString (as used in
+// input hashes) are parsed exactly, such that the result's typed string is
+// again the input. In addition to the typed Version forms accepted by
+// ParseVersion, these are:
+//
+//  svc-<range>: a semver range, e.g. "svc-^1.0.0"
+//  any-*:       the constraint allowing any version
+//  db-(default branch):
+//               the constraint allowing only the default branch
+//  none-:       the constraint allowing no versions
+//  u-<typed constraint> || <typed constraint>...:
+//               a union, e.g. "u-svc-^1.0.0 || b-master"
+//  ex-<typed constraint> except <typed version>, <typed version>...:
+//               an exclusion, e.g. "ex-svc-^1.0.0 except sv-1.4.3"
+//  vs-<scheme>-<range>:
+//               a range in a registered VersionScheme, e.g.
+//               "vs-calver->=2026.04, <2027"
+//
+// Any other string is taken to be user-written, and interpreted as follows:
+//
+//  - Alternatives separated by "||" form a union, unless the whole string is
+//  a valid semver range. Each alternative is parsed as a constraint in its own
+//  right, so "^1.2.0 || master" allows either.
+//  - A constraint followed by "except" and a comma-separated list of versions
+//  excludes those versions, as in "^1.2.0 except 1.4.3".
+//  - "" or "*" allows any version.
+//  - "(default branch)" allows only the project's default branch, whatever
+//  its name (see DefaultBranchConstraint).
+//  - If a version list is provided (as from SourceManager.ListVersions()),
+//  a revision, branch or tag in it named by the string is used. It is an
+//  error if the string names both a branch and a tag.
+//  - Otherwise, a valid semver version or range is used as such.
+//  - Otherwise, if a version list was provided, it is an error, as nothing in
+//  the source matches. Without one, a full 40 character hexadecimal string is
+//  taken to be a revision; anything else is ambiguous between a branch and a
+//  non-semver tag, and is an error.
+//
+// The version list is also used to disambiguate typed strings; see
+// ParseVersion.
+func ParseConstraint(s string, vl []Version) (Constraint, error) {
+	switch {
+	case s == "any-*":
+		return any, nil
+	case s == "none-":
+		return none, nil
+	case s == "db-(default branch)", s == "(default branch)":
+		return defaultBranchConstraint{}, nil
+	case strings.HasPrefix(s, "svc-"):
+		c, err := NewSemverConstraint(s[4:])
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid typed semver constraint string: %s", s, err)
+		}
+		return c, nil
+	case strings.HasPrefix(s, "vs-"):
+		i := strings.Index(s[3:], "-")
+		if i < 0 {
+			return nil, fmt.Errorf("%q is not a valid typed version scheme constraint string", s)
+		}
+		vs, has := versionSchemeNamed(s[3 : 3+i])
+		if !has {
+			return nil, fmt.Errorf("%q uses unknown version scheme %q", s, s[3:3+i])
+		}
+		c, err := NewSchemeConstraint(vs, s[4+i:])
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid typed version scheme constraint string: %s", s, err)
+		}
+		return c, nil
+	case strings.HasPrefix(s, "u-"):
+		var cs []Constraint
+		for _, m := range splitTyped(s[2:], " || ") {
+			c, err := ParseConstraint(m, vl)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid typed union constraint string: %s", s, err)
+			}
+			cs = append(cs, c)
+		}
+		return NewUnionConstraint(cs...), nil
+	case strings.HasPrefix(s, "ex-"):
+		c, err := parseExclusion(s[3:], vl, ParseVersion)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid typed exclusion constraint string: %s", s, err)
+		}
+		return c, nil
+	}
+
+	if strings.Contains(s, "||") {
+		if _, err := semver.NewConstraint(s); err != nil {
+			var cs []Constraint
+			for _, m := range strings.Split(s, "||") {
+				c, err := ParseConstraint(strings.TrimSpace(m), vl)
+				if err != nil {
+					return nil, err
+				}
+				cs = append(cs, c)
+			}
+			return NewUnionConstraint(cs...), nil
+		}
+	}
+
+	if strings.Contains(s, " except ") {
+		return parseExclusion(s, vl, func(vs string, vl []Version) (Version, error) {
+			c, err := ParseConstraint(vs, vl)
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := c.(Version); ok {
+				return v, nil
+			}
+			return nil, fmt.Errorf("%q is not a single version, and cannot be excluded", vs)
+		})
+	}
+
+	if v, err := ParseVersion(s, vl); err == nil {
+		return v, nil
+	}
+
+	return parseUserConstraint(s, vl)
+}
+
+// typedPrefixes are the type prefixes used by typedConstraintString.
+var typedPrefixes = []string{"b-", "pv-", "sv-", "r-", "svc-", "vs-", "any-", "db-", "none-", "u-", "ex-"}
+
+// splitTyped splits a string of typed constraint strings on sep. Because semver
+// ranges may themselves contain separators, pieces that don't begin with a type
+// prefix are rejoined to the piece preceding them.
+func splitTyped(s, sep string) []string {
+	var out []string
+	for _, piece := range strings.Split(s, sep) {
+		typed := false
+		for _, pre := range typedPrefixes {
+			if strings.HasPrefix(piece, pre) {
+				typed = true
+				break
+			}
+		}
+		if typed || len(out) == 0 {
+			out = append(out, piece)
+		} else {
+			out[len(out)-1] += sep + piece
+		}
+	}
+	return out
+}
+
+// parseExclusion parses "<constraint> except <version>, <version>...", using
+// the provided func to parse each excluded version.
+func parseExclusion(s string, vl []Version, parsev func(string, []Version) (Version, error)) (Constraint, error) {
+	i := strings.LastIndex(s, " except ")
+	if i < 0 {
+		return nil, fmt.Errorf("%q has no excluded versions", s)
+	}
+
+	c, err := ParseConstraint(strings.TrimSpace(s[:i]), vl)
+	if err != nil {
+		return nil, err
+	}
+
+	var ex []Version
+	for _, vs := range strings.Split(s[i+8:], ",") {
+		v, err := parsev(strings.TrimSpace(vs), vl)
+		if err != nil {
+			return nil, err
+		}
+		ex = append(ex, v)
+	}
+	return NewExclusionConstraint(c, ex...), nil
+}
+
+// parseUserConstraint interprets an untyped, user-written constraint string, as
+// described in ParseConstraint.
+func parseUserConstraint(s string, vl []Version) (Constraint, error) {
+	if s == "" || s == "*" {
+		return any, nil
+	}
+
+	if vl != nil {
+		var matches []Version
+		for _, v := range vl {
+			if pv, ok := v.(PairedVersion); ok {
+				if string(pv.Underlying()) == s {
+					return pv.Underlying(), nil
+				}
+				v = pv.Unpair()
+			}
+			if v.String() == s && !versionInList(v, matches) {
+				matches = append(matches, v)
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+		case 1:
+			return matches[0], nil
+		default:
+			return nil, fmt.Errorf("%q is ambiguous, as it names both a branch and a tag; use a typed form, such as %q or %q", s, typedVersionString(matches[0]), typedVersionString(matches[1]))
+		}
+	}
+
+	if c, err := NewSemverConstraint(s); err == nil {
+		return c, nil
+	}
+
+	if vl != nil {
+		return nil, fmt.Errorf("%q is not a valid semver constraint, and does not name any version in the source", s)
+	}
+	if isHexRevision(s) {
+		return Revision(s), nil
+	}
+	return nil, fmt.Errorf("%q may be either a branch or a non-semver tag; use a typed form, such as %q or %q", s, "b-"+s, "pv-"+s)
+}
+
+// isHexRevision indicates whether the string looks like a full git or hg
+// revision: 40 hexadecimal characters.
+func isHexRevision(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (semverConstraint) _private()        {}
+func (anyConstraint) _private()           {}
+func (defaultBranchConstraint) _private() {}
+func (noneConstraint) _private()          {}
+func (unionConstraint) _private()         {}
+func (exclusionConstraint) _private()     {}
 
 // NewSemverConstraint attempts to construct a semver Constraint object from the
 // input string.
@@ -76,6 +323,10 @@ func NewSemverConstraint(body string) (Constraint, error) {
 
 type semverConstraint struct {
 	c semver.Constraint
+	// pre governs whether pre-release versions may match, in addition to the
+	// range itself. It is set by the solver from the project's
+	// PrereleasePolicy; the zero value allows them.
+	pre PrereleasePolicy
 }
 
 func (c semverConstraint) String() string {
@@ -91,16 +342,59 @@ func (c semverConstraint) Matches(v Version) bool {
 			}
 		}
 	case semVersion:
-		return c.c.Matches(tv.sv) == nil
+		return c.admits(tv.sv)
 	case versionPair:
 		if tv2, ok := tv.v.(semVersion); ok {
-			return c.c.Matches(tv2.sv) == nil
+			return c.admits(tv2.sv)
 		}
 	}
 
 	return false
 }
 
+// admits indicates whether the semver version is within the constraint's range
+// and permitted by its pre-release policy.
+func (c semverConstraint) admits(sv *semver.Version) bool {
+	return c.c.Matches(sv) == nil && c.prereleaseOK(sv)
+}
+
+// prereleaseOK indicates whether the constraint's pre-release policy permits
+// the version, without regard to its range.
+func (c semverConstraint) prereleaseOK(sv *semver.Version) bool {
+	if sv.Prerelease() == "" {
+		return true
+	}
+
+	switch c.pre {
+	case PrereleasesNever:
+		return false
+	case PrereleasesIfNamed:
+		return c.namesPrerelease(sv)
+	}
+	return true
+}
+
+// namesPrerelease indicates whether any of the versions written in the
+// constraint is a pre-release of the same major, minor and patch version as
+// the provided version. Thus ">=1.3.0-rc1, <2.0.0" names pre-releases of 1.3.0,
+// but not of 1.4.0.
+func (c semverConstraint) namesPrerelease(sv *semver.Version) bool {
+	fields := strings.FieldsFunc(c.c.String(), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '|'
+	})
+
+	for _, f := range fields {
+		nv, err := semver.NewVersion(strings.TrimLeft(f, "<>=!~^"))
+		if err != nil || nv.Prerelease() == "" {
+			continue
+		}
+		if nv.Major() == sv.Major() && nv.Minor() == sv.Minor() && nv.Patch() == sv.Patch() {
+			return true
+		}
+	}
+	return false
+}
+
 func (c semverConstraint) MatchesAny(c2 Constraint) bool {
 	return c.Intersect(c2) != none
 }
@@ -109,6 +403,8 @@ func (c semverConstraint) Intersect(c2 Constraint) Constraint {
 	switch tc := c2.(type) {
 	case anyConstraint:
 		return c
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(c)
 	case versionTypeUnion:
 		for _, elem := range tc {
 			if rc := c.Intersect(elem); rc != none {
@@ -118,19 +414,22 @@ func (c semverConstraint) Intersect(c2 Constraint) Constraint {
 	case semverConstraint:
 		rc := c.c.Intersect(tc.c)
 		if !semver.IsNone(rc) {
-			return semverConstraint{c: rc}
+			// Keep the stricter of the two pre-release policies
+			pre := c.pre
+			if tc.pre > pre {
+				pre = tc.pre
+			}
+			return semverConstraint{c: rc, pre: pre}
 		}
 	case semVersion:
-		rc := c.c.Intersect(tc.sv)
-		if !semver.IsNone(rc) {
+		if c.admits(tc.sv) {
 			// If single version intersected with constraint, we know the result
 			// must be the single version, so just return it back out
 			return c2
 		}
 	case versionPair:
 		if tc2, ok := tc.v.(semVersion); ok {
-			rc := c.c.Intersect(tc2.sv)
-			if !semver.IsNone(rc) {
+			if c.admits(tc2.sv) {
 				// same reasoning as previous case
 				return c2
 			}
@@ -171,6 +470,66 @@ func (anyConstraint) Intersect(c Constraint) Constraint {
 	return c
 }
 
+// DefaultBranchConstraint returns a constraint that allows only the default
+// branch of a project, whatever that branch is named in the project's source:
+// the branch HEAD refers to in git, "default" (or the "@" bookmark) in hg, and
+// the trunk in bzr. This avoids having to assume that the default branch is
+// called master.
+//
+// Only versions from the SourceManager carry the knowledge of which branch is
+// the default, so the constraint never admits a branch created by NewBranch.
+func DefaultBranchConstraint() Constraint {
+	return defaultBranchConstraint{}
+}
+
+// defaultBranchConstraint allows only the branch that the source marks as
+// its default.
+type defaultBranchConstraint struct{}
+
+func (defaultBranchConstraint) String() string {
+	return "(default branch)"
+}
+
+func (c defaultBranchConstraint) Matches(v Version) bool {
+	switch tv := v.(type) {
+	case versionTypeUnion:
+		for _, elem := range tv {
+			if c.Matches(elem) {
+				return true
+			}
+		}
+	case branchVersion:
+		return tv.isDefault
+	case versionPair:
+		return c.Matches(tv.v)
+	}
+	return false
+}
+
+func (c defaultBranchConstraint) MatchesAny(c2 Constraint) bool {
+	return c.Intersect(c2) != none
+}
+
+func (c defaultBranchConstraint) Intersect(c2 Constraint) Constraint {
+	switch tc := c2.(type) {
+	case anyConstraint, defaultBranchConstraint:
+		return c
+	case unionConstraint, exclusionConstraint:
+		return tc.Intersect(c)
+	case versionTypeUnion:
+		for _, elem := range tc {
+			if c.Matches(elem) {
+				return elem
+			}
+		}
+	case Version:
+		if c.Matches(tc) {
+			return tc
+		}
+	}
+	return none
+}
+
 // noneConstraint is the empty set - it matches no versions. It mirrors the
 // behavior of the semver package's none type.
 type noneConstraint struct{}
@@ -191,6 +550,257 @@ func (noneConstraint) Intersect(Constraint) Constraint {
 	return none
 }
 
+// NewUnionConstraint creates a Constraint that allows any version allowed by at
+// least one of the provided constraints. Unlike semver's "||", the members may
+// be of any type, so a union can allow, for example, either a semver range or a
+// particular branch.
+//
+// Nested unions are flattened, and members that allow nothing are dropped. If
+// no members remain, none is returned; if only one does, it is returned
+// directly.
+func NewUnionConstraint(cs ...Constraint) Constraint {
+	var uc unionConstraint
+	for _, c := range cs {
+		switch tc := c.(type) {
+		case nil, noneConstraint:
+		case anyConstraint:
+			return any
+		case unionConstraint:
+			uc = uc.add(tc...)
+		default:
+			uc = uc.add(c)
+		}
+	}
+
+	switch len(uc) {
+	case 0:
+		return none
+	case 1:
+		return uc[0]
+	}
+	return uc
+}
+
+// unionConstraint is a set of constraints, OR'd together. It is always
+// constructed through NewUnionConstraint, so it never contains other unions,
+// any, or none, and always has at least two members.
+type unionConstraint []Constraint
+
+// add appends constraints to the union, skipping any with the same typed string
+// as an existing member.
+func (uc unionConstraint) add(cs ...Constraint) unionConstraint {
+	for _, c := range cs {
+		tcs := typedConstraintString(c)
+		dup := false
+		for _, m := range uc {
+			if typedConstraintString(m) == tcs {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			uc = append(uc, c)
+		}
+	}
+	return uc
+}
+
+func (uc unionConstraint) String() string {
+	strs := make([]string, len(uc))
+	for k, c := range uc {
+		strs[k] = c.String()
+	}
+	return strings.Join(strs, " || ")
+}
+
+func (uc unionConstraint) Matches(v Version) bool {
+	for _, c := range uc {
+		if c.Matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (uc unionConstraint) MatchesAny(c2 Constraint) bool {
+	for _, c := range uc {
+		if c.MatchesAny(c2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect distributes the intersection across the members of the union,
+// returning the union of the non-empty results.
+//
+// A versionTypeUnion represents a single revision, so intersecting with one
+// instead returns its first member that the union allows, as
+// versionTypeUnion.Intersect does.
+func (uc unionConstraint) Intersect(c2 Constraint) Constraint {
+	if vtu, ok := c2.(versionTypeUnion); ok {
+		for _, elem := range vtu {
+			if rc := uc.Intersect(elem); rc != none {
+				return rc
+			}
+		}
+		return none
+	}
+
+	rcs := make([]Constraint, 0, len(uc))
+	for _, c := range uc {
+		rcs = append(rcs, c.Intersect(c2))
+	}
+	return NewUnionConstraint(rcs...)
+}
+
+// NewExclusionConstraint creates a Constraint that allows any version allowed
+// by the provided constraint, except for the excluded versions - for example,
+// all of ^1.2.0 except 1.4.3, which is known to be broken.
+//
+// An excluded version rules out versions with the same type and name. A
+// Revision, or a PairedVersion, also rules out any version paired with that
+// revision. Excluded versions that the constraint could never allow anyway are
+// dropped.
+func NewExclusionConstraint(c Constraint, ex ...Version) Constraint {
+	if len(ex) == 0 {
+		return c
+	}
+
+	e := exclusionConstraint{}
+	for _, v := range ex {
+		if !e.excludes(v) {
+			e.ex = append(e.ex, v)
+		}
+	}
+	return e.apply(c)
+}
+
+// exclusionConstraint allows the versions allowed by its constraint, except
+// those matched by any of its excluded versions. The constraint is never a
+// union (exclusions are distributed across unions' members instead), another
+// exclusion, or a single Version.
+type exclusionConstraint struct {
+	c  Constraint
+	ex []Version
+}
+
+func (e exclusionConstraint) String() string {
+	strs := make([]string, len(e.ex))
+	for k, v := range e.ex {
+		strs[k] = v.String()
+	}
+	return fmt.Sprintf("%s except %s", e.c, strings.Join(strs, ", "))
+}
+
+// excludes indicates whether the provided version is ruled out by one of the
+// excluded versions.
+func (e exclusionConstraint) excludes(v Version) bool {
+	for _, xv := range e.ex {
+		if xv.Matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply restricts the provided constraint by the exclusions.
+func (e exclusionConstraint) apply(c Constraint) Constraint {
+	switch tc := c.(type) {
+	case noneConstraint:
+		return none
+	case versionTypeUnion:
+		// The members of a versionTypeUnion are interchangeable, so it remains
+		// allowed as long as any one of them isn't excluded.
+		for _, v := range tc {
+			if !e.excludes(v) {
+				return tc
+			}
+		}
+		return none
+	case Version:
+		if e.excludes(tc) {
+			return none
+		}
+		return tc
+	case unionConstraint:
+		rcs := make([]Constraint, len(tc))
+		for k, m := range tc {
+			rcs[k] = e.apply(m)
+		}
+		return NewUnionConstraint(rcs...)
+	case exclusionConstraint:
+		rc := exclusionConstraint{c: tc.c, ex: append([]Version(nil), tc.ex...)}
+		for _, v := range e.ex {
+			if !rc.excludes(v) {
+				rc.ex = append(rc.ex, v)
+			}
+		}
+		sort.Sort(typedVersionSort(rc.ex))
+		return rc
+	}
+
+	// Drop any exclusions that couldn't matter for the constraint. Revisions
+	// are always kept, as they may be paired with any allowed version.
+	rc := exclusionConstraint{c: c}
+	for _, v := range e.ex {
+		switch v.(type) {
+		case Revision, PairedVersion:
+			rc.ex = append(rc.ex, v)
+		default:
+			if c.Matches(v) {
+				rc.ex = append(rc.ex, v)
+			}
+		}
+	}
+
+	if len(rc.ex) == 0 {
+		return c
+	}
+	sort.Sort(typedVersionSort(rc.ex))
+	return rc
+}
+
+// typedVersionSort orders versions by their typed string, giving exclusions a
+// canonical form.
+type typedVersionSort []Version
+
+func (s typedVersionSort) Len() int      { return len(s) }
+func (s typedVersionSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s typedVersionSort) Less(i, j int) bool {
+	return typedVersionString(s[i]) < typedVersionString(s[j])
+}
+
+func (e exclusionConstraint) Matches(v Version) bool {
+	if vtu, ok := v.(versionTypeUnion); ok {
+		for _, elem := range vtu {
+			if e.Matches(elem) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return e.c.Matches(v) && !e.excludes(v)
+}
+
+func (e exclusionConstraint) MatchesAny(c2 Constraint) bool {
+	return e.Intersect(c2) != none
+}
+
+func (e exclusionConstraint) Intersect(c2 Constraint) Constraint {
+	if vtu, ok := c2.(versionTypeUnion); ok {
+		for _, elem := range vtu {
+			if rc := e.Intersect(elem); rc != none {
+				return rc
+			}
+		}
+		return none
+	}
+
+	return e.apply(e.c.Intersect(c2))
+}
+
 // A ProjectConstraint combines a ProjectIdentifier with a Constraint. It
 // indicates that, if packages contained in the ProjectIdentifier enter the
 // depgraph, they must do so at a version that is allowed by the Constraint.
@@ -69,8 +69,34 @@ var (
 var (
 	scpSyntaxRe = regexp.MustCompile(`^([a-zA-Z0-9_]+)@([a-zA-Z0-9._-]+):(.*)$`)
 	pathvld     = regexp.MustCompile(`^([A-Za-z0-9-]+)(\.[A-Za-z0-9-]+)+(/[A-Za-z0-9-_.~]+)*$`)
+	// Semantic import versioning puts major versions from v2 on in a /vN
+	// element directly after the repository root
+	majorSuffixRegex = regexp.MustCompile(`^/v([2-9]|[1-9][0-9]+)(?:/|$)`)
 )
 
+// majorVersionSuffix checks whether an import path continues the repository
+// root deduced for it with a /vN major version suffix, as github.com/foo/bar/v2
+// does github.com/foo/bar. If so, it returns the root with the suffix, which
+// names a distinct project made up of the repository's versions with major
+// version N, along with N.
+func majorVersionSuffix(root, path string) (string, uint64, bool) {
+	if !strings.HasPrefix(path, root) {
+		return "", 0, false
+	}
+
+	v := majorSuffixRegex.FindStringSubmatch(path[len(root):])
+	if v == nil {
+		return "", 0, false
+	}
+
+	major, err := strconv.ParseUint(v[1], 10, 64)
+	if err != nil {
+		// Only reachable if the number overflows
+		return "", 0, false
+	}
+	return root + "/v" + v[1], major, true
+}
+
 func pathDeducerTrie() *deducerTrie {
 	dxt := newDeducerTrie()
 
@@ -586,6 +612,13 @@ func (sm *SourceMgr) deduceFromPath(path string) (deductionFuture, error) {
 			return deductionFuture{}, err
 		}
 
+		// gopkg.in already puts the major version in the root, in its own way
+		if _, isgpin := mtch.(gopkginDeducer); !isgpin {
+			if mroot, major, has := majorVersionSuffix(root, path); has {
+				root, mb = mroot, maybeMajorSource{mb: mb, major: major}
+			}
+		}
+
 		return deductionFuture{
 			rslow: false,
 			root:  strfut(root),
@@ -600,6 +633,9 @@ func (sm *SourceMgr) deduceFromPath(path string) (deductionFuture, error) {
 		if err != nil {
 			return deductionFuture{}, err
 		}
+		if mroot, major, has := majorVersionSuffix(root, path); has {
+			root, mb = mroot, maybeMajorSource{mb: mb, major: major}
+		}
 
 		return deductionFuture{
 			rslow: false,
@@ -615,6 +651,7 @@ func (sm *SourceMgr) deduceFromPath(path string) (deductionFuture, error) {
 	// Declare these out here so they're available for the source future
 	var vcs string
 	var ru *url.URL
+	var major uint64
 
 	// Kick off the vanity metadata fetch
 	var importroot string
@@ -637,6 +674,10 @@ func (sm *SourceMgr) deduceFromPath(path string) (deductionFuture, error) {
 			importroot = ""
 			return
 		}
+
+		if mroot, mj, has := majorVersionSuffix(importroot, path); has {
+			importroot, major = mroot, mj
+		}
 	}()
 
 	// Set up the root func to catch the result
@@ -670,6 +711,9 @@ func (sm *SourceMgr) deduceFromPath(path string) (deductionFuture, error) {
 			case "hg":
 				m = maybeHgSource{url: ru}
 			}
+			if m != nil && major != 0 {
+				m = maybeMajorSource{mb: m, major: major}
+			}
 
 			if m != nil {
 				src, ident, err = m.try(cachedir, an)
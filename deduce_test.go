@@ -650,3 +650,60 @@ func TestIsStdLib(t *testing.T) {
 		}
 	}
 }
+
+func TestMajorVersionSuffix(t *testing.T) {
+	fix := []struct {
+		root, path string
+		mroot      string
+		major      uint64
+		has        bool
+	}{
+		{"github.com/foo/bar", "github.com/foo/bar/v2", "github.com/foo/bar/v2", 2, true},
+		{"github.com/foo/bar", "github.com/foo/bar/v2/baz", "github.com/foo/bar/v2", 2, true},
+		{"example.com/foo", "example.com/foo/v13/baz/qux", "example.com/foo/v13", 13, true},
+		{"github.com/foo/bar", "github.com/foo/bar", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/bar/baz/v2", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/bar/v1", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/bar/v0", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/bar/v02", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/bar/v2x", "", 0, false},
+		{"github.com/foo/bar", "github.com/foo/barv2", "", 0, false},
+		{"github.com/foo/bar", "github.com/baz/bar/v2", "", 0, false},
+	}
+
+	for _, f := range fix {
+		mroot, major, has := majorVersionSuffix(f.root, f.path)
+		if has != f.has || mroot != f.mroot || major != f.major {
+			t.Errorf("majorVersionSuffix(%q, %q) should be (%q, %v, %v), got (%q, %v, %v)", f.root, f.path, f.mroot, f.major, f.has, mroot, major, has)
+		}
+	}
+}
+
+func TestDeduceMajorVersionSuffix(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	fix := map[string]string{
+		"github.com/sdboyer/gps/v2":             "github.com/sdboyer/gps/v2",
+		"github.com/sdboyer/gps/v2/foo":         "github.com/sdboyer/gps/v2",
+		"bitbucket.org/sdboyer/reporoot/v3/foo": "bitbucket.org/sdboyer/reporoot/v3",
+		"example.com/foo/bar.git/v2/baz":        "example.com/foo/bar.git/v2",
+		"gopkg.in/sdboyer/gps.v2/foo":           "gopkg.in/sdboyer/gps.v2",
+		"github.com/sdboyer/gps/foo/v2":         "github.com/sdboyer/gps",
+	}
+
+	for in, want := range fix {
+		df, err := sm.deduceFromPath(in)
+		if err != nil {
+			t.Errorf("Unexpected err deducing %s: %s", in, err)
+			continue
+		}
+
+		root, err := df.root()
+		if err != nil {
+			t.Errorf("Unexpected err on root future for %s: %s", in, err)
+		} else if root != want {
+			t.Errorf("Deduced unexpected root for %s:\n\t(GOT) %s\n\t(WNT) %s", in, root, want)
+		}
+	}
+}
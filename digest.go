@@ -0,0 +1,137 @@
+package gps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// digestVersion is incremented whenever the algorithm used by DigestTree
+// changes in a way that would change the resulting digests. It's included in
+// the digest string, so that digests computed by different algorithms never
+// compare as equal.
+const digestVersion = 1
+
+// vcsDirs are the names of directories holding VCS metadata. They are skipped
+// when computing a digest, as their presence (and contents) depends on the
+// type of source a project came from, not what's in the project.
+var vcsDirs = map[string]bool{
+	".bzr": true,
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// DigestTree computes a deterministic digest of the contents of the tree
+// rooted at dir, such as a project exported by WriteDepTree.
+//
+// The digest covers the relative path, type, executable bit and contents of
+// every file and symlink in the tree, visited in sorted order. Directories
+// themselves (including empty ones), VCS metadata directories and the export
+// metadata file at the root of the tree are not included. As a result, the
+// digest depends only on the exported content: the same tree exported from a
+// git, hg or bzr source, or written out in a different order, produces the
+// same digest.
+//
+// The returned string is prefixed with a version number for the digest
+// algorithm, so digests produced by different versions of gps are never
+// mistaken for one another.
+func DigestTree(dir string) (string, error) {
+	return digestTree(dir, nil)
+}
+
+// digestTree computes the digest of the tree rooted at dir, as DigestTree
+// does, but leaves out everything beneath the provided slash-separated paths,
+// relative to dir. WriteDepTree and VerifyDepTree use it to exclude projects
+// nested inside another project's tree from that project's digest.
+func digestTree(dir string, skip []string) (string, error) {
+	skipm := make(map[string]bool, len(skip))
+	for _, rel := range skip {
+		skipm[filepath.Join(dir, filepath.FromSlash(rel))] = true
+	}
+
+	var paths []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if skipm[path] {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			if vcsDirs[fi.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path == filepath.Join(dir, ExportMetadataFile) {
+			return nil
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Walk visits in lexical order within each dir, but ensure a single total
+	// order across the whole tree, on slash-separated paths.
+	rels := make([]string, len(paths))
+	for k, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", err
+		}
+		rels[k] = filepath.ToSlash(rel)
+	}
+	sort.Strings(rels)
+
+	h := sha256.New()
+	for _, rel := range rels {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		fi, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "l %s\x00%s\x00", rel, filepath.ToSlash(target))
+		case fi.Mode().IsRegular():
+			mode := "f"
+			if fi.Mode()&0111 != 0 {
+				mode = "x"
+			}
+			fmt.Fprintf(h, "%s %s\x00%d\x00", mode, rel, fi.Size())
+
+			f, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return "", err
+			}
+		default:
+			// Devices, pipes, sockets, etc. have no business in a source tree.
+			return "", fmt.Errorf("cannot digest %s: unsupported file mode %s", path, fi.Mode())
+		}
+	}
+
+	return strconv.Itoa(digestVersion) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,107 @@
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mkDigestTree writes the provided files, in the order given, into a new temp
+// dir and returns the path to it.
+func mkDigestTree(t *testing.T, files [][2]string) string {
+	dir, err := ioutil.TempDir("", "digesttest")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f[0]))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f[1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDigestTree(t *testing.T) {
+	base := [][2]string{
+		{"a.go", "package a\n"},
+		{"sub/b.go", "package b\n"},
+		{"sub-c/c.go", "package c\n"},
+		{"LICENSE", "license\n"},
+	}
+
+	reversed := make([][2]string, len(base))
+	for k, f := range base {
+		reversed[len(base)-1-k] = f
+	}
+
+	dir1 := mkDigestTree(t, base)
+	defer os.RemoveAll(dir1)
+	d1, err := DigestTree(dir1)
+	if err != nil {
+		t.Fatalf("Unexpected error digesting tree: %s", err)
+	}
+	if !strings.HasPrefix(d1, "1:") {
+		t.Errorf("Expected digest to carry the algorithm version, got %s", d1)
+	}
+
+	// Same content, written in a different order and alongside VCS metadata,
+	// an empty dir and an export metadata file, should digest the same.
+	noise := append(reversed, [][2]string{
+		{".git/HEAD", "ref: refs/heads/master\n"},
+		{"sub/.hg/store", "stuff\n"},
+		{".bzr/branch-format", "bzr\n"},
+		{ExportMetadataFile, "{}\n"},
+	}...)
+	dir2 := mkDigestTree(t, noise)
+	defer os.RemoveAll(dir2)
+	os.Mkdir(filepath.Join(dir2, "empty"), 0777)
+
+	d2, err := DigestTree(dir2)
+	if err != nil {
+		t.Fatalf("Unexpected error digesting tree: %s", err)
+	}
+	if d1 != d2 {
+		t.Errorf("Expected equivalent trees to have the same digest:\n\t%s\n\t%s", d1, d2)
+	}
+
+	// Any change to paths, contents or modes should change the digest
+	changes := map[string]func(dir string) error{
+		"modified content": func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package a // changed\n"), 0644)
+		},
+		"added file": func(dir string) error {
+			return ioutil.WriteFile(filepath.Join(dir, "sub", "d.go"), []byte("package b\n"), 0644)
+		},
+		"removed file": func(dir string) error {
+			return os.Remove(filepath.Join(dir, "LICENSE"))
+		},
+		"renamed file": func(dir string) error {
+			return os.Rename(filepath.Join(dir, "sub", "b.go"), filepath.Join(dir, "sub", "bb.go"))
+		},
+		"exec bit": func(dir string) error {
+			return os.Chmod(filepath.Join(dir, "a.go"), 0755)
+		},
+	}
+
+	for name, change := range changes {
+		dir := mkDigestTree(t, base)
+		if err := change(dir); err != nil {
+			t.Fatalf("%s: failed to change tree: %s", name, err)
+		}
+
+		d, err := DigestTree(dir)
+		if err != nil {
+			t.Errorf("%s: unexpected error digesting tree: %s", name, err)
+		} else if d == d1 {
+			t.Errorf("%s: expected digest to change", name)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -7,15 +7,24 @@ import (
 	"sort"
 	"strings"
 	"strconv"
+	"time"
 )
 
 // string headers used to demarcate sections in hash input creation
 const (
-	hhConstraints = "-CONSTRAINTS-"
-	hhImportsReqs = "-IMPORTS/REQS-"
-	hhIgnores     = "-IGNORES-"
-	hhOverrides   = "-OVERRIDES-"
-	hhAnalyzer    = "-ANALYZER-"
+	hhConstraints    = "-CONSTRAINTS-"
+	hhImportsReqs    = "-IMPORTS/REQS-"
+	hhIgnores        = "-IGNORES-"
+	hhOverrides      = "-OVERRIDES-"
+	hhBuildTarget    = "-BUILDTARGET-"
+	hhImportComments = "-IMPORTCOMMENTS-"
+	hhTools          = "-TOOLS-"
+	hhCgo            = "-CGO-"
+	hhDenied         = "-DENIED-"
+	hhPrereleases    = "-PRERELEASES-"
+	hhCutoff         = "-CUTOFF-"
+	hhSchemes        = "-SCHEMES-"
+	hhAnalyzer       = "-ANALYZER-"
 )
 
 // HashInputs computes a hash digest of all data in SolveParams and the
@@ -64,8 +73,10 @@ func (s *solver) writeHashingInputs(w io.Writer) {
 	}
 
 	// Write out each discrete import, including those derived from requires.
+	// Required package patterns can't be expanded until solving, so they are
+	// written as-is.
 	writeString(hhImportsReqs)
-	imports := s.rd.externalImportList()
+	imports := append(s.rd.externalImportList(), pkgPatterns(s.rd.req)...)
 	sort.Strings(imports)
 	for _, im := range imports {
 		writeString(im)
@@ -73,11 +84,13 @@ func (s *solver) writeHashingInputs(w io.Writer) {
 
 	// Add ignores, skipping any that point under the current project root;
 	// those will have already been implicitly incorporated by the import
-	// lister.
+	// lister. Patterns are skipped only if everything they could match is
+	// under the root.
 	writeString(hhIgnores)
 	ig := make([]string, 0, len(s.rd.ig))
 	for pkg := range s.rd.ig {
-		if !strings.HasPrefix(pkg, s.rd.rpt.ImportRoot) || !isPathPrefixOrEqual(s.rd.rpt.ImportRoot, pkg) {
+		pre := patternPrefix(pkg)
+		if !strings.HasPrefix(pre, s.rd.rpt.ImportRoot) || !isPathPrefixOrEqual(s.rd.rpt.ImportRoot, pre) {
 			ig = append(ig, pkg)
 		}
 	}
@@ -101,6 +114,128 @@ func (s *solver) writeHashingInputs(w io.Writer) {
 		}
 	}
 
+	// The build target is only written if one was provided, so that hashes
+	// for solves without a target are unaffected by its existence.
+	if s.rd.bt != nil {
+		writeString(hhBuildTarget)
+		plats := make([]string, 0, len(s.rd.bt.Platforms))
+		for _, p := range s.rd.bt.Platforms {
+			plats = append(plats, p.String())
+		}
+		for _, p := range uniq(plats) {
+			writeString(p)
+		}
+		tags := make([]string, len(s.rd.bt.Tags))
+		copy(tags, s.rd.bt.Tags)
+		for _, t := range uniq(tags) {
+			writeString("tag:" + t)
+		}
+	}
+
+	// Warning about and ignoring import comment mismatches produce the same
+	// solutions, so only whether or not they're enforced matters.
+	if s.rd.icp == ImportCommentsEnforce {
+		writeString(hhImportComments)
+		writeString("enforced")
+	}
+
+	// Disabling cgo can only remove versions from consideration, so it's only
+	// written when set.
+	if s.rd.nocgo {
+		writeString(hhCgo)
+		writeString("disabled")
+	}
+
+	// Tool packages are already among the imports, but the properties declared
+	// for them are not.
+	if len(s.rd.tools) > 0 {
+		writeString(hhTools)
+		tools := make([]string, 0, len(s.rd.tools))
+		for tool := range s.rd.tools {
+			tools = append(tools, tool)
+		}
+		sort.Strings(tools)
+
+		for _, tool := range tools {
+			pp := s.rd.tools[tool]
+			writeString(tool)
+			if pp.Source != "" {
+				writeString(pp.Source)
+			}
+			if pp.Constraint != nil {
+				writeString(typedConstraintString(pp.Constraint))
+			}
+		}
+	}
+
+	// Versions denied by the root, like other retractions, only remove
+	// versions from consideration, so the section is only written when some
+	// are denied.
+	if len(s.rd.deny) > 0 {
+		writeString(hhDenied)
+		prs := make([]string, 0, len(s.rd.deny))
+		for pr := range s.rd.deny {
+			prs = append(prs, string(pr))
+		}
+		sort.Strings(prs)
+
+		for _, pr := range prs {
+			writeString(pr)
+			vs := make([]string, 0, len(s.rd.deny[ProjectRoot(pr)]))
+			for _, v := range s.rd.deny[ProjectRoot(pr)] {
+				vs = append(vs, typedVersionString(v))
+			}
+			sort.Strings(vs)
+			for _, v := range uniq(vs) {
+				writeString(v)
+			}
+		}
+	}
+
+	// Pre-release policies are only written if any differ from the default.
+	if s.rd.pre != PrereleasesAllowed || len(s.rd.prep) > 0 {
+		writeString(hhPrereleases)
+		writeString(s.rd.pre.String())
+
+		prs := make([]string, 0, len(s.rd.prep))
+		for pr := range s.rd.prep {
+			prs = append(prs, string(pr))
+		}
+		sort.Strings(prs)
+		for _, pr := range prs {
+			writeString(pr)
+			writeString(s.rd.prep[ProjectRoot(pr)].String())
+		}
+	}
+
+	// The requested cutoff and cool-down are hashed, rather than the effective
+	// cutoff, as the latter changes with the time at which the solve is run.
+	if !s.rd.cutoff.IsZero() || s.rd.cooldown != 0 {
+		writeString(hhCutoff)
+		if !s.rd.cutoff.IsZero() {
+			writeString(s.rd.cutoff.UTC().Format(time.RFC3339Nano))
+		}
+		if s.rd.cooldown != 0 {
+			writeString(s.rd.cooldown.String())
+		}
+	}
+
+	// Only the schemes declared by the root are hashed; like retractions,
+	// those declared by dependencies are outside the root's control.
+	if len(s.rd.schemes) > 0 {
+		writeString(hhSchemes)
+
+		prs := make([]string, 0, len(s.rd.schemes))
+		for pr := range s.rd.schemes {
+			prs = append(prs, string(pr))
+		}
+		sort.Strings(prs)
+		for _, pr := range prs {
+			writeString(pr)
+			writeString(s.rd.schemes[ProjectRoot(pr)].Name())
+		}
+	}
+
 	writeString(hhAnalyzer)
 	an, av := s.b.AnalyzerInfo()
 	writeString(an)
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 	"text/tabwriter"
+	"time"
 )
 
 func TestHashInputs(t *testing.T) {
@@ -187,6 +188,56 @@ func TestHashInputsReqsIgs(t *testing.T) {
 	if !bytes.Equal(dig, correct) {
 		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
 	}
+
+	// Patterns are written as-is, except ignore patterns that can only match
+	// packages within the root
+	rm.ig = map[string]bool{
+		"root/*":     true,
+		"*/testutil": true,
+		"bar/...":    true,
+	}
+	rm.req = map[string]bool{
+		"baz":     true,
+		"qux/...": true,
+	}
+	params.Manifest = rm
+
+	s, err = Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig = s.HashInputs()
+	h = sha256.New()
+
+	elems = []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		"baz",
+		"qux/...",
+		hhIgnores,
+		"*/testutil",
+		"bar/...",
+		hhOverrides,
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct = h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
 }
 
 func TestHashInputsOverrides(t *testing.T) {
@@ -585,3 +636,396 @@ func diffHashingInputs(s Solver, wnt []string) string {
 	tw.Flush()
 	return buf.String()
 }
+
+func TestHashInputsImportComments(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	rm := fix.rootmanifest().(simpleRootManifest).dup()
+	rm.icp = ImportCommentsEnforce
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        rm,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhImportComments,
+		"enforced",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+
+	// Warning about import comments yields the same solutions as ignoring
+	// them, which is the default, so neither is written
+	elems = append(elems[:10:10], elems[12:]...)
+	h = sha256.New()
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct = h.Sum(nil)
+
+	rm.icp = ImportCommentsWarn
+	params.Manifest = rm
+
+	s, err = Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	if !bytes.Equal(s.HashInputs(), correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
+func TestHashInputsTools(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	rm := fix.rootmanifest().(simpleRootManifest).dup()
+	rm.tools = map[string]ProjectProperties{
+		"gen/cmd/gen": {
+			Constraint: NewVersion("1.0.0"),
+		},
+		"lint/cmd/lint": {
+			Source: "otherlint",
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        rm,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		"gen/cmd/gen",
+		"lint/cmd/lint",
+		hhIgnores,
+		hhOverrides,
+		hhTools,
+		"gen/cmd/gen",
+		"sv-1.0.0",
+		"lint/cmd/lint",
+		"otherlint",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
+func TestHashInputsCgoDisabled(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		CgoDisabled:     true,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhCgo,
+		"disabled",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
+func TestHashInputsDeniedVersions(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	rm := fix.rootmanifest().(simpleRootManifest).dup()
+	rm.deny = map[ProjectRoot][]Version{
+		"b": {NewVersion("1.0.1"), NewBranch("master"), NewVersion("1.0.1")},
+		"a": {Revision("badrev")},
+		"c": nil,
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        rm,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhDenied,
+		"a",
+		"r-badrev",
+		"b",
+		"b-master",
+		"sv-1.0.1",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
+func TestHashInputsPrereleasePolicies(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	rm := fix.rootmanifest().(simpleRootManifest).dup()
+	rm.pre = map[ProjectRoot]PrereleasePolicy{
+		"b": PrereleasesAllowed,
+		"a": PrereleasesIfNamed,
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        rm,
+		Prereleases:     PrereleasesNever,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhPrereleases,
+		"never",
+		"a",
+		"if-named",
+		"b",
+		"allowed",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
+
+func TestHashInputsCutoff(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Cutoff:          time.Date(2016, 7, 1, 12, 0, 0, 0, time.FixedZone("EDT", -4*60*60)),
+		Cooldown:        7 * 24 * time.Hour,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhCutoff,
+		"2016-07-01T16:00:00Z",
+		"168h0m0s",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+
+	// The hash must not depend on when the solve is run
+	s2, _ := Prepare(params, newdepspecSM(fix.ds, nil))
+	if !bytes.Equal(dig, s2.HashInputs()) {
+		t.Errorf("Hash inputs with a cool-down period should be stable across runs")
+	}
+}
+
+func TestHashInputsVersionSchemes(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+
+	rm := fix.rootmanifest().(simpleRootManifest).dup()
+	rm.schemes = map[ProjectRoot]VersionScheme{
+		"b": ReleaseNumbers,
+		"a": CalVer,
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        rm,
+	}
+
+	s, err := Prepare(params, newdepspecSM(fix.ds, nil))
+	if err != nil {
+		t.Errorf("Unexpected error while prepping solver: %s", err)
+		t.FailNow()
+	}
+
+	dig := s.HashInputs()
+	h := sha256.New()
+
+	elems := []string{
+		hhConstraints,
+		"a",
+		"sv-1.0.0",
+		"b",
+		"sv-1.0.0",
+		hhImportsReqs,
+		"a",
+		"b",
+		hhIgnores,
+		hhOverrides,
+		hhSchemes,
+		"a",
+		"calver",
+		"b",
+		"release",
+		hhAnalyzer,
+		"depspec-sm-builtin",
+		"1",
+	}
+	for _, v := range elems {
+		h.Write([]byte(v))
+	}
+	correct := h.Sum(nil)
+
+	if !bytes.Equal(dig, correct) {
+		t.Errorf("Hashes are not equal. Inputs:\n%s", diffHashingInputs(s, elems))
+	}
+}
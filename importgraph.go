@@ -0,0 +1,242 @@
+package gps
+
+import (
+	"sort"
+	"strings"
+)
+
+// An ImportGraph is a package-level import graph spanning a root project and
+// all of the projects in a Lock, such as a Solution. It is used to answer
+// "why" questions: why is a given project, or a given package, present in the
+// dependency tree?
+//
+// Create one with NewImportGraph.
+type ImportGraph struct {
+	// The root project's import path. Import chains begin at any package
+	// belonging to it.
+	root ProjectRoot
+
+	// Map of each package to the project it belongs to.
+	owner map[string]ProjectRoot
+
+	// Reverse edges: a map of each package to the packages that import it.
+	importers map[string][]string
+}
+
+// NewImportGraph builds an ImportGraph from the root project's PackageTree,
+// and the PackageTrees of each of the projects in the provided Lock, as
+// retrieved from the SourceManager. The SolveParameters should be the same
+// ones that were used to produce the Lock.
+//
+// Edges in the graph are those the solver itself follows. All package trees
+// are adapted to the parameters' BuildTarget and CgoDisabled settings, and
+// only the packages and imports that remain in their reach maps (see
+// PackageTree.ToReachMap) are included. For the root, that means main packages
+// and test imports are included; for dependencies, only the packages the Lock
+// lists for each project, excluding main packages and tests. Packages ignored
+// by the root manifest are excluded, along with anything reachable only
+// through them.
+func NewImportGraph(params SolveParameters, l Lock, sm SourceManager) (*ImportGraph, error) {
+	rpt := params.RootPackageTree
+	rd := rootdata{
+		nocgo: params.CgoDisabled,
+	}
+	if params.Manifest != nil {
+		rd.ig = params.Manifest.IgnoredPackages()
+	}
+	if params.BuildTarget != nil {
+		bt := *params.BuildTarget
+		rd.bt = &bt
+	}
+
+	g := &ImportGraph{
+		root:      ProjectRoot(rpt.ImportRoot),
+		owner:     make(map[string]ProjectRoot),
+		importers: make(map[string][]string),
+	}
+
+	// Collect the direct imports of every package in the graph first, as
+	// edges can only be drawn once all the packages are known.
+	imports := make(map[string][]string)
+	// The external imports each package may reach, per its reach map.
+	reach := make(map[string]map[string]bool)
+	add := func(pr ProjectRoot, pkg string, p Package, ie struct{ Internal, External []string }, tests bool) {
+		g.owner[pkg] = pr
+		imports[pkg] = p.Imports
+		if tests {
+			imports[pkg] = dedupeStrings(p.Imports, p.TestImports)
+		}
+		reach[pkg] = make(map[string]bool, len(ie.External))
+		for _, ex := range ie.External {
+			reach[pkg][ex] = true
+		}
+	}
+
+	// The reach maps already exclude ignored and erroneous packages (and, for
+	// dependencies, anything that imports them), so they determine which
+	// packages participate.
+	rpt = rd.adaptTree(rpt)
+	rm, _ := rpt.ToReachMap(true, true, false, rd.ig)
+	for pkg, ie := range rm {
+		add(g.root, pkg, rpt.Packages[pkg].P, ie, true)
+	}
+
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		ptree, err := sm.ListPackages(lp.Ident(), lp.Version())
+		if err != nil {
+			return nil, err
+		}
+		ptree = rd.adaptTree(ptree)
+		prm, _ := ptree.ToReachMap(false, false, true, rd.ig)
+
+		for _, rel := range lp.Packages() {
+			pkg := string(pr)
+			if rel != "." {
+				pkg = pkg + "/" + rel
+			}
+
+			if ie, has := prm[pkg]; has {
+				add(pr, pkg, ptree.Packages[pkg].P, ie, false)
+			}
+		}
+	}
+
+	// Draw an edge for each import of a package in the graph, so long as it's
+	// an import of another package from the same project, or one that the
+	// importer's reach map says it reaches.
+	for pkg, imps := range imports {
+		for _, imp := range imps {
+			owner, has := g.owner[imp]
+			if !has || imp == pkg {
+				continue
+			}
+			if owner == g.owner[pkg] || reach[pkg][imp] {
+				g.importers[imp] = append(g.importers[imp], pkg)
+			}
+		}
+	}
+	for imp := range g.importers {
+		sort.Strings(g.importers[imp])
+	}
+
+	return g, nil
+}
+
+// MaxImportChains is the maximum number of import chains returned by
+// ImportGraph's WhyPackage and WhyProject. The number of distinct chains can
+// grow exponentially with the size of the graph, so beyond this many, the rest
+// are left out.
+const MaxImportChains = 1000
+
+// WhyPackage returns every import chain through which the root project's
+// packages import the named package, directly or transitively. Each chain
+// begins with a root package and ends with the named package, and no package
+// appears in a chain more than once. A chain may begin with any root package,
+// including one that is itself imported by another root package, so a chain
+// from one root package may be the tail of a longer chain from another.
+//
+// Chains are sorted. At most MaxImportChains are returned; if there are more,
+// an arbitrary (but stable) selection of them is returned.
+//
+// If the package is not in the graph, or is not reachable from the root, nil
+// is returned.
+func (g *ImportGraph) WhyPackage(pkg string) [][]string {
+	if _, has := g.owner[pkg]; !has {
+		return nil
+	}
+
+	return g.chainsTo([]string{pkg}, func(string) bool { return true })
+}
+
+// WhyProject returns every import chain through which the root project's
+// packages reach the named project. Each chain begins with a root package, as
+// for WhyPackage, and ends with the first package from the named project that
+// it reaches.
+//
+// Chains are sorted, and are limited to MaxImportChains in the same way as for
+// WhyPackage.
+//
+// If the project is not in the graph, or is not reachable from the root, nil
+// is returned.
+func (g *ImportGraph) WhyProject(pr ProjectRoot) [][]string {
+	var pkgs []string
+	for pkg, owner := range g.owner {
+		if owner == pr {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+
+	// Chains end at the first package in the project, so don't walk back
+	// through importers that are themselves in it.
+	return g.chainsTo(pkgs, func(pkg string) bool {
+		return g.owner[pkg] != pr
+	})
+}
+
+// chainsTo walks backwards along import edges from each of the provided target
+// packages, collecting every chain that reaches one of them from a root
+// package, up to MaxImportChains. Only importers for which the follow func
+// returns true are walked through, and no package is visited twice in the same
+// chain, so import cycles (as through test imports) are cut.
+func (g *ImportGraph) chainsTo(targets []string, follow func(string) bool) [][]string {
+	var chains [][]string
+	// path is the chain currently being walked, in reverse.
+	var path []string
+	onPath := make(map[string]bool)
+
+	var walk func(pkg string)
+	walk = func(pkg string) {
+		path = append(path, pkg)
+		onPath[pkg] = true
+
+		if g.owner[pkg] == g.root {
+			chain := make([]string, len(path))
+			for k, p := range path {
+				chain[len(path)-1-k] = p
+			}
+			chains = append(chains, chain)
+		}
+
+		for _, imp := range g.importers[pkg] {
+			if len(chains) >= MaxImportChains {
+				break
+			}
+			if !onPath[imp] && follow(imp) {
+				walk(imp)
+			}
+		}
+
+		delete(onPath, pkg)
+		path = path[:len(path)-1]
+	}
+
+	for _, pkg := range targets {
+		if len(chains) >= MaxImportChains {
+			break
+		}
+		walk(pkg)
+	}
+
+	if len(chains) == 0 {
+		return nil
+	}
+	return sortChains(chains)
+}
+
+// sortChains sorts a list of import chains, so that results are stable.
+func sortChains(chains [][]string) [][]string {
+	keys := make([]string, len(chains))
+	byKey := make(map[string][]string, len(chains))
+	for k, chain := range chains {
+		keys[k] = strings.Join(chain, "\x00")
+		byKey[keys[k]] = chain
+	}
+
+	sort.Strings(keys)
+	for k, key := range keys {
+		chains[k] = byKey[key]
+	}
+	return chains
+}
@@ -0,0 +1,222 @@
+package gps
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestImportGraphWhy(t *testing.T) {
+	fix := bimodalFixture{
+		n: "import graph",
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "root/foo", "a"),
+				pkg("root/foo", "b"),
+				pkg("root/ignored", "d"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "c"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b", "c/x"),
+			),
+			dsp(mkDepspec("c 1.0.0"),
+				pkg("c"),
+				pkg("c/x", "c", "c/cgo"),
+				cgopkg("c/cgo"),
+			),
+			dsp(mkDepspec("d 1.0.0"),
+				pkg("d"),
+			),
+		},
+		ignore: []string{"root/ignored"},
+	}
+
+	sm := newbmSM(fix)
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+	}
+
+	soln, err := fixSolve(params, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error while solving: %s", err)
+	}
+
+	g, err := NewImportGraph(params, soln, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error creating ImportGraph: %s", err)
+	}
+
+	// Chains begin at every root package, including root/foo, which is also
+	// imported by root, and end at the first package reached in c
+	got := g.WhyProject("c")
+	want := [][]string{
+		{"root", "a", "c"},
+		{"root", "root/foo", "b", "c/x"},
+		{"root/foo", "b", "c/x"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for project c:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got = g.WhyPackage("c")
+	want = [][]string{
+		{"root", "a", "c"},
+		{"root", "root/foo", "b", "c/x", "c"},
+		{"root/foo", "b", "c/x", "c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for package c:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got = g.WhyPackage("c/cgo")
+	want = [][]string{
+		{"root", "root/foo", "b", "c/x", "c/cgo"},
+		{"root/foo", "b", "c/x", "c/cgo"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for package c/cgo:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got = g.WhyPackage("b")
+	want = [][]string{
+		{"root", "root/foo", "b"},
+		{"root/foo", "b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for package b:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// d is only reached through an ignored package, so isn't in the solution
+	// or the graph at all
+	if got = g.WhyProject("d"); got != nil {
+		t.Errorf("Expected no chains for ignored project d, got %v", got)
+	}
+	if got = g.WhyPackage("nonexistent"); got != nil {
+		t.Errorf("Expected no chains for nonexistent package, got %v", got)
+	}
+
+	// With cgo disabled, c/cgo can't be built, so c/x - which imports it -
+	// drops out of the graph, as the solver would drop it
+	params.CgoDisabled = true
+	g, err = NewImportGraph(params, soln, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error creating ImportGraph: %s", err)
+	}
+	if got = g.WhyPackage("c/x"); got != nil {
+		t.Errorf("Expected no chains for package c/x with cgo disabled, got %v", got)
+	}
+	got = g.WhyProject("c")
+	want = [][]string{
+		{"root", "a", "c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for project c with cgo disabled:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestImportGraphTestImportCycle(t *testing.T) {
+	fix := bimodalFixture{
+		n: "import graph test import cycle",
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+				pkg("root/util", "root"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a"),
+			),
+		},
+	}
+
+	sm := newbmSM(fix)
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+	}
+
+	soln, err := fixSolve(params, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error while solving: %s", err)
+	}
+
+	// root's tests import root/util, which imports root: a legal cycle, as
+	// the test imports aren't part of root itself
+	poe := params.RootPackageTree.Packages["root"]
+	poe.P.TestImports = []string{"root/util"}
+	params.RootPackageTree.Packages["root"] = poe
+
+	g, err := NewImportGraph(params, soln, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error creating ImportGraph: %s", err)
+	}
+
+	got := g.WhyProject("a")
+	want := [][]string{
+		{"root", "a"},
+		{"root/util", "root", "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for project a:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got = g.WhyPackage("root/util")
+	want = [][]string{
+		{"root", "root/util"},
+		{"root/util"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong chains for package root/util:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestImportGraphDiamonds(t *testing.T) {
+	// A long ladder of diamonds has exponentially many paths through it, so
+	// only MaxImportChains of them are returned.
+	const n = 30
+	ptree := PackageTree{
+		ImportRoot: "root",
+		Packages:   make(map[string]PackageOrErr),
+	}
+	addPkg := func(path string, imports ...string) {
+		ptree.Packages[path] = PackageOrErr{
+			P: Package{ImportPath: path, Name: "p", Imports: imports},
+		}
+	}
+
+	addPkg("root", "root/l0", "root/r0")
+	for i := 0; i < n; i++ {
+		next := fmt.Sprintf("root/j%d", i)
+		addPkg(fmt.Sprintf("root/l%d", i), next)
+		addPkg(fmt.Sprintf("root/r%d", i), next)
+		if i < n-1 {
+			addPkg(next, fmt.Sprintf("root/l%d", i+1), fmt.Sprintf("root/r%d", i+1))
+		} else {
+			addPkg(next)
+		}
+	}
+
+	params := SolveParameters{
+		RootPackageTree: ptree,
+		Manifest:        simpleRootManifest{},
+	}
+	g, err := NewImportGraph(params, SimpleLock{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating ImportGraph: %s", err)
+	}
+
+	target := fmt.Sprintf("root/j%d", n-1)
+	got := g.WhyPackage(target)
+	if len(got) != MaxImportChains {
+		t.Fatalf("Expected %v chains, got %v", MaxImportChains, len(got))
+	}
+	for _, chain := range got {
+		if chain[len(chain)-1] != target {
+			t.Errorf("Expected chain to end with %s, got %v", target, chain)
+		}
+	}
+}
@@ -65,10 +65,11 @@ func LocksAreEq(l1, l2 Lock, checkHash bool) bool {
 // URI for accessing it, the path at which it should be placed within a vendor
 // directory, and the packages that are used in it.
 type LockedProject struct {
-	pi   ProjectIdentifier
-	v    UnpairedVersion
-	r    Revision
-	pkgs []string
+	pi     ProjectIdentifier
+	v      UnpairedVersion
+	r      Revision
+	pkgs   []string
+	digest string
 }
 
 // SimpleLock is a helper for tools to easily describe lock data when they know
@@ -147,7 +148,26 @@ func (lp LockedProject) Version() Version {
 	return lp.v.Is(lp.r)
 }
 
+// WithDigest returns a copy of the LockedProject with the provided content
+// digest attached. Digests are computed by DigestTree, and are typically taken
+// from the ExportMetadata written by WriteDepTree.
+func (lp LockedProject) WithDigest(digest string) LockedProject {
+	lp.digest = digest
+	return lp
+}
+
+// Digest returns the digest of the project's exported content, as computed by
+// DigestTree, if one has been recorded. VerifyDepTree uses it to check that a
+// project's exported tree has not been modified.
+func (lp LockedProject) Digest() string {
+	return lp.digest
+}
+
 // Eq checks if two LockedProject instances are equal.
+//
+// Digests are only compared if both LockedProjects have one; solutions
+// produced by the solver never carry digests, and should still compare as
+// equal to a lock that has them recorded.
 func (lp LockedProject) Eq(lp2 LockedProject) bool {
 	if lp.pi != lp2.pi {
 		return false
@@ -157,6 +177,10 @@ func (lp LockedProject) Eq(lp2 LockedProject) bool {
 		return false
 	}
 
+	if lp.digest != "" && lp2.digest != "" && lp.digest != lp2.digest {
+		return false
+	}
+
 	if len(lp.pkgs) != len(lp2.pkgs) {
 		return false
 	}
@@ -35,6 +35,8 @@ func TestLockedProjectsEq(t *testing.T) {
 		NewLockedProject(mkPI("github.com/sdboyer/gps"), NewVersion("v0.10.0").Is("278a227dfc3d595a33a77ff3f841fd8ca1bc8cd0"), []string{"gps"}),
 		NewLockedProject(mkPI("github.com/sdboyer/gps"), NewVersion("v0.11.0"), []string{"gps"}),
 		NewLockedProject(mkPI("github.com/sdboyer/gps"), Revision("278a227dfc3d595a33a77ff3f841fd8ca1bc8cd0"), []string{"gps"}),
+		NewLockedProject(mkPI("github.com/sdboyer/gps"), NewVersion("v0.10.0"), []string{"gps"}).WithDigest("1:abc"),
+		NewLockedProject(mkPI("github.com/sdboyer/gps"), NewVersion("v0.10.0"), []string{"gps"}).WithDigest("1:def"),
 	}
 
 	fix := map[string]struct {
@@ -52,6 +54,9 @@ func TestLockedProjectsEq(t *testing.T) {
 		"with different lp":       {0, 3, false, "should not eq totally different lp"},
 		"with only rev":           {7, 7, true, "should eq with only rev"},
 		"when only rev matches":   {5, 7, false, "should not eq when only rev matches"},
+		"with one digest":         {0, 8, true, "should eq when only one has a digest"},
+		"with same digest":        {8, 8, true, "should eq with same digest"},
+		"with different digests":  {8, 9, false, "should not eq with different digests"},
 	}
 
 	for k, f := range fix {
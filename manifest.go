@@ -44,8 +44,12 @@ type RootManifest interface {
 	// a package means that both it and its (unique) imports will be disregarded
 	// by all relevant solver operations.
 	//
+	// Package patterns, such as "github.com/foo/bar/..." or "*/testutil", may
+	// be given in place of import paths, in which case all matching packages
+	// are ignored.
+	//
 	// It is an error to include a package in both the ignored and required
-	// sets.
+	// sets, including by requiring a package matched by an ignored pattern.
 	IgnoredPackages() map[string]bool
 
 	// RequiredPackages returns a set of import paths to require. These packages
@@ -56,20 +60,156 @@ type RootManifest interface {
 	// PackageTree of the ProjectRoot (though not an error, because the
 	// RootManifest itself does not report a ProjectRoot).
 	//
+	// Package patterns may also be given. A pattern requires every matching,
+	// non-ignored package from the projects that are otherwise selected in a
+	// solution; it does not pull in a project on its own.
+	//
 	// It is an error to include a package in both the ignored and required
 	// sets.
 	RequiredPackages() map[string]bool
 }
 
+// ImportCommentPolicy determines how the solver treats dependency packages
+// whose import comments (Package.CommentPath) disagree with the path under
+// which they are being imported.
+type ImportCommentPolicy uint8
+
+const (
+	// ImportCommentsIgnore disregards import comments entirely. This is the
+	// default.
+	ImportCommentsIgnore ImportCommentPolicy = iota
+
+	// ImportCommentsWarn permits mismatched import comments, but reports each
+	// one in the Solution's Warnings() (see WarningSolution).
+	ImportCommentsWarn
+
+	// ImportCommentsEnforce causes the solver to reject any version of a
+	// project in which a required package's import comment disagrees with its
+	// import path.
+	ImportCommentsEnforce
+)
+
+// ImportCommentManifest is an optional extension to RootManifest. If the
+// RootManifest passed in SolveParameters implements it, the returned policy
+// governs the solver's handling of import comments; otherwise,
+// ImportCommentsIgnore is used.
+type ImportCommentManifest interface {
+	RootManifest
+
+	// ImportCommentPolicy reports how import comment mismatches in
+	// dependencies should be handled.
+	ImportCommentPolicy() ImportCommentPolicy
+}
+
+// ToolManifest is an optional extension to RootManifest for declaring tool
+// dependencies: main packages, such as code generators, that the root project
+// uses during development but does not import.
+//
+// Tools are solved alongside the root's other dependencies, as though they were
+// required packages, with their own version constraints. Once the solution has
+// been written out with WriteDepTree, InstallTools can build their binaries into
+// a project-local directory, so that (for example) go generate uses the same
+// versions of the tools that were solved for.
+type ToolManifest interface {
+	RootManifest
+
+	// ToolDependencies returns a map of the import paths of tool main packages
+	// to the properties to use for the projects that contain them.
+	//
+	// A tool's Constraint is combined with any constraint the root places on
+	// the same project; the solve fails if they are disjoint. Overrides still
+	// take precedence over both.
+	ToolDependencies() map[string]ProjectProperties
+}
+
+// PrereleaseManifest is an optional extension to RootManifest, through which
+// the root project can choose pre-release policies for individual projects.
+// Projects without an entry use the policy from SolveParameters.Prereleases.
+type PrereleaseManifest interface {
+	RootManifest
+
+	// PrereleasePolicies returns a map of project roots to the pre-release
+	// policy to apply to each.
+	PrereleasePolicies() map[ProjectRoot]PrereleasePolicy
+}
+
+// RetractionManifest is an optional extension to Manifest, through which a
+// project can declare that some of its own versions have been retracted - for
+// example, because they were tagged by mistake, or are known to be broken.
+//
+// Retractions are read from the manifest at the project's newest version (the
+// first version in SortForUpgrade order), so that a fix release can retract
+// the releases that preceded it. The solver will not select a retracted version
+// unless it is the version in the root lock, in which case the Solution reports
+// a *RetractedVersionError among its Warnings() (see WarningSolution).
+//
+// Reading retractions costs the solver one extra GetManifestAndLock call, at
+// the newest version, for each project it considers - including those whose
+// newest version it never selects. That manifest is read once per project per
+// solve, and shared with SchemeManifest.
+type RetractionManifest interface {
+	Manifest
+
+	// RetractedVersions returns the versions of the manifest's own project
+	// that have been retracted. Retracting a Revision retracts every version
+	// paired with it.
+	RetractedVersions() []Version
+}
+
+// DenyListManifest is an optional extension to RootManifest, through which the
+// root project can retract versions of its dependencies itself. Denied versions
+// are treated exactly as though the dependencies had retracted them via
+// RetractionManifest.
+type DenyListManifest interface {
+	RootManifest
+
+	// DeniedVersions returns a map of project roots to the versions of those
+	// projects that should not be selected.
+	DeniedVersions() map[ProjectRoot][]Version
+}
+
+// SchemeManifest is an optional extension to Manifest, through which a project
+// can declare the VersionScheme its own version tags follow.
+//
+// As with retractions, the scheme is read from the manifest at the project's
+// newest version (the first version in SortForUpgrade order). A scheme declared
+// for the project by the root manifest, via VersionSchemeManifest, takes
+// precedence.
+//
+// Otherwise, it's the same manifest that RetractionManifest is read from: the
+// solver calls GetManifestAndLock at the newest version once per project per
+// solve, before it can sort the project's versions, whether or not it goes on
+// to select that version.
+type SchemeManifest interface {
+	Manifest
+
+	// VersionScheme returns the scheme followed by the project's versions, or
+	// nil if it doesn't follow one.
+	VersionScheme() VersionScheme
+}
+
+// VersionSchemeManifest is an optional extension to RootManifest, through which
+// the root project can declare the VersionScheme followed by the versions of
+// its dependencies.
+type VersionSchemeManifest interface {
+	RootManifest
+
+	// VersionSchemes returns a map of project roots to the scheme followed by
+	// each project's versions.
+	VersionSchemes() map[ProjectRoot]VersionScheme
+}
+
 // SimpleManifest is a helper for tools to enumerate manifest data. It's
 // generally intended for ephemeral manifests, such as those Analyzers create on
 // the fly for projects with no manifest metadata, or metadata through a foreign
 // tool's idioms.
 type SimpleManifest struct {
 	Deps, TestDeps ProjectConstraints
+	// Retracted lists the project's own retracted versions.
+	Retracted []Version
 }
 
-var _ Manifest = SimpleManifest{}
+var _ RetractionManifest = SimpleManifest{}
 
 // DependencyConstraints returns the project's dependencies.
 func (m SimpleManifest) DependencyConstraints() ProjectConstraints {
@@ -81,6 +221,11 @@ func (m SimpleManifest) TestDependencyConstraints() ProjectConstraints {
 	return m.TestDeps
 }
 
+// RetractedVersions returns the project's retracted versions.
+func (m SimpleManifest) RetractedVersions() []Version {
+	return m.Retracted
+}
+
 // simpleRootManifest exists so that we have a safe value to swap into solver
 // params when a nil Manifest is provided.
 //
@@ -88,6 +233,11 @@ func (m SimpleManifest) TestDependencyConstraints() ProjectConstraints {
 type simpleRootManifest struct {
 	c, tc, ovr ProjectConstraints
 	ig, req    map[string]bool
+	icp        ImportCommentPolicy
+	tools      map[string]ProjectProperties
+	deny       map[ProjectRoot][]Version
+	pre        map[ProjectRoot]PrereleasePolicy
+	schemes    map[ProjectRoot]VersionScheme
 }
 
 func (m simpleRootManifest) DependencyConstraints() ProjectConstraints {
@@ -105,6 +255,21 @@ func (m simpleRootManifest) IgnoredPackages() map[string]bool {
 func (m simpleRootManifest) RequiredPackages() map[string]bool {
 	return m.req
 }
+func (m simpleRootManifest) ImportCommentPolicy() ImportCommentPolicy {
+	return m.icp
+}
+func (m simpleRootManifest) ToolDependencies() map[string]ProjectProperties {
+	return m.tools
+}
+func (m simpleRootManifest) DeniedVersions() map[ProjectRoot][]Version {
+	return m.deny
+}
+func (m simpleRootManifest) PrereleasePolicies() map[ProjectRoot]PrereleasePolicy {
+	return m.pre
+}
+func (m simpleRootManifest) VersionSchemes() map[ProjectRoot]VersionScheme {
+	return m.schemes
+}
 func (m simpleRootManifest) dup() simpleRootManifest {
 	m2 := simpleRootManifest{
 		c:   make(ProjectConstraints, len(m.c)),
@@ -112,6 +277,35 @@ func (m simpleRootManifest) dup() simpleRootManifest {
 		ovr: make(ProjectConstraints, len(m.ovr)),
 		ig:  make(map[string]bool, len(m.ig)),
 		req: make(map[string]bool, len(m.req)),
+		icp: m.icp,
+	}
+
+	if m.tools != nil {
+		m2.tools = make(map[string]ProjectProperties, len(m.tools))
+		for k, v := range m.tools {
+			m2.tools[k] = v
+		}
+	}
+
+	if m.pre != nil {
+		m2.pre = make(map[ProjectRoot]PrereleasePolicy, len(m.pre))
+		for k, v := range m.pre {
+			m2.pre[k] = v
+		}
+	}
+
+	if m.schemes != nil {
+		m2.schemes = make(map[ProjectRoot]VersionScheme, len(m.schemes))
+		for k, v := range m.schemes {
+			m2.schemes[k] = v
+		}
+	}
+
+	if m.deny != nil {
+		m2.deny = make(map[ProjectRoot][]Version, len(m.deny))
+		for k, v := range m.deny {
+			m2.deny[k] = append([]Version(nil), v...)
+		}
 	}
 
 	for k, v := range m.c {
@@ -138,7 +332,8 @@ func (m simpleRootManifest) dup() simpleRootManifest {
 // while the solver is in-flight, but it also filters out any empty
 // ProjectProperties.
 //
-// This is achieved by copying the manifest's data into a new SimpleManifest.
+// This is achieved by copying the manifest's data, including any retracted
+// versions, into a new SimpleManifest.
 func prepManifest(m Manifest) SimpleManifest {
 	if m == nil {
 		return SimpleManifest{}
@@ -178,5 +373,9 @@ func prepManifest(m Manifest) SimpleManifest {
 		rm.TestDeps[k] = d
 	}
 
+	if retm, ok := m.(RetractionManifest); ok {
+		rm.Retracted = append([]Version(nil), retm.RetractedVersions()...)
+	}
+
 	return rm
 }
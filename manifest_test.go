@@ -17,6 +17,7 @@ func TestPrepManifest(t *testing.T) {
 				Source: "whatever",
 			},
 		},
+		Retracted: []Version{NewVersion("1.0.0")},
 	}
 
 	prepped := prepManifest(m)
@@ -35,4 +36,8 @@ func TestPrepManifest(t *testing.T) {
 	if td[ProjectRoot("qux")].Constraint != any {
 		t.Error("prepManifest did not normalize nil constraint to anyConstraint in test deps map")
 	}
+
+	if rv := prepped.RetractedVersions(); len(rv) != 1 || rv[0] != NewVersion("1.0.0") {
+		t.Error("prepManifest did not preserve retracted versions")
+	}
 }
@@ -82,6 +82,7 @@ func (m maybeGitSource) try(cachedir string, an ProjectAnalyzer) (source, string
 	}
 
 	src.baseVCSSource.lvfunc = src.listVersions
+	src.baseVCSSource.rtfunc = src.revisionTimes
 	if !r.CheckLocal() {
 		_, err = src.listVersions()
 		if err != nil {
@@ -130,6 +131,7 @@ func (m maybeGopkginSource) try(cachedir string, an ProjectAnalyzer) (source, st
 	}
 
 	src.baseVCSSource.lvfunc = src.listVersions
+	src.baseVCSSource.rtfunc = src.revisionTimes
 	if !r.CheckLocal() {
 		_, err = src.listVersions()
 		if err != nil {
@@ -140,6 +142,26 @@ func (m maybeGopkginSource) try(cachedir string, an ProjectAnalyzer) (source, st
 	return src, ustr, nil
 }
 
+// maybeMajorSource wraps the maybeSource for a repository that was reached
+// through an import path with a /vN major version suffix, so that the resulting
+// source only offers versions with major version N.
+type maybeMajorSource struct {
+	mb    maybeSource
+	major uint64
+}
+
+func (m maybeMajorSource) try(cachedir string, an ProjectAnalyzer) (source, string, error) {
+	// As with gopkg.in, each major version gets its own copy of the repository
+	// on disk, so it can be used alongside the unsuffixed project without the
+	// two sources interfering with each other.
+	src, ident, err := m.mb.try(filepath.Join(cachedir, "major", fmt.Sprintf("v%d", m.major)), an)
+	if err != nil {
+		return nil, ident, err
+	}
+
+	return &majorVersionSource{source: src, major: m.major}, fmt.Sprintf("%s (v%d)", ident, m.major), nil
+}
+
 type maybeBzrSource struct {
 	url *url.URL
 }
@@ -170,6 +192,7 @@ func (m maybeBzrSource) try(cachedir string, an ProjectAnalyzer) (source, string
 		},
 	}
 	src.baseVCSSource.lvfunc = src.listVersions
+	src.baseVCSSource.rtfunc = src.revisionTimes
 
 	return src, ustr, nil
 }
@@ -204,6 +227,7 @@ func (m maybeHgSource) try(cachedir string, an ProjectAnalyzer) (source, string,
 		},
 	}
 	src.baseVCSSource.lvfunc = src.listVersions
+	src.baseVCSSource.rtfunc = src.revisionTimes
 
 	return src, ustr, nil
 }
@@ -0,0 +1,109 @@
+package gps
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// ExportMetadataFile is the name of the file that WriteDepTree places at the
+// root of each project it exports, recording what was exported.
+const ExportMetadataFile = ".gps-export.json"
+
+// ExportMetadata describes a project as it was exported by WriteDepTree. It
+// allows tools to tell what's in a vendor tree without needing the lock that
+// produced it.
+type ExportMetadata struct {
+	// ProjectRoot is the root import path of the exported project.
+	ProjectRoot ProjectRoot `json:"root"`
+
+	// Source is the source the project was exported from, as given in its
+	// ProjectIdentifier. It is empty if the source was derived from the
+	// ProjectRoot.
+	Source string `json:"source,omitempty"`
+
+	// Version is the string form of the version that was exported, and
+	// VersionType is one of "branch", "semver" or "version", indicating how to
+	// interpret it. Both are empty if the project was exported from a bare
+	// revision.
+	Version     string `json:"version,omitempty"`
+	VersionType string `json:"versionType,omitempty"`
+
+	// Revision is the underlying revision that was exported.
+	Revision Revision `json:"revision"`
+
+	// Packages is the list of packages from the project that were in use, as
+	// recorded in the LockedProject. See LockedProject.Packages().
+	Packages []string `json:"packages,omitempty"`
+
+	// Digest is the digest of the contents of the exported tree, after any
+	// pruning, as computed by DigestTree.
+	Digest string `json:"digest"`
+}
+
+// ReadExportMetadata reads the ExportMetadata from the ExportMetadataFile at
+// the root of an exported project in dir.
+func ReadExportMetadata(dir string) (ExportMetadata, error) {
+	var md ExportMetadata
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, ExportMetadataFile))
+	if err != nil {
+		return md, err
+	}
+
+	err = json.Unmarshal(b, &md)
+	if err != nil {
+		return md, fmt.Errorf("malformed export metadata in %s: %s", dir, err)
+	}
+	return md, nil
+}
+
+// writeExportMetadata computes a digest of the project exported to dir, and
+// records it, along with the information in the LockedProject, in the
+// ExportMetadataFile at the root of dir. The roots of any other locked projects
+// nested within dir, relative to it, are passed in nested, and left out of the
+// digest.
+func writeExportMetadata(dir string, lp LockedProject, nested []string) error {
+	digest, err := digestTree(dir, nested)
+	if err != nil {
+		return err
+	}
+
+	md := ExportMetadata{
+		ProjectRoot: lp.Ident().ProjectRoot,
+		Packages:    lp.Packages(),
+		Digest:      digest,
+	}
+	if lp.Ident().Source != string(lp.Ident().ProjectRoot) {
+		md.Source = lp.Ident().Source
+	}
+
+	switch v := lp.Version().(type) {
+	case Revision:
+		md.Revision = v
+	case PairedVersion:
+		md.Revision = v.Underlying()
+		md.Version, md.VersionType = v.String(), versionTypeName(v.Type())
+	case UnpairedVersion:
+		md.Version, md.VersionType = v.String(), versionTypeName(v.Type())
+	}
+
+	b, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ExportMetadataFile), append(b, '\n'), 0666)
+}
+
+func versionTypeName(t VersionType) string {
+	switch t {
+	case IsBranch:
+		return "branch"
+	case IsSemver:
+		return "semver"
+	case IsVersion:
+		return "version"
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package gps
+
+import (
+	"fmt"
+	"time"
+)
+
+// An OutdatedProject reports the versions available for a project in a lock,
+// relative to the version the lock records for it.
+type OutdatedProject struct {
+	// Ident identifies the project.
+	Ident ProjectIdentifier
+
+	// Current is the version of the project recorded in the lock.
+	Current Version
+
+	// Constraint is the effective constraint on the project: the
+	// intersection of the constraints declared on it by the root manifest
+	// and by the manifests of the other locked projects, with the root's
+	// overrides and the project's pre-release policy applied, less any
+	// versions denied by the root or retracted by the project itself.
+	Constraint Constraint
+
+	// Allowed is the newest version of the project that the solver could
+	// select on upgrade: one that satisfies the effective constraint, is
+	// permitted by the project's pre-release policy, and was not committed
+	// after the effective cutoff time. It is nil if there is no such version.
+	Allowed Version
+
+	// Latest is the newest version of the project, regardless of constraints
+	// - including, for example, a new major version. It is nil only if the
+	// project has no versions at all.
+	Latest Version
+}
+
+// IsOutdated indicates whether a newer version of the project is allowed by
+// the effective constraint than the one that is currently locked.
+func (op OutdatedProject) IsOutdated() bool {
+	return op.Allowed != nil && !op.Allowed.Matches(op.Current)
+}
+
+// Outdated reports, for every project in the params' Lock, the currently
+// locked version, the newest version allowed by the effective constraints on
+// the project, and the newest version overall.
+//
+// "Newest" follows the order in which the solver prefers versions when
+// upgrading (see SortForUpgrade), including the ordering of any VersionScheme
+// declared for the project. Effective constraints are computed the way
+// the solver intersects them, pairing versions and revisions using the
+// project's version list, with the manifest of each dependency read at its
+// locked version. Unlike in a solve, the constraints a dependency declares are
+// applied even if it no longer imports the constrained project.
+//
+// Allowed versions are also filtered the way the solver filters them, by the
+// params' Prereleases, Cutoff and Cooldown, and by the root Manifest's denied
+// versions, pre-release policies and version schemes, and by the versions each
+// project retracts. As in a solve that upgrades the project, the locked version
+// gets no exemption from retractions or the cutoff. The params' other fields
+// are ignored.
+//
+// The results are sorted by ProjectRoot.
+func Outdated(params SolveParameters, sm SourceManager) ([]OutdatedProject, error) {
+	m := params.Manifest
+	if m == nil {
+		m = simpleRootManifest{}
+		params.Manifest = m
+	}
+
+	var rd rootdata
+	if err := rd.setVersionPolicies(params); err != nil {
+		return nil, err
+	}
+
+	var lps []LockedProject
+	if params.Lock != nil {
+		lps = make([]LockedProject, len(params.Lock.Projects()))
+		copy(lps, params.Lock.Projects())
+	}
+	SortLockedProjects(lps)
+
+	// The constraints on each project are collected first, as intersecting
+	// them needs the project's version list.
+	ovr := m.Overrides()
+	cs := make(map[ProjectRoot][]Constraint, len(lps))
+	apply := func(pcm ProjectConstraints) {
+		for pr, pp := range pcm {
+			wc := ovr.override(pr, pp)
+			if wc.Constraint != nil {
+				cs[pr] = append(cs[pr], wc.Constraint)
+			}
+		}
+	}
+
+	apply(m.DependencyConstraints())
+	apply(m.TestDependencyConstraints())
+	for _, lp := range lps {
+		dm, _, err := sm.GetManifestAndLock(lp.pi, lp.Version())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest of %s at %s: %s", lp.pi.errString(), lp.Version(), err)
+		}
+		apply(dm.DependencyConstraints())
+	}
+
+	var deny map[ProjectRoot][]Version
+	if dm, ok := m.(DenyListManifest); ok {
+		deny = dm.DeniedVersions()
+	}
+	var schemes map[ProjectRoot]VersionScheme
+	if vm, ok := m.(VersionSchemeManifest); ok {
+		schemes = vm.VersionSchemes()
+	}
+
+	out := make([]OutdatedProject, 0, len(lps))
+	for _, lp := range lps {
+		pr := lp.pi.ProjectRoot
+		vl, err := sm.ListVersions(lp.pi)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s: %s", lp.pi.errString(), err)
+		}
+		SortForUpgrade(vl)
+
+		// As in a solve, the project's scheme and retractions come from the
+		// manifest at its newest version, and failing to read it isn't fatal.
+		var nm Manifest
+		if len(vl) > 0 {
+			nm, _, _ = sm.GetManifestAndLock(lp.pi, vl[0])
+		}
+
+		vs, has := schemes[pr]
+		if !has {
+			if scm, ok := nm.(SchemeManifest); ok {
+				vs = scm.VersionScheme()
+			}
+		}
+		if vs != nil {
+			sortInScheme(vl, vs, false)
+		}
+
+		ex := deny[pr]
+		if rm, ok := nm.(RetractionManifest); ok {
+			ex = append(ex[:len(ex):len(ex)], rm.RetractedVersions()...)
+		}
+
+		var c Constraint = Any()
+		for k, pc := range cs[pr] {
+			if k == 0 {
+				c = pc
+			} else {
+				c = intersectIn(vl, c, pc)
+			}
+		}
+		pp := rd.prereleasePolicy(pr)
+		c = NewExclusionConstraint(withPrereleasePolicy(c, pp), ex...)
+
+		// Likewise, version times that can't be retrieved are just unknown.
+		var vt map[UnpairedVersion]time.Time
+		if !rd.before.IsZero() {
+			vt, _ = sm.VersionTimes(lp.pi)
+		}
+
+		op := OutdatedProject{
+			Ident:      lp.pi,
+			Current:    lp.Version(),
+			Constraint: c,
+		}
+		if len(vl) > 0 {
+			op.Latest = vl[0]
+		}
+		for _, v := range vl {
+			if !matchesIn(vl, c, v) || !prereleasePermitted(pp, c, v) {
+				continue
+			}
+			if t, has := lookupVersionTime(vt, v); has && t.After(rd.before) {
+				continue
+			}
+			op.Allowed = v
+			break
+		}
+
+		out = append(out, op)
+	}
+
+	return out, nil
+}
+
+// intersectIn intersects two constraints on a project the way the solver
+// does (see bridge.intersect), pairing any Versions with the others that share
+// their revision in the project's version list, vl, if they don't otherwise
+// intersect.
+func intersectIn(vl []Version, c1, c2 Constraint) Constraint {
+	if rc := c1.Intersect(c2); rc != none {
+		return rc
+	}
+	return pairIn(vl, c1).Intersect(pairIn(vl, c2))
+}
+
+// matchesIn checks a version of a project against a constraint on it the way
+// the solver does (see bridge.matches), pairing both with the project's version
+// list, vl, if they don't otherwise match.
+func matchesIn(vl []Version, c Constraint, v Version) bool {
+	if c.Matches(v) {
+		return true
+	}
+	return pairIn(vl, c).Matches(vtuIn(vl, v))
+}
+
+// pairIn returns a versionTypeUnion for the constraint from the version list
+// if it's a Version, or else the constraint itself.
+func pairIn(vl []Version, c Constraint) Constraint {
+	if v, ok := c.(Version); ok {
+		return vtuIn(vl, v)
+	}
+	return c
+}
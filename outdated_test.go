@@ -0,0 +1,171 @@
+package gps
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutdated(t *testing.T) {
+	sm := newdepspecSM([]depspec{
+		mkDepspec("root 0.0.0"),
+		mkDepspec("foo 1.0.0", "bar ^1.0.0"),
+		mkDepspec("foo 1.1.0"),
+		mkDepspec("foo 2.0.0"),
+		mkDepspec("bar 1.0.0", "waldo ^1.0.0"),
+		mkDepspec("bar 1.1.0"),
+		mkDepspec("bar 1.2.0"),
+		mkDepspec("bar 2.0.0"),
+		mkDepspec("baz bmaster bazrev2"),
+		mkDepspec("baz bdev bazrev3"),
+		mkDepspec("qux 1.0.0"),
+		mkDepspec("qux 1.1.0"),
+		mkDepspec("qux 1.2.0"),
+		mkDepspec("corge 1.0.0"),
+		mkDepspec("corge 1.1.0"),
+		mkDepspec("corge 1.2.0", "(retract) 1.2.0"),
+		mkDepspec("grault 1.0.0-rc1"),
+		mkDepspec("grault 1.0.0-rc2"),
+		mkDepspec("garply 1.0.0", "(time) 2016-01-01"),
+		mkDepspec("garply 1.1.0", "(time) 2016-06-01"),
+		mkDepspec("garply 1.2.0", "(time) 2016-09-01"),
+		mkDepspec("waldo 1.0.0 waldorev1"),
+		mkDepspec("waldo 1.1.0 waldorev2"),
+	}, nil)
+
+	rm := simpleRootManifest{
+		c: ProjectConstraints{
+			"foo": ProjectProperties{Constraint: mkSVC("^1.0.0")},
+			"bar": ProjectProperties{Constraint: mkSVC("<1.2.0")},
+			"qux":   ProjectProperties{Constraint: mkSVC("^1.0.0")},
+			"waldo": ProjectProperties{Constraint: Revision("waldorev1")},
+		},
+		tc: ProjectConstraints{
+			"baz": ProjectProperties{Constraint: NewBranch("master")},
+		},
+		ovr: ProjectConstraints{
+			"qux": ProjectProperties{Constraint: mkSVC("~1.0.0")},
+		},
+		deny: map[ProjectRoot][]Version{
+			"foo": {NewVersion("1.1.0")},
+		},
+	}
+	l := SimpleLock{
+		NewLockedProject(mkPI("qux"), NewVersion("1.0.0"), nil),
+		NewLockedProject(mkPI("foo"), NewVersion("1.0.0"), nil),
+		NewLockedProject(mkPI("bar"), NewVersion("1.0.0"), nil),
+		NewLockedProject(mkPI("baz"), NewBranch("master").Is("bazrev1"), nil),
+		NewLockedProject(mkPI("corge"), NewVersion("1.0.0"), nil),
+		NewLockedProject(mkPI("grault"), NewVersion("1.0.0-rc1"), nil),
+		NewLockedProject(mkPI("garply"), NewVersion("1.0.0"), nil),
+		NewLockedProject(mkPI("waldo"), NewVersion("1.0.0").Is("waldorev1"), nil),
+	}
+
+	params := SolveParameters{
+		Manifest:    rm,
+		Lock:        l,
+		Prereleases: PrereleasesNever,
+		Cutoff:      time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+	}
+	out, err := Outdated(params, sm)
+	if err != nil {
+		t.Fatalf("Unexpected error computing outdated report: %s", err)
+	}
+
+	expect := []OutdatedProject{
+		{
+			// Root and foo's constraints are intersected
+			Ident:      mkPI("bar"),
+			Current:    NewVersion("1.0.0"),
+			Constraint: mkSVC("<1.2.0").Intersect(mkSVC("^1.0.0")),
+			Allowed:    NewVersion("1.1.0"),
+			Latest:     NewVersion("2.0.0"),
+		},
+		{
+			Ident:      mkPI("baz"),
+			Current:    NewBranch("master").Is("bazrev1"),
+			Constraint: NewBranch("master"),
+			Allowed:    NewBranch("master").Is("bazrev2"),
+			Latest:     NewBranch("dev").Is("bazrev3"),
+		},
+		{
+			// corge retracts its own newest version
+			Ident:      mkPI("corge"),
+			Current:    NewVersion("1.0.0"),
+			Constraint: NewExclusionConstraint(Any(), NewVersion("1.2.0")),
+			Allowed:    NewVersion("1.1.0"),
+			Latest:     NewVersion("1.2.0"),
+		},
+		{
+			// The root denies 1.1.0
+			Ident:      mkPI("foo"),
+			Current:    NewVersion("1.0.0"),
+			Constraint: NewExclusionConstraint(mkSVC("^1.0.0"), NewVersion("1.1.0")),
+			Allowed:    NewVersion("1.0.0"),
+			Latest:     NewVersion("2.0.0"),
+		},
+		{
+			// 1.2.0 was committed after the cutoff
+			Ident:      mkPI("garply"),
+			Current:    NewVersion("1.0.0"),
+			Constraint: Any(),
+			Allowed:    NewVersion("1.1.0"),
+			Latest:     NewVersion("1.2.0"),
+		},
+		{
+			// Pre-releases are never allowed
+			Ident:      mkPI("grault"),
+			Current:    NewVersion("1.0.0-rc1"),
+			Constraint: Any(),
+			Latest:     NewVersion("1.0.0-rc2"),
+		},
+		{
+			// The root's override replaces its own constraint
+			Ident:      mkPI("qux"),
+			Current:    NewVersion("1.0.0"),
+			Constraint: mkSVC("~1.0.0"),
+			Allowed:    NewVersion("1.0.0"),
+			Latest:     NewVersion("1.2.0"),
+		},
+		{
+			// The root's revision is paired with the version bar's range
+			// allows, as the solver pairs them
+			Ident:      mkPI("waldo"),
+			Current:    NewVersion("1.0.0").Is("waldorev1"),
+			Constraint: NewVersion("1.0.0").Is("waldorev1"),
+			Allowed:    NewVersion("1.0.0").Is("waldorev1"),
+			Latest:     NewVersion("1.1.0").Is("waldorev2"),
+		},
+	}
+
+	if len(out) != len(expect) {
+		t.Fatalf("Expected %v outdated entries, got %v: %v", len(expect), len(out), out)
+	}
+	for k, op := range out {
+		eop := expect[k]
+		if op.Ident != eop.Ident {
+			t.Errorf("Expected entry %v to be for %s, got %s", k, eop.Ident, op.Ident)
+			continue
+		}
+		if typedConstraintString(op.Constraint) != typedConstraintString(eop.Constraint) {
+			t.Errorf("%s: expected effective constraint %s, got %s", op.Ident, eop.Constraint, op.Constraint)
+		}
+		op.Constraint, eop.Constraint = nil, nil
+		if !reflect.DeepEqual(op, eop) {
+			t.Errorf("%s: unexpected report:\n\t(GOT): %v\n\t(WNT): %v", op.Ident, op, eop)
+		}
+	}
+
+	outdated := []bool{true, true, true, false, true, false, false, false}
+	for k, op := range out {
+		if op.IsOutdated() != outdated[k] {
+			t.Errorf("%s: expected outdated status %v, got %v", op.Ident, outdated[k], op.IsOutdated())
+		}
+	}
+
+	// Invalid policies are rejected, as in a solve
+	params.Cooldown = -time.Hour
+	if _, err = Outdated(params, sm); err == nil {
+		t.Errorf("Expected an error for a negative cool-down period")
+	}
+}
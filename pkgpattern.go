@@ -0,0 +1,142 @@
+package gps
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Package patterns may be used in place of literal import paths when
+// declaring ignored or required packages. A pattern is a slash-separated import
+// path in which:
+//
+//  - An element consisting entirely of "..." matches zero or more path
+//    elements. "github.com/foo/bar/..." thus matches github.com/foo/bar and
+//    every package beneath it, and ".../testutil" matches any package named
+//    testutil, at any depth.
+//  - Any other element is matched against a single path element using the
+//    syntax of path.Match, so "*/testutil" matches "a/testutil", but not
+//    "a/b/testutil".
+//
+// Entries without any of these special characters are literal import paths,
+// and match only themselves.
+
+// isPkgPattern indicates whether the given string is a package pattern, rather
+// than a literal import path.
+func isPkgPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[\\") || hasEllipsisElem(s)
+}
+
+func hasEllipsisElem(s string) bool {
+	for _, e := range strings.Split(s, "/") {
+		if e == "..." {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePkgPattern returns an error if the provided pattern is malformed.
+func validatePkgPattern(pattern string) error {
+	for _, e := range strings.Split(pattern, "/") {
+		if e == "..." {
+			continue
+		}
+		if strings.Contains(e, "...") {
+			return fmt.Errorf("%q is not a valid package pattern: \"...\" must be a whole path element", pattern)
+		}
+		if _, err := path.Match(e, ""); err != nil {
+			return fmt.Errorf("%q is not a valid package pattern: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchPkgPattern reports whether the import path matches the pattern.
+// Malformed patterns match nothing.
+func matchPkgPattern(pattern, ip string) bool {
+	if !isPkgPattern(pattern) {
+		return pattern == ip
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(ip, "/"))
+}
+
+func matchElems(pat, elems []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "..." {
+			// Try to match the remainder of the pattern against every possible
+			// suffix of the remaining elements, including the empty one.
+			for k := 0; k <= len(elems); k++ {
+				if matchElems(pat[1:], elems[k:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pat[0], elems[0]); !ok || err != nil {
+			return false
+		}
+		pat, elems = pat[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
+
+// patternPrefix returns the literal leading portion of a pattern - the path
+// elements that precede its first wildcard. All paths matched by the pattern
+// are at or beneath this prefix. If the pattern begins with a wildcard, the
+// empty string is returned.
+func patternPrefix(pattern string) string {
+	elems := strings.Split(pattern, "/")
+	for k, e := range elems {
+		if e == "..." || strings.ContainsAny(e, "*?[\\") {
+			return strings.Join(elems[:k], "/")
+		}
+	}
+	return pattern
+}
+
+// pkgPatterns returns the sorted list of package patterns from the provided
+// set of ignored or required packages. Literal import paths are omitted.
+func pkgPatterns(set map[string]bool) []string {
+	var pats []string
+	for s, on := range set {
+		if on && isPkgPattern(s) {
+			pats = append(pats, s)
+		}
+	}
+	sort.Strings(pats)
+	return pats
+}
+
+// pkgMatcher determines whether import paths are included in a set of
+// packages that may contain both literal paths and patterns, as given for
+// ignored or required packages.
+type pkgMatcher struct {
+	set  map[string]bool
+	pats []string
+}
+
+func newPkgMatcher(set map[string]bool) pkgMatcher {
+	return pkgMatcher{
+		set:  set,
+		pats: pkgPatterns(set),
+	}
+}
+
+func (m pkgMatcher) match(ip string) bool {
+	if m.set[ip] {
+		return true
+	}
+	for _, pat := range m.pats {
+		if matchPkgPattern(pat, ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package gps
+
+import "testing"
+
+func TestMatchPkgPattern(t *testing.T) {
+	table := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+		{"a/...", "a", true},
+		{"a/...", "a/b", true},
+		{"a/...", "a/b/c", true},
+		{"a/...", "ab", false},
+		{"a/.../c", "a/c", true},
+		{"a/.../c", "a/b/x/c", true},
+		{"a/.../c", "a/b/x/d", false},
+		{".../testutil", "testutil", true},
+		{".../testutil", "a/b/testutil", true},
+		{"*/testutil", "a/testutil", true},
+		{"*/testutil", "a/b/testutil", false},
+		{"*/testutil", "testutil", false},
+		{"a/*", "a/b", true},
+		{"a/*", "a", false},
+		{"a/b*", "a/bar", true},
+		{"a/[", "a/[", false},
+	}
+
+	for _, fix := range table {
+		if got := matchPkgPattern(fix.pattern, fix.path); got != fix.match {
+			t.Errorf("matchPkgPattern(%q, %q) returned %v, expected %v", fix.pattern, fix.path, got, fix.match)
+		}
+	}
+}
+
+func TestValidatePkgPattern(t *testing.T) {
+	for _, ok := range []string{"a/b", "a/...", ".../a", "*/a", "a/b*/c"} {
+		if err := validatePkgPattern(ok); err != nil {
+			t.Errorf("Unexpected error validating %q: %s", ok, err)
+		}
+	}
+	for _, bad := range []string{"a/b...", "a/[", "...a"} {
+		if err := validatePkgPattern(bad); err == nil {
+			t.Errorf("Expected error validating %q", bad)
+		}
+	}
+}
+
+func TestPatternPrefix(t *testing.T) {
+	table := map[string]string{
+		"a/b":          "a/b",
+		"a/b/...":      "a/b",
+		"a/*/c":        "a",
+		"*/testutil":   "",
+		".../testutil": "",
+	}
+
+	for pat, want := range table {
+		if got := patternPrefix(pat); got != want {
+			t.Errorf("patternPrefix(%q) returned %q, expected %q", pat, got, want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package gps
+
+import "fmt"
+
+// PrereleasePolicy determines whether the solver may select semver pre-release
+// versions, such as 1.3.0-rc1.
+//
+// A policy may be set for a whole solve run via SolveParameters.Prereleases,
+// and for individual projects by a root manifest implementing
+// PrereleaseManifest.
+type PrereleasePolicy uint8
+
+const (
+	// PrereleasesAllowed permits pre-releases to be selected whenever they
+	// satisfy the constraints on their project, including when the project is
+	// unconstrained. This is the default.
+	PrereleasesAllowed PrereleasePolicy = iota
+
+	// PrereleasesIfNamed permits a pre-release only if the constraint on its
+	// project names a pre-release of the same major, minor and patch version.
+	// Thus ">=1.3.0-rc1" admits 1.3.0-rc2, but "^1.2.0" admits neither that
+	// nor 1.3.0-rc1, and no pre-release is selected for an unconstrained
+	// project.
+	PrereleasesIfNamed
+
+	// PrereleasesNever never permits pre-releases to be selected, even if a
+	// constraint names one exactly.
+	PrereleasesNever
+)
+
+func (p PrereleasePolicy) String() string {
+	switch p {
+	case PrereleasesAllowed:
+		return "allowed"
+	case PrereleasesIfNamed:
+		return "if-named"
+	case PrereleasesNever:
+		return "never"
+	}
+	return fmt.Sprintf("PrereleasePolicy(%d)", uint8(p))
+}
+
+// withPrereleasePolicy returns the constraint with the pre-release policy
+// applied to any semver ranges it contains.
+func withPrereleasePolicy(c Constraint, p PrereleasePolicy) Constraint {
+	switch tc := c.(type) {
+	case semverConstraint:
+		tc.pre = p
+		return tc
+	case unionConstraint:
+		rcs := make([]Constraint, len(tc))
+		for k, m := range tc {
+			rcs[k] = withPrereleasePolicy(m, p)
+		}
+		return NewUnionConstraint(rcs...)
+	case exclusionConstraint:
+		tc.c = withPrereleasePolicy(tc.c, p)
+		return tc
+	}
+	return c
+}
+
+// isPrerelease indicates whether the version is a semver pre-release, returning
+// the underlying semver version if so.
+func isPrerelease(v Version) (semVersion, bool) {
+	if pv, ok := v.(versionPair); ok {
+		v = pv.v
+	}
+	if sv, ok := v.(semVersion); ok && sv.sv.Prerelease() != "" {
+		return sv, true
+	}
+	return semVersion{}, false
+}
+
+// namesPrerelease indicates whether the constraint names the pre-release
+// version, in the sense of PrereleasesIfNamed: either exactly, or as a
+// pre-release of the same major, minor and patch version in a range.
+func namesPrerelease(c Constraint, sv semVersion) bool {
+	switch tc := c.(type) {
+	case semverConstraint:
+		return tc.namesPrerelease(sv.sv)
+	case semVersion, versionPair:
+		return tc.(Version).Matches(sv)
+	case unionConstraint:
+		for _, m := range tc {
+			if namesPrerelease(m, sv) {
+				return true
+			}
+		}
+	case exclusionConstraint:
+		return namesPrerelease(tc.c, sv)
+	}
+	return false
+}
+
+// prereleasePermitted indicates whether the policy permits the version to be
+// selected under the constraint on its project. Versions that aren't
+// pre-releases are always permitted.
+func prereleasePermitted(p PrereleasePolicy, c Constraint, v Version) bool {
+	sv, is := isPrerelease(v)
+	if !is {
+		return true
+	}
+
+	switch p {
+	case PrereleasesAllowed:
+		return true
+	case PrereleasesIfNamed:
+		return namesPrerelease(c, sv)
+	}
+	return false
+}
+
+// prereleaseRejects indicates whether the constraint rejects the version only
+// because of its pre-release policy.
+func prereleaseRejects(c Constraint, v Version) bool {
+	sv, is := isPrerelease(v)
+	if !is {
+		return false
+	}
+	sc, ok := c.(semverConstraint)
+	return ok && sc.c.Matches(sv.sv) == nil && !sc.prereleaseOK(sv.sv)
+}
@@ -0,0 +1,213 @@
+package gps
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PruneOptions is a bitfield of the pruning steps that WriteDepTree and
+// UpdateDepTree should apply to each project after it is exported.
+type PruneOptions uint8
+
+const (
+	// PruneNestedVendorDirs removes any vendor directories contained within
+	// exported projects.
+	PruneNestedVendorDirs PruneOptions = 1 << iota
+
+	// PruneUnusedPackages removes the files in every directory that does not
+	// correspond to one of the packages listed in the LockedProject's
+	// Packages(). Legal files (see PruneNonGoFiles) are kept.
+	//
+	// If a LockedProject lists no packages at all, it is assumed that the
+	// information is simply unavailable, and nothing is removed.
+	PruneUnusedPackages
+
+	// PruneNonGoFiles removes all files that the go tool would not use when
+	// building a package - that is, everything other than Go, cgo, assembly
+	// and other compiled sources. Legal files, such as LICENSE, NOTICE and
+	// COPYING, are kept.
+	PruneNonGoFiles
+
+	// PruneGoTestFiles removes all _test.go files.
+	PruneGoTestFiles
+
+	// PruneEmptyDirs removes directories that are empty, or became empty as a
+	// result of other pruning.
+	PruneEmptyDirs
+)
+
+// legalFilePrefixes are the (lowercased) prefixes of the names of files that
+// are never pruned, as they're likely to be needed to comply with a
+// project's license.
+var legalFilePrefixes = []string{
+	"authors",
+	"contributors",
+	"copying",
+	"copyleft",
+	"copyright",
+	"disclaimer",
+	"legal",
+	"licence",
+	"license",
+	"notice",
+	"patent",
+	"third-party",
+	"thirdparty",
+	"unlicense",
+}
+
+// buildFileExts are the extensions of files that the go tool may use when
+// building a package.
+var buildFileExts = map[string]bool{
+	".go":      true,
+	".c":       true,
+	".h":       true,
+	".s":       true,
+	".S":       true,
+	".cc":      true,
+	".cpp":     true,
+	".cxx":     true,
+	".hh":      true,
+	".hpp":     true,
+	".hxx":     true,
+	".m":       true,
+	".f":       true,
+	".F":       true,
+	".for":     true,
+	".f90":     true,
+	".swig":    true,
+	".swigcxx": true,
+	".syso":    true,
+}
+
+// isLegalFile reports whether the named file looks like it holds licensing
+// information, and so should be kept regardless of any pruning.
+func isLegalFile(name string) bool {
+	name = strings.ToLower(name)
+	for _, prefix := range legalFilePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneProject applies the requested pruning steps to the project exported to
+// dir.
+func pruneProject(dir string, lp LockedProject, opts PruneOptions) error {
+	if opts&PruneNestedVendorDirs != 0 {
+		if err := filepath.Walk(dir, stripVendor); err != nil {
+			return err
+		}
+	}
+
+	if opts&PruneUnusedPackages != 0 && len(lp.Packages()) > 0 {
+		used := make(map[string]bool, len(lp.Packages()))
+		for _, pkg := range lp.Packages() {
+			used[filepath.Join(dir, filepath.FromSlash(pkg))] = true
+		}
+
+		err := pruneFiles(dir, func(path string, fi os.FileInfo) bool {
+			return !used[filepath.Dir(path)] && !isLegalFile(fi.Name())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts&PruneNonGoFiles != 0 {
+		err := pruneFiles(dir, func(path string, fi os.FileInfo) bool {
+			return !buildFileExts[filepath.Ext(path)] && !isLegalFile(fi.Name())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts&PruneGoTestFiles != 0 {
+		err := pruneFiles(dir, func(path string, fi os.FileInfo) bool {
+			return strings.HasSuffix(path, "_test.go")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts&PruneEmptyDirs != 0 {
+		return pruneEmptyDirs(dir)
+	}
+
+	return nil
+}
+
+// pruneFiles removes every non-directory within dir for which the provided
+// func returns true.
+func pruneFiles(dir string, rm func(string, os.FileInfo) bool) error {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !fi.IsDir() && rm(path, fi) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes all empty directories beneath dir, working from the
+// bottom up so that dirs containing only empty dirs are removed, too. dir
+// itself is left in place.
+func pruneEmptyDirs(dir string) error {
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() && path != dir {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deeper paths sort after their parents, so reversing puts children first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, path := range dirs {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = f.Readdirnames(1)
+		f.Close()
+
+		if err != io.EOF {
+			if err != nil {
+				return err
+			}
+			// Not empty
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// listTree returns the slash-separated paths of all files and dirs beneath
+// dir, relative to it.
+func listTree(t *testing.T, dir string) []string {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			rel += "/"
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %s", dir, err)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func TestPruneProject(t *testing.T) {
+	table := map[string]struct {
+		opts PruneOptions
+		pkgs []string
+		want []string
+	}{
+		"nothing": {
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "README.md", "root.go", "root_test.go",
+				"sub/", "sub/sub.go", "sub/sub_test.go", "sub/testdata/", "sub/testdata/data.json",
+				"unused/", "unused/NOTICE", "unused/unused.go",
+				"vendor/", "vendor/foo/", "vendor/foo/COPYING.txt", "vendor/foo/data/", "vendor/foo/data/foo.dat",
+				"vendor/foo/foo.go", "vendor/foo/foo_amd64.s", "vendor/foo/foo_cgo.c",
+				"version",
+			},
+		},
+		"vendor and tests": {
+			opts: PruneNestedVendorDirs | PruneGoTestFiles,
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "README.md", "root.go",
+				"sub/", "sub/sub.go", "sub/testdata/", "sub/testdata/data.json",
+				"unused/", "unused/NOTICE", "unused/unused.go",
+				"version",
+			},
+		},
+		"non-go files": {
+			opts: PruneNonGoFiles,
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "root.go", "root_test.go",
+				"sub/", "sub/sub.go", "sub/sub_test.go", "sub/testdata/",
+				"unused/", "unused/NOTICE", "unused/unused.go",
+				"vendor/", "vendor/foo/", "vendor/foo/COPYING.txt", "vendor/foo/data/",
+				"vendor/foo/foo.go", "vendor/foo/foo_amd64.s", "vendor/foo/foo_cgo.c",
+			},
+		},
+		"non-go files and empty dirs": {
+			opts: PruneNonGoFiles | PruneEmptyDirs,
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "root.go", "root_test.go",
+				"sub/", "sub/sub.go", "sub/sub_test.go",
+				"unused/", "unused/NOTICE", "unused/unused.go",
+				"vendor/", "vendor/foo/", "vendor/foo/COPYING.txt",
+				"vendor/foo/foo.go", "vendor/foo/foo_amd64.s", "vendor/foo/foo_cgo.c",
+			},
+		},
+		"unused packages": {
+			opts: PruneUnusedPackages | PruneEmptyDirs,
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "README.md", "root.go", "root_test.go",
+				"sub/", "sub/sub.go", "sub/sub_test.go",
+				"unused/", "unused/NOTICE",
+				"vendor/", "vendor/foo/", "vendor/foo/COPYING.txt",
+				"version",
+			},
+		},
+		"unused packages, none listed": {
+			opts: PruneUnusedPackages | PruneEmptyDirs,
+			want: []string{
+				ExportMetadataFile, "LICENSE", "README.md", "root.go", "root_test.go",
+				"sub/", "sub/sub.go", "sub/sub_test.go", "sub/testdata/", "sub/testdata/data.json",
+				"unused/", "unused/NOTICE", "unused/unused.go",
+				"vendor/", "vendor/foo/", "vendor/foo/COPYING.txt", "vendor/foo/data/", "vendor/foo/data/foo.dat",
+				"vendor/foo/foo.go", "vendor/foo/foo_amd64.s", "vendor/foo/foo_cgo.c",
+				"version",
+			},
+		},
+		"everything": {
+			opts: PruneNestedVendorDirs | PruneUnusedPackages | PruneNonGoFiles | PruneGoTestFiles | PruneEmptyDirs,
+			pkgs: []string{".", "sub"},
+			want: []string{
+				ExportMetadataFile, "LICENSE", "root.go",
+				"sub/", "sub/sub.go",
+				"unused/", "unused/NOTICE",
+			},
+		},
+	}
+
+	for name, fix := range table {
+		tmp, err := ioutil.TempDir("", "prunetest")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %s", err)
+		}
+
+		vendor := filepath.Join(tmp, "vendor")
+		l := SimpleLock{NewLockedProject(mkPI("github.com/sdboyer/prune"), NewVersion("1.0.0"), fix.pkgs)}
+		err = WriteDepTree(vendor, l, newExportSM(), fix.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error while writing dep tree: %s", name, err)
+		} else if got := listTree(t, filepath.Join(vendor, "github.com", "sdboyer", "prune")); !reflect.DeepEqual(got, fix.want) {
+			t.Errorf("%s: pruned tree did not match expectations:\n\t(GOT): %s\n\t(WNT): %s", name, got, fix.want)
+		}
+
+		os.RemoveAll(tmp)
+	}
+}
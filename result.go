@@ -2,8 +2,12 @@ package gps
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 // A Solution is returned by a solver run. It is mostly just a Lock, with some
@@ -13,6 +17,19 @@ type Solution interface {
 	Attempts() int
 }
 
+// A WarningSolution is a Solution that also reports non-fatal problems found
+// during the solve run. The Solutions returned by Solver.Solve() implement it.
+type WarningSolution interface {
+	Solution
+
+	// Warnings returns problems the solver encountered that, per the
+	// solve's configuration, did not prevent a solution from being found -
+	// for example, *ImportCommentErrors when the root manifest's
+	// ImportCommentPolicy is ImportCommentsWarn, or a *RetractedVersionError
+	// for each locked version that has since been retracted.
+	Warnings() []error
+}
+
 type solution struct {
 	// A list of the projects selected by the solver.
 	p []LockedProject
@@ -22,45 +39,540 @@ type solution struct {
 
 	// The hash digest of the input opts
 	hd []byte
+
+	// Non-fatal problems found in the solution
+	warn []error
 }
 
+// exportConcurrency is the maximum number of projects that WriteDepTree will
+// export simultaneously.
+const exportConcurrency = 8
+
 // WriteDepTree takes a basedir and a Lock, and exports all the projects
 // listed in the lock to the appropriate target location within the basedir.
 //
 // If the goal is to populate a vendor directory, basedir should be the absolute
 // path to that vendor directory, not its parent (a project root, typically).
 //
-// It requires a SourceManager to do the work, and takes a flag indicating
-// whether or not to strip vendor directories contained in the exported
-// dependencies.
-func WriteDepTree(basedir string, l Lock, sm SourceManager, sv bool) error {
+// It requires a SourceManager to do the work, and takes a set of PruneOptions
+// indicating what, if anything, should be removed from each exported project
+// (nested vendor directories, unused packages, tests, etc.).
+//
+// Projects are exported in parallel into a temporary sibling of basedir. Only
+// once every project has been exported successfully is the new tree swapped
+// into place, replacing whatever was previously at basedir. If any export
+// fails, the temporary tree is discarded and the contents of basedir are left
+// untouched.
+//
+// A metadata file (see ExportMetadata) describing what was exported is written
+// to the root of each project, after pruning.
+func WriteDepTree(basedir string, l Lock, sm SourceManager, prune PruneOptions) error {
 	if l == nil {
 		return fmt.Errorf("must provide non-nil Lock to WriteDepTree")
 	}
 
-	err := os.MkdirAll(basedir, 0777)
+	tmp, err := mkSiblingTempDir(basedir)
+	if err != nil {
+		return err
+	}
+
+	err = exportProjects(tmp, l.Projects(), sm, prune)
 	if err != nil {
+		removeAll(tmp)
+		return err
+	}
+
+	err = swapDir(tmp, basedir)
+	if err != nil {
+		removeAll(tmp)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateDepTree brings an existing tree of exported projects at basedir, as
+// previously written by WriteDepTree for the old Lock, in line with the new
+// Lock.
+//
+// Only projects whose version, revision, source or package list differ
+// between the two locks (or whose directory is missing from basedir) are
+// exported again; projects that no longer appear in the new lock are removed,
+// and everything else is left untouched.
+//
+// As with WriteDepTree, all exports are performed into a temporary sibling of
+// basedir first, so a failed export leaves basedir exactly as it was. Unlike
+// WriteDepTree, however, the results are then moved into basedir one project at
+// a time, rather than by swapping in a whole new tree. If removing an old
+// project or moving a new one into place fails, the error is returned
+// immediately, and basedir is left partially updated: some projects may
+// already be at their new versions, and the failed project's directory may be
+// missing. Calling UpdateDepTree again with the same arguments will repair it,
+// as missing projects are always exported again.
+//
+// If old is nil, or basedir does not yet exist, this is equivalent to
+// WriteDepTree.
+func UpdateDepTree(basedir string, old, new Lock, sm SourceManager, prune PruneOptions) error {
+	if new == nil {
+		return fmt.Errorf("must provide non-nil Lock to UpdateDepTree")
+	}
+
+	if old == nil {
+		return WriteDepTree(basedir, new, sm, prune)
+	}
+	if _, err := os.Stat(basedir); os.IsNotExist(err) {
+		return WriteDepTree(basedir, new, sm, prune)
+	} else if err != nil {
 		return err
 	}
 
-	// TODO(sdboyer) parallelize
-	for _, p := range l.Projects() {
-		to := filepath.FromSlash(filepath.Join(basedir, string(p.Ident().ProjectRoot)))
+	changed, removed := diffLockedProjects(basedir, old.Projects(), new.Projects())
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
 
-		err = sm.ExportProject(p.Ident(), p.Version(), to)
+	var tmp string
+	if len(changed) > 0 {
+		var err error
+		tmp, err = mkSiblingTempDir(basedir)
 		if err != nil {
-			removeAll(basedir)
-			return fmt.Errorf("error while exporting %s: %s", p.Ident().ProjectRoot, err)
+			return err
 		}
-		if sv {
-			filepath.Walk(to, stripVendor)
+		defer removeAll(tmp)
+
+		err = exportProjects(tmp, changed, sm, prune)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pr := range removed {
+		dir := filepath.Join(basedir, filepath.FromSlash(string(pr)))
+		err := removeAll(dir)
+		if err != nil {
+			return err
+		}
+		removeEmptyParents(filepath.Dir(dir), basedir)
+	}
+
+	for _, lp := range changed {
+		pr := string(lp.Ident().ProjectRoot)
+		// Projects nested inside another changed project were exported into
+		// that project's temporary tree, and move along with it.
+		var carried bool
+		for _, lp2 := range changed {
+			pr2 := string(lp2.Ident().ProjectRoot)
+			if pr != pr2 && eqOrSlashedPrefix(pr, pr2) {
+				carried = true
+				break
+			}
+		}
+		if carried {
+			continue
+		}
+
+		from := filepath.Join(tmp, filepath.FromSlash(pr))
+		to := filepath.Join(basedir, filepath.FromSlash(pr))
+		err := removeAll(to)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(to), 0777)
+		if err != nil {
+			return err
+		}
+		err = renameWithFallback(from, to)
+		if err != nil {
+			return err
 		}
-		// TODO(sdboyer) dump version metadata file
 	}
 
 	return nil
 }
 
+// diffLockedProjects compares two lists of locked projects, returning the
+// projects from the new list that need to be exported into basedir, and the
+// roots of projects from the old list that need to be removed from it.
+//
+// A project needs to be exported if it is new, if it differs in any way from
+// its old counterpart, or if its directory is missing from basedir. Because
+// replacing or removing a project's directory also clobbers any projects
+// nested beneath it, those nested projects are exported again as well.
+func diffLockedProjects(basedir string, old, new []LockedProject) (changed []LockedProject, removed []ProjectRoot) {
+	oldm := make(map[ProjectRoot]LockedProject, len(old))
+	for _, lp := range old {
+		oldm[lp.Ident().ProjectRoot] = lp
+	}
+	newm := make(map[ProjectRoot]bool, len(new))
+	for _, lp := range new {
+		newm[lp.Ident().ProjectRoot] = true
+	}
+
+	for _, lp := range old {
+		if !newm[lp.Ident().ProjectRoot] {
+			removed = append(removed, lp.Ident().ProjectRoot)
+		}
+	}
+
+	// Everything removed or changed clobbers its directory
+	var clobbered []string
+	for _, pr := range removed {
+		clobbered = append(clobbered, string(pr))
+	}
+
+	isChanged := make([]bool, len(new))
+	for k, lp := range new {
+		pr := lp.Ident().ProjectRoot
+		olp, has := oldm[pr]
+		if !has || !lockedProjectsEq(olp, lp) {
+			isChanged[k] = true
+		} else if _, err := os.Stat(filepath.Join(basedir, filepath.FromSlash(string(pr)))); err != nil {
+			isChanged[k] = true
+		}
+
+		if isChanged[k] {
+			clobbered = append(clobbered, string(pr))
+		}
+	}
+
+	for k, lp := range new {
+		pr := string(lp.Ident().ProjectRoot)
+		for _, cpr := range clobbered {
+			if pr != cpr && eqOrSlashedPrefix(pr, cpr) {
+				isChanged[k] = true
+			}
+		}
+
+		if isChanged[k] {
+			changed = append(changed, lp)
+		}
+	}
+
+	return changed, removed
+}
+
+// lockedProjectsEq is like LockedProject.Eq, but does not care about the order
+// in which packages are listed.
+func lockedProjectsEq(lp1, lp2 LockedProject) bool {
+	if len(lp1.pkgs) != len(lp2.pkgs) {
+		return false
+	}
+
+	p1, p2 := make([]string, len(lp1.pkgs)), make([]string, len(lp2.pkgs))
+	copy(p1, lp1.pkgs)
+	copy(p2, lp2.pkgs)
+	sort.Strings(p1)
+	sort.Strings(p2)
+
+	lp1.pkgs, lp2.pkgs = p1, p2
+	return lp1.Eq(lp2)
+}
+
+// removeEmptyParents removes dir, and then each of its parents in turn, for as
+// long as they are empty, stopping at (and never removing) stop.
+func removeEmptyParents(dir, stop string) {
+	for dir != stop && eqOrSlashedPrefix(filepath.ToSlash(dir), filepath.ToSlash(stop)) {
+		// os.Remove refuses to remove non-empty dirs, which is what we want
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// A VerifyStatus describes the outcome of checking a single project in a tree
+// written by WriteDepTree against the Lock it is supposed to reflect.
+type VerifyStatus uint8
+
+const (
+	// VerifyOK indicates that the project is present, at the locked version,
+	// and unmodified.
+	VerifyOK VerifyStatus = iota
+
+	// VerifyMissing indicates that the project's directory does not exist.
+	VerifyMissing
+
+	// VerifyWrongVersion indicates that the project's export metadata records
+	// a different version or revision than the one in the lock.
+	VerifyWrongVersion
+
+	// VerifyModified indicates that the project's current content digest does
+	// not match the digest in the lock (or, if the lock has none, the one in
+	// its export metadata).
+	VerifyModified
+
+	// VerifyNoData indicates that the project is present, but has neither
+	// export metadata nor a digest in the lock to check against.
+	VerifyNoData
+
+	// VerifyBadMetadata indicates that the project's export metadata file
+	// exists, but could not be read or parsed.
+	VerifyBadMetadata
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyOK:
+		return "ok"
+	case VerifyMissing:
+		return "missing"
+	case VerifyWrongVersion:
+		return "wrong version"
+	case VerifyModified:
+		return "modified"
+	case VerifyNoData:
+		return "no verification data"
+	case VerifyBadMetadata:
+		return "bad export metadata"
+	}
+	return "unknown"
+}
+
+// VerifyDepTree checks the tree of exported projects at basedir against the
+// provided Lock, returning the VerifyStatus of each project in the lock.
+//
+// It relies on the ExportMetadata written by WriteDepTree to determine which
+// version of each project is present, and on content digests (see DigestTree)
+// to determine whether a project has been modified since it was exported.
+// Digests recorded on the LockedProjects themselves take precedence over those
+// in the export metadata. As when they were written, the trees of other locked
+// projects nested within a project's tree are not included in its digest.
+//
+// An error is only returned if something prevents verification from
+// proceeding, such as an unreadable project file; problems with the tree
+// itself, including unreadable or malformed export metadata, are reported
+// through the returned statuses.
+func VerifyDepTree(basedir string, l Lock) (map[ProjectRoot]VerifyStatus, error) {
+	if l == nil {
+		return nil, fmt.Errorf("must provide non-nil Lock to VerifyDepTree")
+	}
+
+	lps := l.Projects()
+	ret := make(map[ProjectRoot]VerifyStatus, len(lps))
+	for _, lp := range lps {
+		pr := lp.Ident().ProjectRoot
+		dir := filepath.Join(basedir, filepath.FromSlash(string(pr)))
+
+		if fi, err := os.Stat(dir); os.IsNotExist(err) || (err == nil && !fi.IsDir()) {
+			ret[pr] = VerifyMissing
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		digest := lp.Digest()
+		md, err := ReadExportMetadata(dir)
+		if err == nil {
+			if !exportMatchesLock(md, lp) {
+				ret[pr] = VerifyWrongVersion
+				continue
+			}
+			if digest == "" {
+				digest = md.Digest
+			}
+		} else if !os.IsNotExist(err) {
+			ret[pr] = VerifyBadMetadata
+			continue
+		}
+
+		if digest == "" {
+			ret[pr] = VerifyNoData
+			continue
+		}
+
+		actual, err := digestTree(dir, nestedRoots(pr, lps))
+		if err != nil {
+			return nil, err
+		}
+		if actual != digest {
+			ret[pr] = VerifyModified
+		} else {
+			ret[pr] = VerifyOK
+		}
+	}
+
+	return ret, nil
+}
+
+// exportMatchesLock reports whether the version recorded in export metadata is
+// the same as the one in the LockedProject. Revisions are compared if both
+// have one; otherwise, the version strings are.
+func exportMatchesLock(md ExportMetadata, lp LockedProject) bool {
+	if md.Revision != "" && lp.r != "" {
+		return md.Revision == lp.r
+	}
+
+	var lv string
+	if lp.v != nil {
+		lv = lp.v.String()
+	}
+	return md.Version == lv
+}
+
+// mkSiblingTempDir creates a new, empty temporary directory in the same parent
+// directory as the provided path. Keeping it on the same filesystem means that
+// moving it into place later is a cheap rename.
+func mkSiblingTempDir(path string) (string, error) {
+	parent := filepath.Dir(path)
+	err := os.MkdirAll(parent, 0777)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempDir(parent, "."+filepath.Base(path)+"-")
+	if err != nil {
+		return "", err
+	}
+
+	// TempDir creates the dir as 0700; make it look like any other dir.
+	err = os.Chmod(tmp, 0755)
+	if err != nil {
+		removeAll(tmp)
+		return "", err
+	}
+
+	return tmp, nil
+}
+
+// exportProjects exports each of the provided projects into the appropriate
+// location beneath basedir, running up to exportConcurrency exports at a time.
+//
+// Projects whose roots are nested beneath the root of another project in the
+// list are held back until that project has been exported, so that the two
+// never write to the same part of the tree at the same time.
+//
+// If any export fails, no further exports are started, and the first error
+// encountered is returned.
+func exportProjects(basedir string, lps []LockedProject, sm SourceManager, prune PruneOptions) error {
+	for _, wave := range exportWaves(lps) {
+		var (
+			wg     sync.WaitGroup
+			failed int32
+			sem    = make(chan struct{}, exportConcurrency)
+			errs   = make(chan error, len(wave))
+		)
+
+		for _, lp := range wave {
+			wg.Add(1)
+			go func(lp LockedProject) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				// Don't bother starting new work once something has failed.
+				if atomic.LoadInt32(&failed) == 1 {
+					return
+				}
+
+				err := exportProject(basedir, lp, nestedRoots(lp.Ident().ProjectRoot, lps), sm, prune)
+				if err != nil {
+					atomic.StoreInt32(&failed, 1)
+					errs <- err
+				}
+			}(lp)
+		}
+
+		wg.Wait()
+		close(errs)
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportProject exports a single project into the appropriate location
+// beneath basedir. nested holds the roots of other projects that will be
+// exported within this one, as returned by nestedRoots.
+func exportProject(basedir string, lp LockedProject, nested []string, sm SourceManager, prune PruneOptions) error {
+	pr := lp.Ident().ProjectRoot
+	to := filepath.Join(basedir, filepath.FromSlash(string(pr)))
+
+	err := sm.ExportProject(lp.Ident(), lp.Version(), to)
+	if err != nil {
+		return fmt.Errorf("error while exporting %s: %s", pr, err)
+	}
+
+	err = pruneProject(to, lp, prune)
+	if err != nil {
+		return fmt.Errorf("error while pruning %s: %s", pr, err)
+	}
+
+	err = writeExportMetadata(to, lp, nested)
+	if err != nil {
+		return fmt.Errorf("error while writing export metadata for %s: %s", pr, err)
+	}
+
+	return nil
+}
+
+// nestedRoots returns the roots of the projects in lps that are nested beneath
+// pr, as slash-separated paths relative to pr. Their trees are exported into
+// pr's tree, but are not part of pr's content, so they're left out of pr's
+// digest.
+func nestedRoots(pr ProjectRoot, lps []LockedProject) []string {
+	var nested []string
+	for _, lp := range lps {
+		pr2 := string(lp.Ident().ProjectRoot)
+		if pr2 != string(pr) && eqOrSlashedPrefix(pr2, string(pr)) {
+			nested = append(nested, pr2[len(pr)+1:])
+		}
+	}
+	return nested
+}
+
+// exportWaves groups the provided projects into batches that can be safely
+// exported in parallel. Each project lands in the batch after the one holding
+// the deepest of the projects whose root contains its own root.
+func exportWaves(lps []LockedProject) [][]LockedProject {
+	depth := make([]int, len(lps))
+	var max int
+	for k, lp := range lps {
+		for _, lp2 := range lps {
+			pr, pr2 := string(lp.Ident().ProjectRoot), string(lp2.Ident().ProjectRoot)
+			if pr != pr2 && eqOrSlashedPrefix(pr, pr2) {
+				depth[k]++
+			}
+		}
+		if depth[k] > max {
+			max = depth[k]
+		}
+	}
+
+	waves := make([][]LockedProject, max+1)
+	for k, lp := range lps {
+		waves[depth[k]] = append(waves[depth[k]], lp)
+	}
+	return waves
+}
+
+// swapDir moves the directory at src to dest. If something already exists at
+// dest, it is moved aside first, then removed once src is in place; if moving
+// src fails, the original is put back.
+func swapDir(src, dest string) error {
+	if _, err := os.Lstat(dest); os.IsNotExist(err) {
+		return renameWithFallback(src, dest)
+	} else if err != nil {
+		return err
+	}
+
+	old := src + ".old"
+	err := os.Rename(dest, old)
+	if err != nil {
+		return err
+	}
+
+	err = renameWithFallback(src, dest)
+	if err != nil {
+		// Try to put the original back; not much we can do if this fails.
+		os.Rename(old, dest)
+		return err
+	}
+
+	return removeAll(old)
+}
+
 func (r solution) Projects() []LockedProject {
 	return r.p
 }
@@ -72,3 +584,7 @@ func (r solution) Attempts() int {
 func (r solution) InputHash() []byte {
 	return r.hd
 }
+
+func (r solution) Warnings() []error {
+	return r.warn
+}
@@ -1,10 +1,13 @@
 package gps
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -75,12 +78,12 @@ func TestWriteDepTree(t *testing.T) {
 	defer clean()
 
 	// nil lock/result should err immediately
-	err = WriteDepTree(tmp, nil, sm, true)
+	err = WriteDepTree(tmp, nil, sm, PruneNestedVendorDirs)
 	if err == nil {
 		t.Errorf("Should error if nil lock is passed to WriteDepTree")
 	}
 
-	err = WriteDepTree(tmp, r, sm, true)
+	err = WriteDepTree(tmp, r, sm, PruneNestedVendorDirs)
 	if err != nil {
 		t.Errorf("Unexpected error while creating vendor tree: %s", err)
 	}
@@ -96,6 +99,259 @@ func TestWriteDepTree(t *testing.T) {
 	}
 }
 
+// exportSM is a SourceManager that exports a small, synthetic tree for each
+// project, rather than hitting any real sources. Exports for projects in the
+// fail set return an error.
+type exportSM struct {
+	*depspecSourceManager
+	fail map[ProjectRoot]bool
+
+	mu          sync.Mutex
+	active, max int
+	exported    map[ProjectRoot]int
+}
+
+func newExportSM() *exportSM {
+	return &exportSM{
+		depspecSourceManager: newdepspecSM(nil, nil),
+		fail:                 make(map[ProjectRoot]bool),
+		exported:             make(map[ProjectRoot]int),
+	}
+}
+
+func (sm *exportSM) ExportProject(id ProjectIdentifier, v Version, to string) error {
+	sm.mu.Lock()
+	sm.active++
+	sm.exported[id.ProjectRoot]++
+	if sm.active > sm.max {
+		sm.max = sm.active
+	}
+	sm.mu.Unlock()
+	defer func() {
+		sm.mu.Lock()
+		sm.active--
+		sm.mu.Unlock()
+	}()
+
+	if sm.fail[id.ProjectRoot] {
+		return fmt.Errorf("export of %s failed", id.ProjectRoot)
+	}
+
+	for path, body := range exportSMFiles {
+		path = filepath.Join(to, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(path, []byte(body), 0666)
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(to, "version"), []byte(v.String()), 0666)
+}
+
+// exportSMFiles is the tree written out for every project by exportSM, in
+// addition to a "version" file containing the exported version.
+var exportSMFiles = map[string]string{
+	"root.go":                 "package root\n",
+	"root_test.go":            "package root\n",
+	"LICENSE":                 "license text\n",
+	"README.md":               "readme\n",
+	"sub/sub.go":              "package sub\n",
+	"sub/sub_test.go":         "package sub\n",
+	"sub/testdata/data.json":  "{}\n",
+	"unused/unused.go":        "package unused\n",
+	"unused/NOTICE":           "notice text\n",
+	"vendor/foo/foo.go":       "package foo\n",
+	"vendor/foo/foo_amd64.s":  "\n",
+	"vendor/foo/COPYING.txt":  "copying text\n",
+	"vendor/foo/foo_cgo.c":    "\n",
+	"vendor/foo/data/foo.dat": "\n",
+}
+
+func mkExportLock(roots ...string) SimpleLock {
+	l := make(SimpleLock, 0, len(roots))
+	for _, r := range roots {
+		l = append(l, NewLockedProject(mkPI(r), NewVersion("1.0.0").Is(Revision("rev-"+r)), []string{"."}))
+	}
+	return l
+}
+
+func TestWriteDepTreeParallel(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetreepar")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	var roots []string
+	for i := 0; i < 3*exportConcurrency; i++ {
+		roots = append(roots, fmt.Sprintf("github.com/sdboyer/proj%v", i))
+	}
+	// Nested roots have to wait for their parent
+	roots = append(roots, "github.com/sdboyer/proj0/nested")
+
+	sm := newExportSM()
+	vendor := filepath.Join(tmp, "vendor")
+	err = WriteDepTree(vendor, mkExportLock(roots...), sm, PruneNestedVendorDirs)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing dep tree: %s", err)
+	}
+
+	if sm.max > exportConcurrency {
+		t.Errorf("Expected at most %v concurrent exports, saw %v", exportConcurrency, sm.max)
+	}
+
+	for _, r := range roots {
+		dir := filepath.Join(vendor, filepath.FromSlash(r))
+		if _, err = os.Stat(filepath.Join(dir, "version")); err != nil {
+			t.Errorf("Expected %s to have been exported: %s", r, err)
+		}
+		if _, err = os.Stat(filepath.Join(dir, "vendor")); !os.IsNotExist(err) {
+			t.Errorf("Expected nested vendor dir to have been stripped from %s", r)
+		}
+	}
+
+	// Nothing but the vendor dir itself should be left in the parent
+	fis, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		t.Errorf("Expected only the vendor dir to remain after writing, found %v entries", len(fis))
+	}
+}
+
+func TestWriteDepTreeFailureKeepsOld(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetreefail")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sm := newExportSM()
+	vendor := filepath.Join(tmp, "vendor")
+	err = WriteDepTree(vendor, mkExportLock("github.com/sdboyer/old"), sm, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing initial dep tree: %s", err)
+	}
+
+	sm.fail["github.com/sdboyer/bad"] = true
+	err = WriteDepTree(vendor, mkExportLock("github.com/sdboyer/new", "github.com/sdboyer/bad"), sm, 0)
+	if err == nil {
+		t.Fatal("Expected an error when an export fails")
+	}
+
+	if _, err = os.Stat(filepath.Join(vendor, "github.com", "sdboyer", "old", "version")); err != nil {
+		t.Errorf("Expected previous vendor tree to be intact after failed write: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(vendor, "github.com", "sdboyer", "new")); !os.IsNotExist(err) {
+		t.Errorf("Expected no part of the failed write to be visible in the vendor tree")
+	}
+
+	fis, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		t.Errorf("Expected temporary dirs to be cleaned up after a failed write, found %v entries", len(fis))
+	}
+
+	// And a successful write replaces the old tree wholesale
+	delete(sm.fail, "github.com/sdboyer/bad")
+	err = WriteDepTree(vendor, mkExportLock("github.com/sdboyer/new"), sm, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing dep tree: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(vendor, "github.com", "sdboyer", "new", "version")); err != nil {
+		t.Errorf("Expected new project to be present after successful write: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(vendor, "github.com", "sdboyer", "old")); !os.IsNotExist(err) {
+		t.Errorf("Expected old project to be gone after successful write")
+	}
+}
+
+func TestUpdateDepTree(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "updatetree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sm := newExportSM()
+	vendor := filepath.Join(tmp, "vendor")
+	old := mkExportLock(
+		"github.com/sdboyer/same",
+		"github.com/sdboyer/bump",
+		"github.com/sdboyer/bump/nested",
+		"github.com/sdboyer/gone",
+		"github.com/sdboyer/gone/nested",
+		"github.com/sdboyer/pkgs",
+	)
+	err = WriteDepTree(vendor, old, sm, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing initial dep tree: %s", err)
+	}
+
+	new := SimpleLock{
+		old[0],
+		NewLockedProject(mkPI("github.com/sdboyer/bump"), NewVersion("2.0.0").Is(Revision("rev2")), []string{"."}),
+		old[2],
+		old[4],
+		NewLockedProject(mkPI("github.com/sdboyer/pkgs"), old[5].Version(), []string{".", "foo"}),
+		NewLockedProject(mkPI("github.com/sdboyer/added"), NewVersion("1.0.0").Is(Revision("rev1")), []string{"."}),
+	}
+
+	sm.exported = make(map[ProjectRoot]int)
+	err = UpdateDepTree(vendor, old, new, sm, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while updating dep tree: %s", err)
+	}
+
+	// The unchanged project should not have been touched, but everything else
+	// that's still in the lock should have been re-exported
+	wantex := map[ProjectRoot]int{
+		"github.com/sdboyer/bump":        1,
+		"github.com/sdboyer/bump/nested": 1,
+		"github.com/sdboyer/gone/nested": 1,
+		"github.com/sdboyer/pkgs":        1,
+		"github.com/sdboyer/added":       1,
+	}
+	if !reflect.DeepEqual(sm.exported, wantex) {
+		t.Errorf("Did not re-export the expected set of projects:\n\t(GOT): %v\n\t(WNT): %v", sm.exported, wantex)
+	}
+
+	for _, lp := range new {
+		dir := filepath.Join(vendor, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		b, err := ioutil.ReadFile(filepath.Join(dir, "version"))
+		if err != nil {
+			t.Errorf("Expected %s to be present after update: %s", lp.Ident().ProjectRoot, err)
+			continue
+		}
+		if string(b) != lp.Version().String() {
+			t.Errorf("Expected %s to be at %s after update, but was at %s", lp.Ident().ProjectRoot, lp.Version(), string(b))
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(vendor, "github.com", "sdboyer", "gone", "version")); !os.IsNotExist(err) {
+		t.Errorf("Expected removed project to have been deleted from the tree")
+	}
+
+	// A failed update leaves the tree alone
+	sm.fail["github.com/sdboyer/bad"] = true
+	err = UpdateDepTree(vendor, new, append(new[:1:1], mkExportLock("github.com/sdboyer/bad")...), sm, 0)
+	if err == nil {
+		t.Fatal("Expected an error when an export fails")
+	}
+	for _, lp := range new {
+		dir := filepath.Join(vendor, filepath.FromSlash(string(lp.Ident().ProjectRoot)))
+		if _, err = os.Stat(filepath.Join(dir, "version")); err != nil {
+			t.Errorf("Expected %s to be untouched after failed update: %s", lp.Ident().ProjectRoot, err)
+		}
+	}
+}
+
 func BenchmarkCreateVendorTree(b *testing.B) {
 	// We're fs-bound here, so restrict to single parallelism
 	b.SetParallelism(1)
@@ -128,7 +384,7 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 			// ease manual inspection
 			os.RemoveAll(exp)
 			b.StartTimer()
-			err = WriteDepTree(exp, r, sm, true)
+			err = WriteDepTree(exp, r, sm, PruneNestedVendorDirs)
 			b.StopTimer()
 			if err != nil {
 				b.Errorf("unexpected error after %v iterations: %s", i, err)
@@ -140,3 +396,152 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 	sm.Release()
 	os.RemoveAll(tmp) // comment this to leave temp dir behind for inspection
 }
+
+func TestWriteDepTreeMetadata(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writetreemeta")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := SimpleLock{
+		NewLockedProject(mkPI("github.com/sdboyer/semver"), NewVersion("1.0.0").Is(Revision("rev1")), []string{".", "sub"}),
+		NewLockedProject(ProjectIdentifier{ProjectRoot: "github.com/sdboyer/branch", Source: "https://github.com/fork/branch"}, NewBranch("master").Is(Revision("rev2")), nil),
+		NewLockedProject(mkPI("github.com/sdboyer/rev"), Revision("rev3"), nil),
+	}
+
+	vendor := filepath.Join(tmp, "vendor")
+	err = WriteDepTree(vendor, l, newExportSM(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing dep tree: %s", err)
+	}
+
+	want := []ExportMetadata{
+		{
+			ProjectRoot: "github.com/sdboyer/semver",
+			Version:     "1.0.0",
+			VersionType: "semver",
+			Revision:    "rev1",
+			Packages:    []string{".", "sub"},
+		},
+		{
+			ProjectRoot: "github.com/sdboyer/branch",
+			Source:      "https://github.com/fork/branch",
+			Version:     "master",
+			VersionType: "branch",
+			Revision:    "rev2",
+		},
+		{
+			ProjectRoot: "github.com/sdboyer/rev",
+			Revision:    "rev3",
+		},
+	}
+
+	for _, w := range want {
+		dir := filepath.Join(vendor, filepath.FromSlash(string(w.ProjectRoot)))
+		md, err := ReadExportMetadata(dir)
+		if err != nil {
+			t.Errorf("Failed to read export metadata for %s: %s", w.ProjectRoot, err)
+			continue
+		}
+
+		w.Digest, err = DigestTree(dir)
+		if err != nil {
+			t.Fatalf("Failed to digest %s: %s", dir, err)
+		}
+		if !reflect.DeepEqual(md, w) {
+			t.Errorf("Export metadata for %s did not match expectations:\n\t(GOT): %#v\n\t(WNT): %#v", w.ProjectRoot, md, w)
+		}
+	}
+}
+
+func TestVerifyDepTree(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "verifytree")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := mkExportLock(
+		"github.com/sdboyer/ok",
+		"github.com/sdboyer/missing",
+		"github.com/sdboyer/modified",
+		"github.com/sdboyer/wrongver",
+		"github.com/sdboyer/nodata",
+		"github.com/sdboyer/lockdigest",
+		"github.com/sdboyer/ok/nested",
+		"github.com/sdboyer/badmeta",
+	)
+
+	vendor := filepath.Join(tmp, "vendor")
+	err = WriteDepTree(vendor, l, newExportSM(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error while writing dep tree: %s", err)
+	}
+
+	pdir := func(name string) string {
+		return filepath.Join(vendor, "github.com", "sdboyer", name)
+	}
+
+	// Record the digest of one project in the lock, then strip its metadata
+	md, err := ReadExportMetadata(pdir("lockdigest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l[5] = l[5].WithDigest(md.Digest)
+	os.Remove(filepath.Join(pdir("lockdigest"), ExportMetadataFile))
+
+	os.RemoveAll(pdir("missing"))
+	ioutil.WriteFile(filepath.Join(pdir("modified"), "root.go"), []byte("package changed\n"), 0666)
+	l[3] = NewLockedProject(mkPI("github.com/sdboyer/wrongver"), NewVersion("2.0.0").Is(Revision("otherrev")), nil)
+	os.Remove(filepath.Join(pdir("nodata"), ExportMetadataFile))
+	ioutil.WriteFile(filepath.Join(pdir("badmeta"), ExportMetadataFile), []byte("{not json"), 0666)
+
+	got, err := VerifyDepTree(vendor, l)
+	if err != nil {
+		t.Fatalf("Unexpected error while verifying dep tree: %s", err)
+	}
+
+	want := map[ProjectRoot]VerifyStatus{
+		"github.com/sdboyer/ok":         VerifyOK,
+		"github.com/sdboyer/missing":    VerifyMissing,
+		"github.com/sdboyer/modified":   VerifyModified,
+		"github.com/sdboyer/wrongver":   VerifyWrongVersion,
+		"github.com/sdboyer/nodata":     VerifyNoData,
+		"github.com/sdboyer/lockdigest": VerifyOK,
+		"github.com/sdboyer/ok/nested":  VerifyOK,
+		"github.com/sdboyer/badmeta":    VerifyBadMetadata,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verification results did not match expectations:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// A digest in the lock takes precedence over the one in the metadata
+	l[0] = l[0].WithDigest("1:bogus")
+	got, err = VerifyDepTree(vendor, l)
+	if err != nil {
+		t.Fatalf("Unexpected error while verifying dep tree: %s", err)
+	}
+	if got["github.com/sdboyer/ok"] != VerifyModified {
+		t.Errorf("Expected mismatch with digest in lock to report modification, got %s", got["github.com/sdboyer/ok"])
+	}
+
+	// A nested project's files aren't part of its parent's digest, so
+	// modifying them only affects the nested project
+	ioutil.WriteFile(filepath.Join(pdir("ok"), "nested", "root.go"), []byte("package changed\n"), 0666)
+	got, err = VerifyDepTree(vendor, l)
+	if err != nil {
+		t.Fatalf("Unexpected error while verifying dep tree: %s", err)
+	}
+	if got["github.com/sdboyer/ok/nested"] != VerifyModified {
+		t.Errorf("Expected modified nested project to be reported as modified, got %s", got["github.com/sdboyer/ok/nested"])
+	}
+	l[0] = l[0].WithDigest("")
+	got, err = VerifyDepTree(vendor, l)
+	if err != nil {
+		t.Fatalf("Unexpected error while verifying dep tree: %s", err)
+	}
+	if got["github.com/sdboyer/ok"] != VerifyOK {
+		t.Errorf("Expected modification of a nested project to leave its parent ok, got %s", got["github.com/sdboyer/ok"])
+	}
+}
@@ -2,6 +2,7 @@ package gps
 
 import (
 	"sort"
+	"time"
 
 	"github.com/armon/go-radix"
 )
@@ -12,12 +13,21 @@ type rootdata struct {
 	// Path to the root of the project on which gps is operating.
 	dir string
 
-	// Map of packages to ignore.
+	// Map of packages to ignore. Keys may be package patterns.
 	ig map[string]bool
 
-	// Map of packages to require.
+	// A matcher for the packages in ig, built once, as it's checked often.
+	igm pkgMatcher
+
+	// Map of packages to require. Keys may be package patterns.
 	req map[string]bool
 
+	// Map of tool main packages to the properties declared for them.
+	tools map[string]ProjectProperties
+
+	// Map of projects to the versions of them denied by the root.
+	deny map[ProjectRoot][]Version
+
 	// A ProjectConstraints map containing the validated (guaranteed non-empty)
 	// overrides declared by the root manifest.
 	ovr ProjectConstraints
@@ -38,8 +48,160 @@ type rootdata struct {
 	// A defensively copied instance of the root lock.
 	rl safeLock
 
-	// A defensively copied instance of params.RootPackageTree
+	// A defensively copied instance of params.RootPackageTree, already
+	// restricted to the build target, if there is one.
 	rpt PackageTree
+
+	// The build target against which all PackageTrees are evaluated, if any.
+	bt *BuildTarget
+
+	// The policy for handling import comment mismatches in dependencies.
+	icp ImportCommentPolicy
+
+	// Indicates that cgo is disabled, and packages requiring it are unusable.
+	nocgo bool
+
+	// The default pre-release policy, and the per-project policies declared
+	// by the root manifest.
+	pre  PrereleasePolicy
+	prep map[ProjectRoot]PrereleasePolicy
+
+	// Map of projects to the version schemes declared for them by the root.
+	schemes map[ProjectRoot]VersionScheme
+
+	// The cutoff time and cool-down period requested for the solve, and the
+	// effective cutoff derived from them. Versions committed after the
+	// effective cutoff may not be selected; if it is zero, there is no limit.
+	cutoff   time.Time
+	cooldown time.Duration
+	before   time.Time
+}
+
+// prereleasePolicy returns the pre-release policy in effect for the project.
+func (rd rootdata) prereleasePolicy(pr ProjectRoot) PrereleasePolicy {
+	if p, has := rd.prep[pr]; has {
+		return p
+	}
+	return rd.pre
+}
+
+// checkInternalImports returns an internalImportFailure if any of the root
+// project's packages import an internal package they are not permitted to see.
+func (rd rootdata) checkInternalImports(root atom) error {
+	_, em := rd.rpt.ToReachMap(true, true, false, rd.ig)
+
+	pkgs := make([]string, 0, len(em))
+	for pkg := range em {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		if ierr, is := em[pkg].Err.(*InternalImportError); is {
+			return &internalImportFailure{
+				goal: root,
+				pkg:  pkg,
+				err:  ierr,
+			}
+		}
+	}
+	return nil
+}
+
+// adaptTree applies the build target and cgo settings from the solve
+// parameters to a PackageTree.
+func (rd rootdata) adaptTree(pt PackageTree) PackageTree {
+	if rd.bt != nil {
+		pt = pt.ForTarget(*rd.bt)
+	}
+	if rd.nocgo {
+		pt = pt.withoutCgo()
+	}
+	return pt
+}
+
+// checkCgo returns a cgoRequiredFailure if cgo is disabled, but any of the
+// root project's packages require it. Errors are not backpropagated, so this
+// only reports the packages that actually need cgo, not their importers.
+func (rd rootdata) checkCgo(root atom) error {
+	if !rd.nocgo {
+		return nil
+	}
+
+	_, em := rd.rpt.ToReachMap(true, true, false, rd.ig)
+
+	pkgs := make([]string, 0, len(em))
+	for pkg := range em {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		// Ignored packages are skipped, even if they error
+		if rd.isIgnored(pkg) {
+			continue
+		}
+		if cerr, is := em[pkg].Err.(*CgoRequiredError); is {
+			return &cgoRequiredFailure{
+				goal: root,
+				pkg:  pkg,
+				err:  cerr,
+			}
+		}
+	}
+	return nil
+}
+
+// isIgnored indicates whether the given import path is ignored, either
+// directly or by a package pattern.
+func (rd rootdata) isIgnored(pkg string) bool {
+	return rd.igm.match(pkg)
+}
+
+// addToolReach adds the reach of each of the provided packages that the root
+// has declared as a tool to a reach map and error map computed without main
+// packages, as the solver computes them for dependencies.
+func (rd rootdata) addToolReach(pl []string, ptree PackageTree, rm ReachMap, em map[string]*ProblemImportError) {
+	var tools []string
+	for _, pkg := range pl {
+		if _, is := rd.tools[pkg]; is {
+			tools = append(tools, pkg)
+		}
+	}
+	if len(tools) == 0 {
+		return
+	}
+
+	trm, tem := ptree.ToReachMap(true, false, true, rd.ig)
+	for _, tool := range tools {
+		if ie, has := trm[tool]; has {
+			rm[tool] = ie
+		} else if perr, has := tem[tool]; has {
+			em[tool] = perr
+		}
+	}
+}
+
+// requiredPackagesIn returns the packages from the given reach map (as from a
+// project's PackageTree, computed with the root's ignores) that are required by
+// a package pattern in the root's required packages.
+func (rd rootdata) requiredPackagesIn(rm ReachMap) []string {
+	pats := pkgPatterns(rd.req)
+	if len(pats) == 0 {
+		return nil
+	}
+
+	var pl []string
+	for pkg := range rm {
+		for _, pat := range pats {
+			if matchPkgPattern(pat, pkg) {
+				pl = append(pl, pkg)
+				break
+			}
+		}
+	}
+	sort.Strings(pl)
+	return pl
 }
 
 // rootImportList returns a list of the unique imports from the root data.
@@ -66,13 +228,24 @@ func (rd rootdata) externalImportList() []string {
 			}
 		}
 
+		// Patterns can't be resolved to packages until the projects they
+		// match are selected, so they're skipped here; see
+		// requiredPackagesIn().
 		for r := range rd.req {
-			if !skip[r] {
+			if !skip[r] && !isPkgPattern(r) {
 				reach = append(reach, r)
 			}
 		}
 	}
 
+	// Tools are required packages, too. As main packages, they can't also be
+	// among the root's imports.
+	for tool := range rd.tools {
+		if !rd.req[tool] {
+			reach = append(reach, tool)
+		}
+	}
+
 	sort.Strings(reach)
 	return reach
 }
@@ -190,7 +363,7 @@ func (rd rootdata) rootAtom() atomWithPackages {
 
 	list := make([]string, 0, len(rd.rpt.Packages))
 	for path, pkg := range rd.rpt.Packages {
-		if pkg.Err != nil && !rd.ig[path] {
+		if pkg.Err != nil && !rd.isIgnored(path) {
 			list = append(list, path)
 		}
 	}
@@ -1,5 +1,7 @@
 package gps
 
+import "sort"
+
 // check performs constraint checks on the provided atom. The set of checks
 // differ slightly depending on whether the atom is pkgonly, or if it's the
 // entire project being added for the first time.
@@ -31,10 +33,22 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 		return err
 	}
 
-	_, deps, err := s.getImportsAndConstraintsOf(a)
+	pl, deps, err := s.getImportsAndConstraintsOf(a)
 	if err != nil {
-		// An err here would be from the package fetcher; pass it straight back
-		// TODO(sdboyer) can we traceInfo this?
+		// An err here would be from the package fetcher, an internal import
+		// violation, or a package needing cgo when it's disabled; pass it
+		// straight back
+		// TODO(sdboyer) can we traceInfo the package fetcher errors?
+		switch err.(type) {
+		case *internalImportFailure, *cgoRequiredFailure:
+			s.traceInfo(err)
+		}
+		s.mtr.pop()
+		return err
+	}
+
+	if err := s.checkImportComments(a, pl); err != nil {
+		s.traceInfo(err)
 		s.mtr.pop()
 		return err
 	}
@@ -70,8 +84,12 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 			s.mtr.pop()
 			return err
 		}
+	}
 
-		// TODO(sdboyer) add check that fails if adding this atom would create a loop
+	if err := s.checkImportCycles(a, pl); err != nil {
+		s.traceInfo(err)
+		s.mtr.pop()
+		return err
 	}
 
 	s.mtr.pop()
@@ -145,6 +163,35 @@ func (s *solver) checkRequiredPackagesExist(a atomWithPackages) error {
 	return nil
 }
 
+// checkImportComments ensures that, if import comments are being enforced, none
+// of the packages required from the atom (including those reached internally)
+// have import comments that disagree with the path they're imported under.
+func (s *solver) checkImportComments(a atomWithPackages, pl []string) error {
+	if s.rd.icp != ImportCommentsEnforce {
+		return nil
+	}
+
+	ptree, err := s.b.ListPackages(a.a.id, a.a.v)
+	if err != nil {
+		// TODO(sdboyer) handle this more gracefully
+		return err
+	}
+
+	if errs := ptree.importCommentErrors(pl); len(errs) > 0 {
+		// The packages are being imported under the wrong path by the
+		// projects that depend on them, so those are what need to change.
+		for _, dep := range s.sel.getDependenciesOn(a.a.id) {
+			s.fail(dep.depender.id)
+		}
+
+		return &importCommentFailure{
+			goal: a.a,
+			errs: errs,
+		}
+	}
+	return nil
+}
+
 // checkDepsConstraintsAllowable checks that the constraints of an atom on a
 // given dep are valid with respect to existing constraints.
 func (s *solver) checkDepsConstraintsAllowable(a atomWithPackages, cdep completeDep) error {
@@ -286,3 +333,180 @@ func (s *solver) checkRevisionExists(a atomWithPackages, cdep completeDep) error
 		r: r,
 	}
 }
+
+// checkImportCycles ensures that selecting the atom's packages would not create
+// a package import cycle spanning more than one project.
+//
+// The go tool rejects all import cycles, but one contained entirely within a
+// single project can't be resolved by choosing different versions, so only
+// cross-project cycles are treated as a failure.
+func (s *solver) checkImportCycles(a atomWithPackages, pl []string) error {
+	ptree, err := s.b.ListPackages(a.a.id, a.a.v)
+	if err != nil {
+		// TODO(sdboyer) handle this more gracefully
+		return err
+	}
+
+	// Temporarily add the new packages to the import graph of the selected
+	// ones. Imports of packages that haven't been selected yet are dead ends
+	// for now; if they do close a cycle, it'll be caught when they're selected.
+	s.pg.add(a.a.id, ptree, pl, s.rd.isIgnored)
+	cycle := findImportCycle(s.pg.imports, s.pg.owner, pl)
+	var owners []ProjectIdentifier
+	for _, pkg := range cycle {
+		owners = append(owners, s.pg.owner[pkg])
+	}
+	s.pg.remove(pl)
+
+	if cycle == nil {
+		return nil
+	}
+
+	// Every other project in the cycle is implicated in the failure
+	for _, id := range owners {
+		if !id.eq(a.a.id) {
+			s.fail(id)
+		}
+	}
+
+	return &importCycleFailure{
+		goal:  a.a,
+		cycle: cycle,
+	}
+}
+
+// findImportCycle searches the provided import graph for a cycle that passes
+// through at least one of the from packages, and through packages from more
+// than one project. If one is found, it is returned as a path beginning and
+// ending with the same package; otherwise, nil is returned.
+func findImportCycle(graph map[string][]string, owner map[string]ProjectIdentifier, from []string) []string {
+	// Tarjan's algorithm identifies the strongly connected components of the
+	// graph; any component containing more than one project has a
+	// cross-project cycle within it.
+	var (
+		stack   []string
+		counter int
+		cycle   []string
+	)
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	isFrom := make(map[string]bool, len(from))
+	for _, pkg := range from {
+		isFrom[pkg] = true
+	}
+
+	var strongconnect func(string)
+	strongconnect = func(pkg string) {
+		index[pkg], low[pkg] = counter, counter
+		counter++
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+
+		for _, imp := range graph[pkg] {
+			if _, in := graph[imp]; !in {
+				continue
+			}
+
+			if _, seen := index[imp]; !seen {
+				strongconnect(imp)
+				if low[imp] < low[pkg] {
+					low[pkg] = low[imp]
+				}
+			} else if onStack[imp] && index[imp] < low[pkg] {
+				low[pkg] = index[imp]
+			}
+		}
+
+		if low[pkg] != index[pkg] {
+			return
+		}
+
+		// pkg is the root of a component; pop it off the stack
+		scc := make(map[string]bool)
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			scc[top] = true
+			if top == pkg {
+				break
+			}
+		}
+
+		if cycle == nil {
+			cycle = crossProjectCycle(graph, owner, scc, isFrom)
+		}
+	}
+
+	sorted := make([]string, len(from))
+	copy(sorted, from)
+	sort.Strings(sorted)
+	for _, pkg := range sorted {
+		if _, in := graph[pkg]; !in {
+			continue
+		}
+		if _, seen := index[pkg]; !seen {
+			strongconnect(pkg)
+		}
+	}
+
+	return cycle
+}
+
+// crossProjectCycle returns a cycle within the provided strongly connected
+// component that starts and ends at one of the from packages and passes
+// through another project, or nil if the component admits no such cycle.
+func crossProjectCycle(graph map[string][]string, owner map[string]ProjectIdentifier, scc map[string]bool, isFrom map[string]bool) []string {
+	var start string
+	for pkg := range scc {
+		if isFrom[pkg] && (start == "" || pkg < start) {
+			start = pkg
+		}
+	}
+	if start == "" || len(scc) < 2 {
+		return nil
+	}
+
+	there := sccPath(graph, scc, start, func(pkg string) bool {
+		return owner[pkg].ProjectRoot != owner[start].ProjectRoot
+	})
+	if there == nil {
+		return nil
+	}
+
+	back := sccPath(graph, scc, there[len(there)-1], func(pkg string) bool {
+		return pkg == start
+	})
+	return append(there, back[1:]...)
+}
+
+// sccPath performs a breadth-first search from the start package, restricted
+// to the strongly connected component, and returns the shortest path to a
+// package satisfying the goal func, or nil if there is none.
+func sccPath(graph map[string][]string, scc map[string]bool, start string, goal func(string) bool) []string {
+	prev := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		for _, imp := range graph[pkg] {
+			if _, seen := prev[imp]; seen || !scc[imp] {
+				continue
+			}
+			prev[imp] = pkg
+
+			if goal(imp) {
+				path := []string{imp}
+				for p := pkg; p != ""; p = prev[p] {
+					path = append([]string{p}, path...)
+				}
+				return path
+			}
+			queue = append(queue, imp)
+		}
+	}
+
+	return nil
+}
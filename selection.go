@@ -205,3 +205,57 @@ outer:
 		}
 	}
 }
+
+// pkgGraph is the import graph of the packages in the current selection. The
+// solver keeps it up to date as atoms are selected and unselected, so that
+// checking a new atom for import cycles doesn't require rebuilding the graph
+// from every selected project's PackageTree.
+type pkgGraph struct {
+	// imports maps each selected package to the packages it imports.
+	imports map[string][]string
+	// owner maps each selected package to the project it came from.
+	owner map[string]ProjectIdentifier
+	// refs counts the number of selections that have added each package, as
+	// the same package can be selected more than once from a single atom.
+	refs map[string]int
+}
+
+func newPkgGraph() *pkgGraph {
+	return &pkgGraph{
+		imports: make(map[string][]string),
+		owner:   make(map[string]ProjectIdentifier),
+		refs:    make(map[string]int),
+	}
+}
+
+// add records the imports of each of the provided packages from the
+// PackageTree of the project with the given id. Packages that are ignored, or
+// that are missing or have errors in the PackageTree, are skipped.
+func (g *pkgGraph) add(id ProjectIdentifier, ptree PackageTree, pkgs []string, ignored func(string) bool) {
+	for _, pkg := range pkgs {
+		if ignored(pkg) {
+			continue
+		}
+		if poe, has := ptree.Packages[pkg]; has && poe.Err == nil {
+			g.imports[pkg] = poe.P.Imports
+			g.owner[pkg] = id
+			g.refs[pkg]++
+		}
+	}
+}
+
+// remove undoes a previous call to add with the same list of packages.
+func (g *pkgGraph) remove(pkgs []string) {
+	for _, pkg := range pkgs {
+		switch g.refs[pkg] {
+		case 0:
+			// Skipped by add
+		case 1:
+			delete(g.imports, pkg)
+			delete(g.owner, pkg)
+			delete(g.refs, pkg)
+		default:
+			g.refs[pkg]--
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package gps
 
 import (
+	"go/build"
 	"reflect"
 	"testing"
 )
@@ -57,3 +58,47 @@ func TestUnselectedRemoval(t *testing.T) {
 		t.Fatalf("wrong item removed from slice:\n\t(GOT): %v\n\t(WNT): %v", u.sl, want)
 	}
 }
+
+func TestPkgGraphAddRemove(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "foo",
+		Packages: map[string]PackageOrErr{
+			"foo": {
+				P: Package{ImportPath: "foo", Name: "foo", Imports: []string{"foo/bar", "baz"}},
+			},
+			"foo/bar": {
+				P: Package{ImportPath: "foo/bar", Name: "bar", Imports: []string{"qux"}},
+			},
+			"foo/bad": {
+				Err: &build.NoGoError{Dir: "foo/bad"},
+			},
+		},
+	}
+	noignore := func(string) bool { return false }
+
+	g := newPkgGraph()
+	g.add(mkPI("foo"), ptree, []string{"foo", "foo/bad"}, noignore)
+	g.add(mkPI("foo"), ptree, []string{"foo", "foo/bar"}, noignore)
+
+	want := map[string][]string{
+		"foo":     {"foo/bar", "baz"},
+		"foo/bar": {"qux"},
+	}
+	if !reflect.DeepEqual(g.imports, want) {
+		t.Fatalf("Unexpected graph after adds:\n\t(GOT): %v\n\t(WNT): %v", g.imports, want)
+	}
+
+	// foo was added twice, so it should survive removing one of the adds
+	g.remove([]string{"foo", "foo/bar"})
+	want = map[string][]string{
+		"foo": {"foo/bar", "baz"},
+	}
+	if !reflect.DeepEqual(g.imports, want) {
+		t.Errorf("Unexpected graph after first remove:\n\t(GOT): %v\n\t(WNT): %v", g.imports, want)
+	}
+
+	g.remove([]string{"foo", "foo/bad"})
+	if len(g.imports) != 0 || len(g.owner) != 0 || len(g.refs) != 0 {
+		t.Errorf("Expected empty graph after removing everything, got %v", g.imports)
+	}
+}
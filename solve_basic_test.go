@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 )
@@ -66,6 +67,7 @@ func nvrSplit(info string) (id ProjectIdentifier, version string, revision Revis
 //
 //  p: create a "plain" (non-semver) version.
 //  b: create a branch version.
+//  d: create a branch version, marked as the default branch.
 //  r: create a revision.
 //
 // No prefix is assumed to indicate a semver version.
@@ -98,6 +100,8 @@ func mkAtom(info string) atom {
 		v = NewVersion(ver[1:])
 	case 'b':
 		v = NewBranch(ver[1:])
+	case 'd':
+		v = newDefaultBranch(ver[1:])
 	default:
 		_, err := semver.NewVersion(ver)
 		if err != nil {
@@ -129,6 +133,23 @@ func mkAtom(info string) atom {
 //
 // If no leading character is used, a semver constraint is assumed.
 func mkPCstrnt(info string) ProjectConstraint {
+	// Unions and exclusions are written in the syntax understood by
+	// ParseConstraint, using typed strings for non-semver versions, e.g.
+	// "foo ^2.0.0 || b-master" or "foo ^1.0.0 except sv-1.1.0". The same goes
+	// for version scheme constraints, e.g. "foo vs-calver->=2026.04", and the
+	// default branch constraint, "foo (default branch)".
+	if strings.Contains(info, "||") || strings.Contains(info, " except ") || strings.Contains(info, " vs-") || strings.HasSuffix(info, " (default branch)") {
+		id, ver := nvSplit(info)
+		c, err := ParseConstraint(ver, nil)
+		if err != nil {
+			panic(fmt.Sprintf("Error when parsing constraint '%s': %s (full info: %s)", ver, err, info))
+		}
+		return ProjectConstraint{
+			Ident:      id,
+			Constraint: c,
+		}
+	}
+
 	id, ver, rev := nvrSplit(info)
 
 	var c Constraint
@@ -191,6 +212,12 @@ type depspec struct {
 	deps    []ProjectConstraint
 	devdeps []ProjectConstraint
 	pkgs    []tpkg
+	// versions of this project retracted by this version's manifest
+	retracted []Version
+	// time at which this version was committed, if known
+	t time.Time
+	// version scheme declared by this version's manifest, if any
+	scheme VersionScheme
 }
 
 // mkDepspec creates a depspec by processing a series of strings, each of which
@@ -202,7 +229,12 @@ type depspec struct {
 // mkPDep for details.
 //
 // If a string other than the first includes a "(dev) " prefix, it will be
-// treated as a test-only dependency.
+// treated as a test-only dependency. A "(retract) " prefix instead indicates a
+// version of the depspec's own project that its manifest retracts, written
+// as for mkAtom, e.g. "(retract) 1.1.0", a "(time) " prefix gives the date
+// on which the version was committed, e.g. "(time) 2016-05-01", and a
+// "(scheme) " prefix names the registered VersionScheme that the manifest
+// declares, e.g. "(scheme) calver".
 func mkDepspec(pi string, deps ...string) depspec {
 	pa := mkAtom(pi)
 	if string(pa.id.ProjectRoot) != pa.id.Source && pa.id.Source != "" {
@@ -215,6 +247,27 @@ func mkDepspec(pi string, deps ...string) depspec {
 	}
 
 	for _, dep := range deps {
+		if strings.HasPrefix(dep, "(retract) ") {
+			ds.retracted = append(ds.retracted, mkAtom(string(ds.n)+" "+strings.TrimPrefix(dep, "(retract) ")).v)
+			continue
+		}
+		if strings.HasPrefix(dep, "(time) ") {
+			t, err := time.Parse("2006-01-02", strings.TrimPrefix(dep, "(time) "))
+			if err != nil {
+				panic(fmt.Sprintf("bad time in depspec: %s", err))
+			}
+			ds.t = t
+			continue
+		}
+		if strings.HasPrefix(dep, "(scheme) ") {
+			vs, has := versionSchemeNamed(strings.TrimPrefix(dep, "(scheme) "))
+			if !has {
+				panic(fmt.Sprintf("unknown version scheme in depspec: %s", dep))
+			}
+			ds.scheme = vs
+			continue
+		}
+
 		var sl *[]ProjectConstraint
 		if strings.HasPrefix(dep, "(dev) ") {
 			dep = strings.TrimPrefix(dep, "(dev) ")
@@ -236,6 +289,14 @@ func mkDep(atom, pdep string, pl ...string) dependency {
 	}
 }
 
+// mkPreDep is like mkDep, but applies the pre-release policy to the
+// dependency's constraint, as the solver does.
+func mkPreDep(atom, pdep string, p PrereleasePolicy, pl ...string) dependency {
+	d := mkDep(atom, pdep, pl...)
+	d.dep.Constraint = withPrereleasePolicy(d.dep.Constraint, p)
+	return d
+}
+
 func mkADep(atom, pdep string, c Constraint, pl ...string) dependency {
 	return dependency{
 		depender: mkAtom(atom),
@@ -413,6 +474,18 @@ type basicFixture struct {
 	changeall bool
 	// individual projects to change
 	changelist []ProjectRoot
+	// versions denied by the root, if any
+	deny map[ProjectRoot][]Version
+	// solve-level and per-project pre-release policies
+	pre  PrereleasePolicy
+	prep map[ProjectRoot]PrereleasePolicy
+	// cutoff time and cool-down period for version commit times
+	cutoff   time.Time
+	cooldown time.Duration
+	// version schemes declared by the root, if any
+	schemes map[ProjectRoot]VersionScheme
+	// warnings expected from the solution, if any
+	warn []error
 }
 
 func (f basicFixture) name() string {
@@ -433,9 +506,12 @@ func (f basicFixture) solution() map[ProjectIdentifier]LockedProject {
 
 func (f basicFixture) rootmanifest() RootManifest {
 	return simpleRootManifest{
-		c:   pcSliceToMap(f.ds[0].deps),
-		tc:  pcSliceToMap(f.ds[0].devdeps),
-		ovr: f.ovr,
+		c:       pcSliceToMap(f.ds[0].deps),
+		tc:      pcSliceToMap(f.ds[0].devdeps),
+		ovr:     f.ovr,
+		deny:    f.deny,
+		pre:     f.prep,
+		schemes: f.schemes,
 	}
 }
 
@@ -800,7 +876,10 @@ var basicFixtures = map[string]basicFixture{
 			mkDepspec("foo 1.0.0 foorev", "bar <2.0.0"),
 			mkDepspec("foo 2.0.0", "bar <3.0.0"),
 			mkDepspec("bar 2.0.0", "baz <3.0.0"),
-			mkDepspec("baz 2.0.0", "foo >1.0.0"),
+			// baz can't depend on foo here, as basic fixtures map project
+			// deps directly to imports, and foo -> bar -> baz -> foo would be
+			// an import cycle across projects
+			mkDepspec("baz 2.0.0"),
 		},
 		l: mklock(
 			"foo 1.0.0 foorev",
@@ -883,6 +962,43 @@ var basicFixtures = map[string]basicFixture{
 			"bar 1.0.1",
 		),
 	},
+	"default branch constraint selects the default branch, whatever its name": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo (default branch)"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo bmaster"),
+			mkDepspec("foo dtrunk"),
+		},
+		r: mksolution(
+			"foo dtrunk",
+		),
+	},
+	"default branch constraint keeps a locked default branch on its old rev": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo (default branch)"),
+			mkDepspec("foo bmaster masterrev"),
+			mkDepspec("foo dtrunk newrev"),
+		},
+		l: mklock(
+			"foo btrunk oldrev",
+		),
+		r: mksolution(
+			"foo dtrunk oldrev",
+		),
+	},
+	"default branch constraint breaks a lock to a non-default branch": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo (default branch)"),
+			mkDepspec("foo bmaster masterrev"),
+			mkDepspec("foo dtrunk newrev"),
+		},
+		l: mklock(
+			"foo bmaster oldrev",
+		),
+		r: mksolution(
+			"foo dtrunk newrev",
+		),
+	},
 	"lock to branch on old rev keeps old rev": {
 		ds: []depspec{
 			mkDepspec("root 0.0.0", "foo bmaster"),
@@ -912,6 +1028,398 @@ var basicFixtures = map[string]basicFixture{
 			"foo ptaggerino oldrev",
 		),
 	},
+	"union constraint allows a branch": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^2.0.0 || b-master"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo bmaster"),
+		},
+		r: mksolution(
+			"foo bmaster",
+		),
+	},
+	"union constraint prefers semver over a branch": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.0.0 || b-master"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo bmaster"),
+		},
+		r: mksolution(
+			"foo 1.1.0",
+		),
+	},
+	"exclusion constraint skips excluded version": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.0.0 except sv-1.1.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 2.0.0"),
+		},
+		r: mksolution(
+			"foo 1.0.0",
+		),
+	},
+	"exclusion constraint combines with dependency constraint": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.0.0 except sv-1.2.0", "bar 1.0.0"),
+			mkDepspec("bar 1.0.0", "foo >=1.1.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.2.0"),
+		},
+		r: mksolution(
+			"foo 1.1.0",
+			"bar 1.0.0",
+		),
+	},
+	"excluded revision rules out versions paired with it": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo * except r-badrev"),
+			mkDepspec("foo 1.0.0 goodrev"),
+			mkDepspec("foo 1.1.0 badrev"),
+		},
+		r: mksolution(
+			"foo 1.0.0 goodrev",
+		),
+	},
+	"skip versions retracted by their project": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.2.0", "(retract) 1.1.0", "(retract) 1.2.0"),
+		},
+		r: mksolution(
+			"foo 1.0.0",
+		),
+	},
+	"retractions are only read from the newest version": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0", "(retract) 1.1.0"),
+			mkDepspec("foo 1.2.0", "(retract) 1.2.0"),
+		},
+		r: mksolution(
+			"foo 1.1.0",
+		),
+	},
+	"skip version denied by root": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+		},
+		deny: map[ProjectRoot][]Version{
+			"foo": {NewVersion("1.1.0")},
+		},
+		r: mksolution(
+			"foo 1.0.0",
+		),
+	},
+	"locked retracted version is kept, with a warning": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.2.0", "(retract) 1.1.0"),
+		},
+		l: mklock(
+			"foo 1.1.0",
+		),
+		r: mksolution(
+			"foo 1.1.0",
+		),
+		warn: []error{
+			&RetractedVersionError{
+				Ident:   mkPI("foo"),
+				Version: NewVersion("1.1.0"),
+			},
+		},
+	},
+	"locked retracted version is changed with change all": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo <1.2.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.2.0", "(retract) 1.1.0"),
+		},
+		l: mklock(
+			"foo 1.1.0",
+		),
+		changeall: true,
+		r: mksolution(
+			"foo 1.0.0",
+		),
+	},
+	"fail when all allowed versions are retracted": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.0.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 2.0.0", "(retract) 1.1.0"),
+		},
+		deny: map[ProjectRoot][]Version{
+			"foo": {NewVersion("1.0.0")},
+		},
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("2.0.0"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 2.0.0"),
+						failparent: []dependency{mkDep("root", "foo ^1.0.0", "foo")},
+						c:          mkSVC("^1.0.0"),
+					},
+				},
+				{
+					v: NewVersion("1.1.0"),
+					f: &retractedVersionFailure{
+						goal: mkAtom("foo 1.1.0"),
+					},
+				},
+				{
+					v: NewVersion("1.0.0"),
+					f: &retractedVersionFailure{
+						goal: mkAtom("foo 1.0.0"),
+						root: true,
+					},
+				},
+			},
+		},
+	},
+	"prereleases allowed by default": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.2.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.3.0-rc1"),
+		},
+		r: mksolution(
+			"foo 1.3.0-rc1",
+		),
+	},
+	"fail with prereleases never allowed": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.2.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.3.0-rc1"),
+		},
+		pre: PrereleasesNever,
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.1.0"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 1.1.0"),
+						failparent: []dependency{mkPreDep("root", "foo ^1.2.0", PrereleasesNever, "foo")},
+						c:          withPrereleasePolicy(mkSVC("^1.2.0"), PrereleasesNever),
+					},
+				},
+				{
+					v: NewVersion("1.3.0-rc1"),
+					f: &prereleaseNotAllowedFailure{
+						goal: mkAtom("foo 1.3.0-rc1"),
+						pol:  PrereleasesNever,
+					},
+				},
+			},
+		},
+	},
+	"per-project prerelease policy overrides solve-level policy": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.2.0", "bar ^1.2.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo 1.3.0-rc1"),
+			mkDepspec("bar 1.2.0"),
+			mkDepspec("bar 1.3.0-rc1"),
+		},
+		pre: PrereleasesNever,
+		prep: map[ProjectRoot]PrereleasePolicy{
+			"foo": PrereleasesAllowed,
+		},
+		r: mksolution(
+			"foo 1.3.0-rc1",
+			"bar 1.2.0",
+		),
+	},
+	"prerelease allowed when constraint names one": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo >=1.3.0-rc1, <2.0.0"),
+			mkDepspec("foo 1.3.0-rc2"),
+			mkDepspec("foo 1.4.0-beta"),
+		},
+		prep: map[ProjectRoot]PrereleasePolicy{
+			"foo": PrereleasesIfNamed,
+		},
+		r: mksolution(
+			"foo 1.3.0-rc2",
+		),
+	},
+	"fail unconstrained prerelease when constraint must name one": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 2.0.0-alpha"),
+		},
+		pre: PrereleasesIfNamed,
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("2.0.0-alpha"),
+					f: &prereleaseNotAllowedFailure{
+						goal: mkAtom("foo 2.0.0-alpha"),
+						pol:  PrereleasesIfNamed,
+					},
+				},
+			},
+		},
+	},
+	"skip versions committed after the cutoff": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0", "(time) 2016-01-01"),
+			mkDepspec("foo 1.1.0", "(time) 2016-06-01"),
+			mkDepspec("foo 1.2.0", "(time) 2016-09-01"),
+		},
+		cutoff: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+		r: mksolution(
+			"foo 1.1.0",
+		),
+	},
+	"locked version committed after the cutoff is kept": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *"),
+			mkDepspec("foo 1.0.0", "(time) 2016-01-01"),
+			mkDepspec("foo 1.1.0", "(time) 2016-09-01"),
+		},
+		l: mklock(
+			"foo 1.1.0",
+		),
+		cutoff: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+		r: mksolution(
+			"foo 1.1.0",
+		),
+	},
+	"skip versions committed during the cool-down period": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *", "bar *"),
+			mkDepspec("foo 1.0.0", "(time) 2016-01-01"),
+			mkDepspec("foo 1.1.0", "(time) 2999-01-01"),
+			mkDepspec("bar 1.0.0", "(time) 2016-01-01"),
+			mkDepspec("bar 1.1.0"),
+		},
+		cooldown: 14 * 24 * time.Hour,
+		r: mksolution(
+			"foo 1.0.0",
+			"bar 1.1.0",
+		),
+	},
+	"fail when all allowed versions were committed after the cutoff": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.1.0"),
+			mkDepspec("foo 1.0.0", "(time) 2016-01-01"),
+			mkDepspec("foo 1.1.0", "(time) 2016-09-01"),
+		},
+		cutoff: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.1.0"),
+					f: &versionTooNewFailure{
+						goal:   mkAtom("foo 1.1.0"),
+						t:      time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC),
+						cutoff: time.Date(2016, 7, 1, 0, 0, 0, 0, time.UTC),
+					},
+				},
+				{
+					v: NewVersion("1.0.0"),
+					f: &versionNotAllowedFailure{
+						goal:       mkAtom("foo 1.0.0"),
+						failparent: []dependency{mkDep("root", "foo ^1.1.0", "foo")},
+						c:          mkSVC("^1.1.0"),
+					},
+				},
+			},
+		},
+	},
+	"prefer the newest version in a root-declared scheme": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo vs-release-*"),
+			mkDepspec("foo prelease-2"),
+			mkDepspec("foo prelease-9"),
+			mkDepspec("foo prelease-10"),
+			mkDepspec("foo prelease-11"),
+		},
+		schemes: map[ProjectRoot]VersionScheme{
+			"foo": ReleaseNumbers,
+		},
+		r: mksolution(
+			"foo prelease-11",
+		),
+	},
+	"range constraint in a version scheme": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo vs-calver->=2026.04, <2026.10"),
+			mkDepspec("foo p2026.01.1"),
+			mkDepspec("foo p2026.04.1"),
+			mkDepspec("foo p2026.9.2"),
+			mkDepspec("foo p2026.10"),
+		},
+		schemes: map[ProjectRoot]VersionScheme{
+			"foo": CalVer,
+		},
+		r: mksolution(
+			"foo p2026.9.2",
+		),
+	},
+	"version scheme declared by the project's manifest": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo vs-release-*"),
+			mkDepspec("foo prelease-2", "(scheme) release"),
+			mkDepspec("foo prelease-9", "(scheme) release"),
+			mkDepspec("foo prelease-10", "(scheme) release"),
+			mkDepspec("foo prelease-11", "(scheme) release"),
+		},
+		r: mksolution(
+			"foo prelease-11",
+		),
+	},
+	"downgrade in a version scheme": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo vs-release->release-2"),
+			mkDepspec("foo prelease-11"),
+			mkDepspec("foo prelease-9"),
+			mkDepspec("foo prelease-2"),
+			mkDepspec("foo prelease-10"),
+		},
+		schemes: map[ProjectRoot]VersionScheme{
+			"foo": ReleaseNumbers,
+		},
+		downgrade: true,
+		r: mksolution(
+			"foo prelease-9",
+		),
+	},
+	"major version suffixed projects coexist with the unsuffixed project": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo ^1.0.0", "bar 1.0.0"),
+			mkDepspec("foo 1.0.0"),
+			mkDepspec("foo 1.1.0"),
+			mkDepspec("foo/v2 2.0.0"),
+			mkDepspec("foo/v2 2.1.0"),
+			mkDepspec("bar 1.0.0", "foo/v2 ^2.0.0"),
+		},
+		r: mksolution(
+			"foo 1.1.0",
+			"foo/v2 2.1.0",
+			"bar 1.0.0",
+		),
+	},
 	"includes root package's dev dependencies": {
 		ds: []depspec{
 			mkDepspec("root 1.0.0", "(dev) foo 1.0.0", "(dev) bar 1.0.0"),
@@ -1475,6 +1983,36 @@ func (sm *depspecSourceManager) ListVersions(id ProjectIdentifier) (pi []Version
 	return
 }
 
+func (sm *depspecSourceManager) VersionTimes(id ProjectIdentifier) (map[UnpairedVersion]time.Time, error) {
+	vt := make(map[UnpairedVersion]time.Time)
+	for _, ds := range sm.specs {
+		if id.normalizedSource() != string(ds.n) || ds.t.IsZero() {
+			continue
+		}
+
+		switch tv := ds.v.(type) {
+		case PairedVersion:
+			vt[tv.Unpair()] = ds.t
+		case UnpairedVersion:
+			vt[tv] = ds.t
+		}
+	}
+
+	return vt, nil
+}
+
+func (sm *depspecSourceManager) CommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	return 0, fmt.Errorf("dummy sm doesn't support counting commits")
+}
+
+func (sm *depspecSourceManager) DefaultBranch(id ProjectIdentifier) (PairedVersion, error) {
+	vl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+	return defaultBranchIn(id, vl)
+}
+
 func (sm *depspecSourceManager) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
 	for _, ds := range sm.specs {
 		if id.normalizedSource() == string(ds.n) && r == ds.v {
@@ -1513,6 +2051,11 @@ func (sm *depspecSourceManager) DeduceProjectRoot(ip string) (ProjectRoot, error
 	for _, ds := range sm.allSpecs() {
 		n := string(ds.n)
 		if ip == n || strings.HasPrefix(ip, n+"/") {
+			// As with the real SourceManager, a major version suffix makes
+			// for a distinct project
+			if _, _, has := majorVersionSuffix(n, ip); has {
+				continue
+			}
 			return ProjectRoot(n), nil
 		}
 	}
@@ -1546,7 +2089,11 @@ func (b *depspecBridge) verifyRootDir(path string) error {
 }
 
 func (b *depspecBridge) ListPackages(id ProjectIdentifier, v Version) (PackageTree, error) {
-	return b.sm.(fixSM).ListPackages(id, v)
+	pt, err := b.sm.(fixSM).ListPackages(id, v)
+	if err == nil {
+		pt = b.s.rd.adaptTree(pt)
+	}
+	return pt, err
 }
 
 func (b *depspecBridge) vendorCodeExists(id ProjectIdentifier) (bool, error) {
@@ -1568,6 +2115,14 @@ func (ds depspec) TestDependencyConstraints() ProjectConstraints {
 	return pcSliceToMap(ds.devdeps)
 }
 
+func (ds depspec) RetractedVersions() []Version {
+	return ds.retracted
+}
+
+func (ds depspec) VersionScheme() VersionScheme {
+	return ds.scheme
+}
+
 type fixLock []LockedProject
 
 func (fixLock) SolverVersion() string {
@@ -2,8 +2,8 @@ package gps
 
 import (
 	"fmt"
+	"go/build"
 	"path/filepath"
-	"strings"
 )
 
 // dsp - "depspec with packages"
@@ -22,6 +22,41 @@ func pkg(path string, imports ...string) tpkg {
 	}
 }
 
+// cpkg creates a tpkg with an import comment.
+func cpkg(path, comment string, imports ...string) tpkg {
+	return tpkg{
+		path:    path,
+		comment: comment,
+		imports: imports,
+	}
+}
+
+// cgopkg creates a tpkg for a package that requires cgo.
+func cgopkg(path string, imports ...string) tpkg {
+	return tpkg{
+		path:    path,
+		imports: imports,
+		cgo:     true,
+	}
+}
+
+// nogopkg creates a tpkg for a directory holding only non-Go source files.
+func nogopkg(path string) tpkg {
+	return tpkg{
+		path: path,
+		nogo: true,
+	}
+}
+
+// mpkg creates a tpkg for a main package.
+func mpkg(path string, imports ...string) tpkg {
+	return tpkg{
+		path:    path,
+		imports: imports,
+		main:    true,
+	}
+}
+
 func init() {
 	for k, fix := range bimodalFixtures {
 		// Assign the name into the fixture itself
@@ -203,8 +238,10 @@ var bimodalFixtures = map[string]bimodalFixture{
 				pkg("root", "root/foo"),
 				pkg("root/foo", "a", "b"),
 			),
+			// a must not import c, as c imports a; that would be an import
+			// cycle across projects
 			dsp(mkDepspec("a 1.0.0"),
-				pkg("a", "c"),
+				pkg("a"),
 			),
 			dsp(mkDepspec("a 1.1.0"),
 				pkg("a"),
@@ -483,6 +520,262 @@ var bimodalFixtures = map[string]bimodalFixture{
 			},
 		},
 	},
+	// Importing an internal package from within the same project is fine
+	"internal pkg import within project": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/internal/foo"),
+				pkg("a/internal/foo", "b"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+		},
+		r: mksolution(
+			mklp("a 1.0.0", ".", "internal/foo"),
+			"b 1.0.0",
+		),
+	},
+	// A dep importing another project's internal package must be rejected
+	"fail dep imports other project's internal pkg": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/foo"),
+				pkg("a/foo", "b/internal/bar"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/internal/bar"),
+			),
+		},
+		fail: &noVersionError{
+			pn: mkPI("a"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &internalImportFailure{
+						goal: mkAtom("a 1.0.0"),
+						pkg:  "a",
+						err: &InternalImportError{
+							ImportPath: "a/foo",
+							Internal:   "b/internal/bar",
+						},
+					},
+				},
+			},
+		},
+	},
+	// A root importing another project's internal package is rejected outright
+	"fail root imports other project's internal pkg": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "root/foo"),
+				pkg("root/foo", "a/internal/bar"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a"),
+				pkg("a/internal/bar"),
+			),
+		},
+		fail: &internalImportFailure{
+			goal: mkAtom("root"),
+			pkg:  "root/foo",
+			err: &InternalImportError{
+				ImportPath: "root/foo",
+				Internal:   "a/internal/bar",
+			},
+		},
+	},
+	// Import comments matching the import path are fine
+	"import comment matches": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				cpkg("a", "a"),
+			),
+		},
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
+	// A version with a mismatched import comment is rejected in favor of one
+	// without
+	"import comment mismatch skips version": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				cpkg("a", "canonical/a"),
+			),
+			dsp(mkDepspec("a 0.9.0"),
+				pkg("a"),
+			),
+		},
+		icp: ImportCommentsEnforce,
+		r: mksolution(
+			"a 0.9.0",
+		),
+	},
+	// Without a policy, import comments are ignored
+	"import comment mismatch ignored by default": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				cpkg("a", "canonical/a"),
+			),
+			dsp(mkDepspec("a 0.9.0"),
+				pkg("a"),
+			),
+		},
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
+	// A mismatch is blamed on the depender importing the package, so the
+	// solver backtracks to a version of it that doesn't
+	"import comment mismatch fails depender": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "b"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b", "a"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				cpkg("a", "canonical/a"),
+			),
+		},
+		icp: ImportCommentsEnforce,
+		r: mksolution(
+			"b 1.0.0",
+		),
+	},
+	// Mismatches in internally-reached packages are caught, too
+	"fail import comment mismatch": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/foo"),
+				cpkg("a/foo", "canonical/a/foo"),
+			),
+		},
+		icp: ImportCommentsEnforce,
+		fail: &noVersionError{
+			pn: mkPI("a"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &importCommentFailure{
+						goal: mkAtom("a 1.0.0"),
+						errs: []*ImportCommentError{
+							{
+								ImportPath:  "a/foo",
+								CommentPath: "canonical/a/foo",
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	// With the warn policy, mismatches are permitted
+	"import comment mismatch warns": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				cpkg("a", "canonical/a"),
+			),
+			dsp(mkDepspec("a 0.9.0"),
+				pkg("a"),
+			),
+		},
+		icp: ImportCommentsWarn,
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
+	// Import cycles within a single project are not the solver's concern
+	"import cycle within project": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/foo"),
+				pkg("a/foo", "a"),
+			),
+		},
+		r: mksolution(
+			mklp("a 1.0.0", ".", "foo"),
+		),
+	},
+	// A version that would create an import cycle with another project is
+	// rejected in favor of one that wouldn't
+	"import cycle across projects skips version": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "b"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b", "a"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+		),
+	},
+	// Cross-project import cycles are reported with the full cycle path
+	"fail import cycle across projects": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "b/foo"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b/foo", "b/bar"),
+				pkg("b/bar", "a"),
+			),
+		},
+		fail: &noVersionError{
+			pn: mkPI("b"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &importCycleFailure{
+						goal:  mkAtom("b 1.0.0"),
+						cycle: []string{"b/bar", "a", "b/foo", "b/bar"},
+					},
+				},
+			},
+		},
+	},
 	// Check ignores on the root project
 	"ignore in double-subpkg": {
 		ds: []depspec{
@@ -523,6 +816,30 @@ var bimodalFixtures = map[string]bimodalFixture{
 			"a 1.0.0",
 		),
 	},
+	// Ignore patterns apply to both root and dep pkgs
+	"ignore pattern": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "root/foo", "root/bar"),
+				pkg("root/foo", "a"),
+				pkg("root/bar", "c"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/bar"),
+				pkg("a/bar", "b"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+			),
+			dsp(mkDepspec("c 1.0.0"),
+				pkg("c"),
+			),
+		},
+		ignore: []string{"*/bar"},
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
 	// Preferred version, as derived from a dep's lock, is attempted first
 	"respect prefv, simple case": {
 		ds: []depspec{
@@ -865,6 +1182,252 @@ var bimodalFixtures = map[string]bimodalFixture{
 			mklp("baz 1.0.0", "qux"),
 		),
 	},
+	"require pattern": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "foo")),
+			dsp(mkDepspec("foo 1.0.0"),
+				pkg("foo"),
+				pkg("foo/testutil", "bar"),
+				pkg("foo/other", "baz")),
+			dsp(mkDepspec("bar 1.0.0"),
+				pkg("bar")),
+			dsp(mkDepspec("baz 1.0.0"),
+				pkg("baz"),
+				pkg("baz/testutil")),
+		},
+		// baz/testutil would match, but nothing else pulls in baz
+		require: []string{".../testutil"},
+		r: mksolution(
+			mklp("foo 1.0.0", ".", "testutil"),
+			"bar 1.0.0",
+		),
+	},
+	"require pattern excludes ignored packages": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "foo")),
+			dsp(mkDepspec("foo 1.0.0"),
+				pkg("foo"),
+				pkg("foo/bar", "bar"),
+				pkg("foo/baz", "baz")),
+			dsp(mkDepspec("bar 1.0.0"),
+				pkg("bar")),
+			dsp(mkDepspec("baz 1.0.0"),
+				pkg("baz")),
+		},
+		require: []string{"foo/..."},
+		ignore:  []string{"foo/baz"},
+		r: mksolution(
+			mklp("foo 1.0.0", ".", "bar"),
+			"bar 1.0.0",
+		),
+	},
+	// Main packages in dependencies aren't reached, even by a require pattern,
+	// unless they're declared as tools
+	"require pattern excludes main packages": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "foo")),
+			dsp(mkDepspec("foo 1.0.0"),
+				pkg("foo"),
+				pkg("foo/bar", "bar"),
+				mpkg("foo/cmd/foo", "foo", "baz")),
+			dsp(mkDepspec("bar 1.0.0"),
+				pkg("bar")),
+			dsp(mkDepspec("baz 1.0.0"),
+				pkg("baz")),
+		},
+		require: []string{"foo/..."},
+		r: mksolution(
+			mklp("foo 1.0.0", ".", "bar"),
+			"bar 1.0.0",
+		),
+	},
+	// Directories with only non-Go files can't be imported, so versions whose
+	// packages import them are rejected...
+	"import of non-Go directory skips version": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.1.0"),
+				pkg("a", "b/csrc")),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "b")),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				nogopkg("b/csrc")),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+		),
+	},
+	// ...as are versions in which a required package is one
+	"required non-Go directory skips version": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "b")),
+			dsp(mkDepspec("b 1.1.0"),
+				pkg("b"),
+				nogopkg("b/csrc")),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/csrc")),
+		},
+		require: []string{"b/csrc"},
+		r: mksolution(
+			mklp("b 1.0.0", ".", "csrc"),
+		),
+	},
+	"tool dependency": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a")),
+			dsp(mkDepspec("gen 1.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen", "b")),
+			dsp(mkDepspec("gen 1.1.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen", "b")),
+			dsp(mkDepspec("gen 2.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen", "b")),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b")),
+		},
+		tools: []string{"gen/cmd/gen ^1.0.0"},
+		r: mksolution(
+			"a 1.0.0",
+			mklp("gen 1.1.0", ".", "cmd/gen"),
+			"b 1.0.0",
+		),
+	},
+	"tool constraint combines with root constraint": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0", "gen <1.1.0"),
+				pkg("root", "gen")),
+			dsp(mkDepspec("gen 1.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen")),
+			dsp(mkDepspec("gen 1.1.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen")),
+			dsp(mkDepspec("gen 2.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen")),
+		},
+		tools: []string{"gen/cmd/gen ^1.0.0"},
+		r: mksolution(
+			mklp("gen 1.0.0", ".", "cmd/gen"),
+		),
+	},
+	"fail disjoint tool and root constraints": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0", "gen ^2.0.0"),
+				pkg("root", "gen")),
+			dsp(mkDepspec("gen 1.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen")),
+			dsp(mkDepspec("gen 2.0.0"),
+				pkg("gen"),
+				mpkg("gen/cmd/gen", "gen")),
+		},
+		tools: []string{"gen/cmd/gen ^1.0.0"},
+		fail:  badOptsFailure("constraint ^1.0.0 on tool gen/cmd/gen is disjoint with the root's constraint ^2.0.0 on gen"),
+	},
+	"cgo pkgs allowed by default": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.0.0"),
+				cgopkg("a")),
+		},
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
+	"cgo disabled skips versions requiring cgo": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a")),
+			dsp(mkDepspec("a 1.1.0"),
+				pkg("a", "a/sys"),
+				cgopkg("a/sys")),
+		},
+		nocgo: true,
+		r: mksolution(
+			"a 1.0.0",
+		),
+	},
+	"fail cgo disabled with dep requiring cgo": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/sys"),
+				cgopkg("a/sys")),
+		},
+		nocgo: true,
+		fail: &noVersionError{
+			pn: mkPI("a"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &cgoRequiredFailure{
+						goal: mkAtom("a 1.0.0"),
+						pkg:  "a",
+						err:  &CgoRequiredError{ImportPath: "a/sys"},
+					},
+				},
+			},
+		},
+	},
+	"fail cgo disabled with required dep pkg requiring cgo": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a")),
+			dsp(mkDepspec("a 1.0.0"),
+				cgopkg("a")),
+		},
+		nocgo: true,
+		fail: &noVersionError{
+			pn: mkPI("a"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &checkeeHasProblemPackagesFailure{
+						goal: mkAtom("a 1.0.0"),
+						failpkg: map[string]errDeppers{
+							"a": errDeppers{
+								err:     &CgoRequiredError{ImportPath: "a"},
+								deppers: []atom{mkAtom("root")},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	"fail cgo disabled with root requiring cgo": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "root/sys", "a"),
+				cgopkg("root/sys")),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a")),
+		},
+		nocgo: true,
+		fail: &cgoRequiredFailure{
+			goal: mkAtom("root"),
+			pkg:  "root/sys",
+			err:  &CgoRequiredError{ImportPath: "root/sys"},
+		},
+	},
 	"require impossible subpackage": {
 		ds: []depspec{
 			dsp(mkDepspec("root 0.0.0", "baz 1.0.0"),
@@ -997,6 +1560,22 @@ type tpkg struct {
 	path string
 	// Slice of full paths to its virtual imports
 	imports []string
+	// Import comment path, if any
+	comment string
+	// Whether this is a main package
+	main bool
+	// Whether this package requires cgo
+	cgo bool
+	// Whether this is a directory with only non-Go source files
+	nogo bool
+}
+
+// name returns the package name for the tpkg.
+func (p tpkg) name() string {
+	if p.main {
+		return "main"
+	}
+	return filepath.Base(p.path)
 }
 
 type bimodalFixture struct {
@@ -1025,6 +1604,12 @@ type bimodalFixture struct {
 	ignore []string
 	// pkgs to require
 	require []string
+	// import comment policy
+	icp ImportCommentPolicy
+	// tool pkgs and their constraints, in the form "<pkg> <constraint>"
+	tools []string
+	// solve with cgo disabled
+	nocgo bool
 }
 
 func (f bimodalFixture) name() string {
@@ -1050,6 +1635,7 @@ func (f bimodalFixture) rootmanifest() RootManifest {
 		ovr: f.ovr,
 		ig:  make(map[string]bool),
 		req: make(map[string]bool),
+		icp: f.icp,
 	}
 	for _, ig := range f.ignore {
 		m.ig[ig] = true
@@ -1057,6 +1643,16 @@ func (f bimodalFixture) rootmanifest() RootManifest {
 	for _, req := range f.require {
 		m.req[req] = true
 	}
+	if len(f.tools) > 0 {
+		m.tools = make(map[string]ProjectProperties)
+		for _, tool := range f.tools {
+			pc := mkPCstrnt(tool)
+			m.tools[string(pc.Ident.ProjectRoot)] = ProjectProperties{
+				Source:     pc.Ident.Source,
+				Constraint: pc.Constraint,
+			}
+		}
+	}
 
 	return m
 }
@@ -1068,11 +1664,12 @@ func (f bimodalFixture) rootTree() PackageTree {
 	}
 
 	for _, pkg := range f.ds[0].pkgs {
-		elems := strings.Split(pkg.path, "/")
 		pt.Packages[pkg.path] = PackageOrErr{
 			P: Package{
-				ImportPath: pkg.path,
-				Name:       elems[len(elems)-1],
+				ImportPath:  pkg.path,
+				Name:        pkg.name(),
+				Cgo:         pkg.cgo,
+				RequiresCgo: pkg.cgo,
 				// TODO(sdboyer) ugh, tpkg type has no space for supporting test
 				// imports...
 				Imports: pkg.imports,
@@ -1116,11 +1713,24 @@ func (sm *bmSourceManager) ListPackages(id ProjectIdentifier, v Version) (Packag
 				Packages:   make(map[string]PackageOrErr),
 			}
 			for _, pkg := range ds.pkgs {
+				if pkg.nogo {
+					ptree.Packages[pkg.path] = PackageOrErr{
+						P: Package{
+							ImportPath: pkg.path,
+							OtherFiles: []string{"src.c"},
+						},
+						Err: &build.NoGoError{Dir: pkg.path},
+					}
+					continue
+				}
 				ptree.Packages[pkg.path] = PackageOrErr{
 					P: Package{
-						ImportPath: pkg.path,
-						Name:       filepath.Base(pkg.path),
-						Imports:    pkg.imports,
+						ImportPath:  pkg.path,
+						CommentPath: pkg.comment,
+						Name:        pkg.name(),
+						Imports:     pkg.imports,
+						Cgo:         pkg.cgo,
+						RequiresCgo: pkg.cgo,
 					},
 				}
 			}
@@ -1167,6 +1777,9 @@ func computeBimodalExternalMap(ds []depspec) map[pident]map[string][]string {
 		workmap := make(map[string]wm)
 
 		for _, pkg := range d.pkgs {
+			if pkg.nogo {
+				continue
+			}
 			w := wm{
 				ex: make(map[string]bool),
 				in: make(map[string]bool),
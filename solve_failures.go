@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 )
 
 type errorLevel uint8
@@ -190,10 +191,21 @@ type versionNotAllowedFailure struct {
 
 func (e *versionNotAllowedFailure) Error() string {
 	if len(e.failparent) == 1 {
+		c := e.failparent[0].dep.Constraint
+		if prereleaseRejects(c, e.goal.v) {
+			return fmt.Sprintf(
+				"Could not introduce %s, as it is a pre-release, which the %s pre-release policy does not allow for constraint %s from project %s.",
+				a2vs(e.goal),
+				c.(semverConstraint).pre,
+				c.String(),
+				e.failparent[0].depender.id.errString(),
+			)
+		}
+
 		return fmt.Sprintf(
 			"Could not introduce %s, as it is not allowed by constraint %s from project %s.",
 			a2vs(e.goal),
-			e.failparent[0].dep.Constraint.String(),
+			c.String(),
 			e.failparent[0].depender.id.errString(),
 		)
 	}
@@ -203,7 +215,11 @@ func (e *versionNotAllowedFailure) Error() string {
 	fmt.Fprintf(&buf, "Could not introduce %s, as it is not allowed by constraints from the following projects:\n", a2vs(e.goal))
 
 	for _, f := range e.failparent {
-		fmt.Fprintf(&buf, "\t%s from %s\n", f.dep.Constraint.String(), a2vs(f.depender))
+		if prereleaseRejects(f.dep.Constraint, e.goal.v) {
+			fmt.Fprintf(&buf, "\t%s from %s (pre-release not allowed by %s policy)\n", f.dep.Constraint.String(), a2vs(f.depender), f.dep.Constraint.(semverConstraint).pre)
+		} else {
+			fmt.Fprintf(&buf, "\t%s from %s\n", f.dep.Constraint.String(), a2vs(f.depender))
+		}
 	}
 
 	return buf.String()
@@ -310,6 +326,8 @@ func (e *checkeeHasProblemPackagesFailure) Error() string {
 		var cause string
 		if errdep.err == nil {
 			cause = "is missing"
+		} else if _, is := errdep.err.(*CgoRequiredError); is {
+			cause = "requires cgo, which is disabled"
 		} else {
 			cause = fmt.Sprintf("does not contain usable Go code (%T).", errdep.err)
 		}
@@ -490,3 +508,232 @@ func (e *nonexistentRevisionFailure) traceString() string {
 		e.goal.dep.Ident.errString(),
 	)
 }
+
+// internalImportFailure indicates that an atom was rejected because one of the
+// packages required from it (transitively) imports an internal package from
+// which Go's visibility rules exclude it - most commonly, another project's
+// internal package.
+type internalImportFailure struct {
+	// goal is the atom that was rejected.
+	goal atom
+	// pkg is the package required from the goal atom that could not be used.
+	pkg string
+	// err describes the disallowed import. Its ImportPath may differ from pkg,
+	// if pkg only reaches the offending import transitively.
+	err *InternalImportError
+}
+
+func (e *internalImportFailure) Error() string {
+	if e.pkg == e.err.ImportPath {
+		return fmt.Sprintf(
+			"Could not introduce %s, as its package %s imports %s, which is not visible to it",
+			a2vs(e.goal),
+			e.pkg,
+			e.err.Internal,
+		)
+	}
+
+	return fmt.Sprintf(
+		"Could not introduce %s, as its package %s transitively imports %s (via %s), which is not visible to it",
+		a2vs(e.goal),
+		e.pkg,
+		e.err.Internal,
+		e.err.ImportPath,
+	)
+}
+
+func (e *internalImportFailure) traceString() string {
+	return fmt.Sprintf(
+		"%s pkg %s reaches disallowed internal import %s (from %s)",
+		a2vs(e.goal),
+		e.pkg,
+		e.err.Internal,
+		e.err.ImportPath,
+	)
+}
+
+// cgoRequiredFailure indicates that an atom was rejected because cgo is
+// disabled, but a package required from the atom needs it.
+type cgoRequiredFailure struct {
+	// goal is the atom that was rejected.
+	goal atom
+	// pkg is the package required from the goal atom that could not be used.
+	pkg string
+	// err identifies the package requiring cgo. Its ImportPath may differ
+	// from pkg, if pkg only reaches it transitively.
+	err *CgoRequiredError
+}
+
+func (e *cgoRequiredFailure) Error() string {
+	if e.pkg == e.err.ImportPath {
+		return fmt.Sprintf(
+			"Could not introduce %s, as its package %s requires cgo, which is disabled",
+			a2vs(e.goal),
+			e.pkg,
+		)
+	}
+
+	return fmt.Sprintf(
+		"Could not introduce %s, as its package %s imports %s, which requires cgo, which is disabled",
+		a2vs(e.goal),
+		e.pkg,
+		e.err.ImportPath,
+	)
+}
+
+func (e *cgoRequiredFailure) traceString() string {
+	return fmt.Sprintf(
+		"%s pkg %s needs cgo (via %s), but it is disabled",
+		a2vs(e.goal),
+		e.pkg,
+		e.err.ImportPath,
+	)
+}
+
+// importCommentFailure indicates that an atom was rejected because the import
+// comments on one or more of the packages required from it disagree with the
+// paths under which they are being imported.
+type importCommentFailure struct {
+	// goal is the atom that was rejected.
+	goal atom
+	// errs describes each of the mismatched packages.
+	errs []*ImportCommentError
+}
+
+func (e *importCommentFailure) Error() string {
+	if len(e.errs) == 1 {
+		return fmt.Sprintf(
+			"Could not introduce %s, as its package %s is imported under a non-canonical path; its import comment requires %q",
+			a2vs(e.goal),
+			e.errs[0].ImportPath,
+			e.errs[0].CommentPath,
+		)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Could not introduce %s, as multiple packages are imported under non-canonical paths:", a2vs(e.goal))
+	for _, err := range e.errs {
+		fmt.Fprintf(&buf, "\n\t%s (import comment requires %q)", err.ImportPath, err.CommentPath)
+	}
+
+	return buf.String()
+}
+
+func (e *importCommentFailure) traceString() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s has mismatched import comment(s):", a2vs(e.goal))
+	for _, err := range e.errs {
+		fmt.Fprintf(&buf, "\n\t%s wants %s", err.ImportPath, err.CommentPath)
+	}
+
+	return buf.String()
+}
+
+// importCycleFailure indicates that an atom was rejected because selecting
+// its packages would have created an import cycle spanning multiple projects,
+// which the go tool would refuse to build.
+type importCycleFailure struct {
+	// goal is the atom that was rejected.
+	goal atom
+	// cycle is the path of imports forming the cycle. The first and last
+	// elements are the same package.
+	cycle []string
+}
+
+func (e *importCycleFailure) Error() string {
+	return fmt.Sprintf(
+		"Could not introduce %s, as it would create an import cycle across projects: %s",
+		a2vs(e.goal),
+		strings.Join(e.cycle, " -> "),
+	)
+}
+
+func (e *importCycleFailure) traceString() string {
+	return fmt.Sprintf("%s creates import cycle %s", a2vs(e.goal), strings.Join(e.cycle, " -> "))
+}
+
+// retractedVersionFailure indicates that a version was skipped because it has
+// been retracted, either by its own project or by the root's deny list.
+type retractedVersionFailure struct {
+	// goal is the atom that was skipped.
+	goal atom
+	// root indicates the version was denied by the root, rather than
+	// retracted by its project.
+	root bool
+}
+
+func (e *retractedVersionFailure) Error() string {
+	if e.root {
+		return fmt.Sprintf("Could not introduce %s, as the root project denies that version", a2vs(e.goal))
+	}
+	return fmt.Sprintf("Could not introduce %s, as that version has been retracted", a2vs(e.goal))
+}
+
+func (e *retractedVersionFailure) traceString() string {
+	if e.root {
+		return fmt.Sprintf("%s is denied by root", a2vs(e.goal))
+	}
+	return fmt.Sprintf("%s is retracted", a2vs(e.goal))
+}
+
+// RetractedVersionError indicates that a Solution uses a retracted version of a
+// project. The solver only selects a retracted version if it is the version in
+// the root lock, so these are reported as warnings; choosing a new version
+// requires changing the project.
+type RetractedVersionError struct {
+	// Ident identifies the project.
+	Ident ProjectIdentifier
+	// Version is the retracted version in the Solution.
+	Version Version
+	// ByRoot indicates that the root project denies the version, rather than
+	// the project having retracted it.
+	ByRoot bool
+}
+
+func (e *RetractedVersionError) Error() string {
+	if e.ByRoot {
+		return fmt.Sprintf("locked version %s of %s is denied by the root project", e.Version, e.Ident.errString())
+	}
+	return fmt.Sprintf("locked version %s of %s has been retracted", e.Version, e.Ident.errString())
+}
+
+// prereleaseNotAllowedFailure indicates that a version was skipped because it
+// is a pre-release, and the pre-release policy for its project does not permit
+// it.
+type prereleaseNotAllowedFailure struct {
+	// goal is the atom that was skipped.
+	goal atom
+	// pol is the policy in effect for the goal's project.
+	pol PrereleasePolicy
+}
+
+func (e *prereleaseNotAllowedFailure) Error() string {
+	if e.pol == PrereleasesNever {
+		return fmt.Sprintf("Could not introduce %s, as pre-releases of %s are never allowed", a2vs(e.goal), e.goal.id.errString())
+	}
+	return fmt.Sprintf("Could not introduce %s, as it is a pre-release, and no constraint on %s names it", a2vs(e.goal), e.goal.id.errString())
+}
+
+func (e *prereleaseNotAllowedFailure) traceString() string {
+	return fmt.Sprintf("%s is a pre-release, not allowed by %s policy", a2vs(e.goal), e.pol)
+}
+
+// versionTooNewFailure indicates that a version was skipped because it was
+// committed after the cutoff time for the solve, as set by the Cutoff or
+// Cooldown solve parameters.
+type versionTooNewFailure struct {
+	// goal is the atom that was skipped.
+	goal atom
+	// t is the time at which the goal's revision was committed.
+	t time.Time
+	// cutoff is the effective cutoff time for the solve.
+	cutoff time.Time
+}
+
+func (e *versionTooNewFailure) Error() string {
+	return fmt.Sprintf("Could not introduce %s, as it was committed at %s, after the cutoff of %s", a2vs(e.goal), e.t.UTC().Format(time.RFC3339), e.cutoff.UTC().Format(time.RFC3339))
+}
+
+func (e *versionTooNewFailure) traceString() string {
+	return fmt.Sprintf("%s committed %s, after cutoff %s", a2vs(e.goal), e.t.UTC().Format(time.RFC3339), e.cutoff.UTC().Format(time.RFC3339))
+}
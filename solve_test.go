@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var fixtorun string
@@ -100,6 +101,9 @@ func solveBasicsAndCheck(fix basicFixture, t *testing.T) (res Solution, err erro
 		Downgrade:       fix.downgrade,
 		ChangeAll:       fix.changeall,
 		ToChange:        fix.changelist,
+		Prereleases:     fix.pre,
+		Cutoff:          fix.cutoff,
+		Cooldown:        fix.cooldown,
 	}
 
 	if fix.l != nil {
@@ -108,7 +112,11 @@ func solveBasicsAndCheck(fix basicFixture, t *testing.T) (res Solution, err erro
 
 	res, err = fixSolve(params, sm)
 
-	return fixtureSolveSimpleChecks(fix, res, err, t)
+	res, err = fixtureSolveSimpleChecks(fix, res, err, t)
+	if err == nil && !reflect.DeepEqual(res.(WarningSolution).Warnings(), fix.warn) {
+		t.Errorf("(fixture: %q) Expected warnings %v, got %v", fix.name(), fix.warn, res.(WarningSolution).Warnings())
+	}
+	return res, err
 }
 
 // Test all the bimodal table fixtures.
@@ -135,6 +143,34 @@ func TestBimodalSolves(t *testing.T) {
 	}
 }
 
+func TestImportCommentWarnings(t *testing.T) {
+	fix := bimodalFixtures["import comment mismatch warns"]
+	res, err := solveBimodalAndCheck(fix, t)
+	if err != nil {
+		t.FailNow()
+	}
+
+	want := []error{
+		&ImportCommentError{
+			ImportPath:  "a",
+			CommentPath: "canonical/a",
+		},
+	}
+	if w := res.(WarningSolution).Warnings(); !reflect.DeepEqual(w, want) {
+		t.Errorf("Expected warnings %v, got %v", want, w)
+	}
+
+	// When enforcing, mismatches fail rather than warn
+	fix = bimodalFixtures["import comment mismatch skips version"]
+	res, err = solveBimodalAndCheck(fix, t)
+	if err != nil {
+		t.FailNow()
+	}
+	if w := res.(WarningSolution).Warnings(); len(w) != 0 {
+		t.Errorf("Expected no warnings, got %v", w)
+	}
+}
+
 func solveBimodalAndCheck(fix bimodalFixture, t *testing.T) (res Solution, err error) {
 	if testing.Verbose() {
 		stderrlog.Printf("[[fixture %q]]", fix.n)
@@ -148,6 +184,7 @@ func solveBimodalAndCheck(fix bimodalFixture, t *testing.T) (res Solution, err e
 		Lock:            dummyLock{},
 		Downgrade:       fix.downgrade,
 		ChangeAll:       fix.changeall,
+		CgoDisabled:     fix.nocgo,
 	}
 
 	if fix.l != nil {
@@ -381,8 +418,96 @@ func TestBadSolveOpts(t *testing.T) {
 	} else if !strings.Contains(err.Error(), "multiple packages given as both required and ignored:") {
 		t.Error("Prepare should have given error with multiple ignore/require conflict error, but gave:", err)
 	}
+
+	params.Manifest = simpleRootManifest{
+		ig:  map[string]bool{"foo/...": true},
+		req: map[string]bool{"foo/bar": true},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on required pkg matched by ignore pattern")
+	} else if !strings.Contains(err.Error(), "was given as both a required and ignored package") {
+		t.Error("Prepare should have given error with single ignore/require conflict error, but gave:", err)
+	}
+
+	params.Manifest = simpleRootManifest{
+		ig:  map[string]bool{"foo/bar": true},
+		req: map[string]bool{"foo/...": true},
+	}
+	_, err = Prepare(params, sm)
+	if err != nil {
+		t.Error("Ignores should be allowed to carve exceptions out of require patterns, but Prepare gave:", err)
+	}
+
+	params.Manifest = simpleRootManifest{
+		ig: map[string]bool{"foo/[": true},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on malformed ignore pattern")
+	} else if !strings.Contains(err.Error(), "is not a valid package pattern") {
+		t.Error("Prepare should have given error on malformed ignore pattern, but gave:", err)
+	}
+
+	params.Manifest = simpleRootManifest{
+		ig:    map[string]bool{"gen/...": true},
+		tools: map[string]ProjectProperties{"gen/cmd/gen": {}},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on ignored tool")
+	} else if !strings.Contains(err.Error(), "is also an ignored package") {
+		t.Error("Prepare should have given error on ignored tool, but gave:", err)
+	}
+
+	params.Manifest = simpleRootManifest{
+		tools: map[string]ProjectProperties{"gen/...": {}},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on tool pattern")
+	} else if !strings.Contains(err.Error(), "must be an import path, not a pattern") {
+		t.Error("Prepare should have given error on tool pattern, but gave:", err)
+	}
+
+	params.Manifest = simpleRootManifest{
+		pre: map[ProjectRoot]PrereleasePolicy{"foo": PrereleasePolicy(9)},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on invalid per-project pre-release policy")
+	} else if !strings.Contains(err.Error(), "invalid pre-release policy") {
+		t.Error("Prepare should have given error on invalid pre-release policy, but gave:", err)
+	}
+	params.Manifest = simpleRootManifest{
+		schemes: map[ProjectRoot]VersionScheme{"foo": nil},
+	}
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on nil version scheme")
+	} else if !strings.Contains(err.Error(), "no version scheme given") {
+		t.Error("Prepare should have given error on nil version scheme, but gave:", err)
+	}
 	params.Manifest = nil
 
+	params.Prereleases = PrereleasePolicy(9)
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on invalid pre-release policy")
+	} else if !strings.Contains(err.Error(), "invalid pre-release policy") {
+		t.Error("Prepare should have given error on invalid pre-release policy, but gave:", err)
+	}
+	params.Prereleases = PrereleasesAllowed
+
+	params.Cooldown = -time.Hour
+	_, err = Prepare(params, sm)
+	if err == nil {
+		t.Errorf("Should have errored on negative cool-down period")
+	} else if !strings.Contains(err.Error(), "invalid cool-down period") {
+		t.Error("Prepare should have given error on negative cool-down period, but gave:", err)
+	}
+	params.Cooldown = 0
+
 	params.ToChange = []ProjectRoot{"foo"}
 	_, err = Prepare(params, sm)
 	if err == nil {
@@ -6,6 +6,7 @@ import (
 	"log"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/armon/go-radix"
 )
@@ -82,6 +83,42 @@ type SolveParameters struct {
 	// TraceLogger is the logger to use for generating trace output. If Trace is
 	// true but no logger is provided, solving will result in an error.
 	TraceLogger *log.Logger
+
+	// BuildTarget optionally restricts the solve to a set of platforms and
+	// build tags. If non-nil, imports made only by files whose build
+	// constraints (+build lines and _GOOS/_GOARCH file name suffixes) cannot be
+	// satisfied for the target are disregarded, both in the root project and
+	// in all dependencies - along with everything they would pull in.
+	//
+	// If nil, all imports are considered, regardless of build constraints.
+	BuildTarget *BuildTarget
+
+	// CgoDisabled indicates that the solution will be built with cgo
+	// disabled (CGO_ENABLED=0). If true, packages that require cgo (see
+	// Package.RequiresCgo) are treated as unusable: versions of dependencies
+	// that would need them are rejected, and solving fails outright if the
+	// root project needs them.
+	CgoDisabled bool
+
+	// Prereleases is the policy governing whether semver pre-release versions
+	// may be selected. A root manifest implementing PrereleaseManifest may
+	// override it for individual projects.
+	Prereleases PrereleasePolicy
+
+	// Cutoff, if non-zero, excludes versions of dependencies whose underlying
+	// revision was committed after the given time. This allows a solve to
+	// reproduce the selections that would have been made at that time, as
+	// far as the versions still available upstream permit.
+	Cutoff time.Time
+
+	// Cooldown, if non-zero, excludes versions of dependencies committed less
+	// than the given duration before the solve begins, so that new versions
+	// are only adopted once they've been available for a while. If Cutoff is
+	// also set, whichever of the two is earlier applies.
+	//
+	// Neither Cutoff nor Cooldown is applied to versions from the root lock,
+	// or to versions whose commit time the SourceManager can't report.
+	Cooldown time.Duration
 }
 
 // solver is a CDCL-style constraint solver with satisfiability conditions
@@ -109,6 +146,10 @@ type solver struct {
 	// itself is responsible for maintaining that invariant.
 	sel *selection
 
+	// The import graph of the packages in s.sel, used to check for import
+	// cycles. It is updated at the same time as s.sel.
+	pg *pkgGraph
+
 	// The current list of projects that we need to incorporate into the solution in
 	// order for the solution to be complete. This list is implemented as a
 	// priority queue that places projects least likely to induce errors at the
@@ -164,6 +205,49 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		dir:     params.RootDir,
 	}
 
+	if icm, ok := params.Manifest.(ImportCommentManifest); ok {
+		rd.icp = icm.ImportCommentPolicy()
+	}
+
+	if tm, ok := params.Manifest.(ToolManifest); ok {
+		rd.tools = tm.ToolDependencies()
+	}
+
+	if dm, ok := params.Manifest.(DenyListManifest); ok {
+		for pr, vl := range dm.DeniedVersions() {
+			if len(vl) == 0 {
+				continue
+			}
+			if rd.deny == nil {
+				rd.deny = make(map[ProjectRoot][]Version)
+			}
+			rd.deny[pr] = append([]Version(nil), vl...)
+		}
+	}
+
+	if vm, ok := params.Manifest.(VersionSchemeManifest); ok {
+		for pr, vs := range vm.VersionSchemes() {
+			if vs == nil {
+				return rootdata{}, badOptsFailure(fmt.Sprintf("no version scheme given for %s", pr))
+			}
+			if rd.schemes == nil {
+				rd.schemes = make(map[ProjectRoot]VersionScheme)
+			}
+			rd.schemes[pr] = vs
+		}
+	}
+
+	if params.BuildTarget != nil {
+		bt := *params.BuildTarget
+		rd.bt = &bt
+	}
+	rd.nocgo = params.CgoDisabled
+	rd.rpt = rd.adaptTree(rd.rpt)
+
+	if err := rd.setVersionPolicies(params); err != nil {
+		return rootdata{}, err
+	}
+
 	// Ensure the required, ignore and overrides maps are at least initialized
 	if rd.ig == nil {
 		rd.ig = make(map[string]bool)
@@ -175,13 +259,26 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		rd.ovr = make(ProjectConstraints)
 	}
 
+	// Validate all package patterns in the ignore and require maps
+	for _, pat := range append(pkgPatterns(rd.ig), pkgPatterns(rd.req)...) {
+		if err := validatePkgPattern(pat); err != nil {
+			return rootdata{}, badOptsFailure(err.Error())
+		}
+	}
+	rd.igm = newPkgMatcher(rd.ig)
+
 	if len(rd.ig) != 0 {
+		// A package is both required and ignored if it is literally named in
+		// both maps, or if it's literally required and matched by an ignore
+		// pattern. A required pattern may match ignored packages, though; the
+		// ignore just takes precedence.
 		var both []string
-		for pkg := range params.Manifest.RequiredPackages() {
-			if rd.ig[pkg] {
+		for pkg, on := range params.Manifest.RequiredPackages() {
+			if on && (rd.ig[pkg] || (!isPkgPattern(pkg) && rd.isIgnored(pkg))) {
 				both = append(both, pkg)
 			}
 		}
+		sort.Strings(both)
 		switch len(both) {
 		case 0:
 			break
@@ -192,6 +289,19 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		}
 	}
 
+	// Tools must be literal import paths of packages outside the root, and
+	// can't be ignored
+	for tool := range rd.tools {
+		switch {
+		case isPkgPattern(tool):
+			return rootdata{}, badOptsFailure(fmt.Sprintf("tool %q must be an import path, not a pattern", tool))
+		case eqOrSlashedPrefix(tool, rd.rpt.ImportRoot):
+			return rootdata{}, badOptsFailure(fmt.Sprintf("tool %q is within the root project", tool))
+		case rd.isIgnored(tool):
+			return rootdata{}, badOptsFailure(fmt.Sprintf("tool %q is also an ignored package", tool))
+		}
+	}
+
 	// Validate no empties in the overrides map
 	var eovr []string
 	for pr, pp := range rd.ovr {
@@ -234,6 +344,41 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 	return rd, nil
 }
 
+// setVersionPolicies validates and records the pre-release policies and the
+// effective cutoff time given by the parameters and their root manifest, which
+// must not be nil.
+func (rd *rootdata) setVersionPolicies(params SolveParameters) error {
+	rd.pre = params.Prereleases
+	if pm, ok := params.Manifest.(PrereleaseManifest); ok {
+		for pr, p := range pm.PrereleasePolicies() {
+			if rd.prep == nil {
+				rd.prep = make(map[ProjectRoot]PrereleasePolicy)
+			}
+			rd.prep[pr] = p
+		}
+	}
+	if rd.pre > PrereleasesNever {
+		return badOptsFailure(fmt.Sprintf("invalid pre-release policy %s", rd.pre))
+	}
+	for pr, p := range rd.prep {
+		if p > PrereleasesNever {
+			return badOptsFailure(fmt.Sprintf("invalid pre-release policy %s for %s", p, pr))
+		}
+	}
+
+	if params.Cooldown < 0 {
+		return badOptsFailure(fmt.Sprintf("invalid cool-down period %s, must not be negative", params.Cooldown))
+	}
+	rd.cutoff, rd.cooldown = params.Cutoff, params.Cooldown
+	rd.before = rd.cutoff
+	if rd.cooldown > 0 {
+		if cd := time.Now().Add(-rd.cooldown); rd.before.IsZero() || cd.Before(rd.before) {
+			rd.before = cd
+		}
+	}
+	return nil
+}
+
 // Prepare readies a Solver for use.
 //
 // This function reads and validates the provided SolveParameters. If a problem
@@ -271,6 +416,7 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 		deps: make(map[ProjectRoot][]dependency),
 		sm:   s.b,
 	}
+	s.pg = newPkgGraph()
 	s.unsel = &unselected{
 		sl:  make([]bimodalIdentifier, 0),
 		cmp: s.unselectedComparator,
@@ -296,7 +442,8 @@ type Solver interface {
 	HashInputs() []byte
 
 	// Solve initiates a solving run. It will either complete successfully with
-	// a Solution, or fail with an informative error.
+	// a Solution, or fail with an informative error. The returned Solution
+	// also implements WarningSolution.
 	Solve() (Solution, error)
 }
 
@@ -332,6 +479,11 @@ func (s *solver) Solve() (Solution, error) {
 			soln.p[k] = pa2lp(pa, pl)
 			k++
 		}
+
+		if s.rd.icp == ImportCommentsWarn {
+			soln.warn = s.importCommentWarnings(all)
+		}
+		soln.warn = append(soln.warn, s.retractionWarnings()...)
 	}
 
 	s.traceFinish(soln, err)
@@ -341,6 +493,52 @@ func (s *solver) Solve() (Solution, error) {
 	return soln, err
 }
 
+// importCommentWarnings collects an ImportCommentError for each package in the
+// final selection whose import comment disagrees with its import path.
+func (s *solver) importCommentWarnings(all map[atom]map[string]struct{}) []error {
+	var errs importCommentErrs
+	for pa, pkgs := range all {
+		ptree, err := s.b.ListPackages(pa.id, pa.v)
+		if err != nil {
+			// Can't happen in practice, as the solver already successfully
+			// analyzed every selected atom
+			continue
+		}
+
+		pl := make([]string, 0, len(pkgs))
+		for pkg := range pkgs {
+			pl = append(pl, pkg)
+		}
+		errs = append(errs, ptree.importCommentErrors(pl)...)
+	}
+
+	// Sort for determinism, as the selection map is unordered
+	sort.Sort(errs)
+	warn := make([]error, len(errs))
+	for k, err := range errs {
+		warn[k] = err
+	}
+	return warn
+}
+
+// retractionWarnings returns a RetractedVersionError for each project in the
+// final selection whose version has been retracted. That can only happen when
+// the retracted version is the one in the root lock.
+func (s *solver) retractionWarnings() []error {
+	var warn []error
+	for _, q := range s.vqs {
+		cur := q.current()
+		if rt, is := q.retractionOf(cur); is {
+			warn = append(warn, &RetractedVersionError{
+				Ident:   q.id,
+				Version: cur,
+				ByRoot:  rt.root,
+			})
+		}
+	}
+	return warn
+}
+
 // solve is the top-level loop for the solving process.
 func (s *solver) solve() (map[atom]map[string]struct{}, error) {
 	// Main solving loop
@@ -457,10 +655,30 @@ func (s *solver) selectRoot() error {
 	// Push the root project onto the queue.
 	awp := s.rd.rootAtom()
 	s.sel.pushSelection(awp, true)
+	s.pg.add(awp.a.id, s.rd.rpt, awp.pl, s.rd.isIgnored)
+
+	// Go's internal package rules can't be satisfied by any choice of version,
+	// so reject the root outright if it breaks them.
+	if err := s.rd.checkInternalImports(awp.a); err != nil {
+		s.mtr.pop()
+		return err
+	}
+
+	// Likewise if it needs cgo, but cgo is disabled.
+	if err := s.rd.checkCgo(awp.a); err != nil {
+		s.mtr.pop()
+		return err
+	}
 
 	// If we're looking for root's deps, get it from opts and local root
 	// analysis, rather than having the sm do it
-	deps, err := s.intersectConstraintsWithImports(s.rd.combineConstraints(), s.rd.externalImportList())
+	rc, err := s.rootConstraints()
+	if err != nil {
+		s.mtr.pop()
+		return err
+	}
+
+	deps, err := s.intersectConstraintsWithImports(rc, s.rd.externalImportList())
 	if err != nil {
 		// TODO(sdboyer) this could well happen; handle it with a more graceful error
 		panic(fmt.Sprintf("shouldn't be possible %s", err))
@@ -484,6 +702,67 @@ func (s *solver) selectRoot() error {
 	return nil
 }
 
+// rootConstraints returns the root's combined constraints, with the
+// constraints declared for any tools incorporated into those on the projects
+// that contain them.
+func (s *solver) rootConstraints() ([]workingConstraint, error) {
+	wc := s.rd.combineConstraints()
+	if len(s.rd.tools) == 0 {
+		return wc, nil
+	}
+
+	idx := make(map[ProjectRoot]int, len(wc))
+	for k, c := range wc {
+		idx[c.Ident.ProjectRoot] = k
+	}
+
+	tools := make([]string, 0, len(s.rd.tools))
+	for tool := range s.rd.tools {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	for _, tool := range tools {
+		root, err := s.b.DeduceProjectRoot(tool)
+		if err != nil {
+			return nil, err
+		}
+
+		pp := s.rd.tools[tool]
+		if pp.Constraint == nil {
+			pp.Constraint = Any()
+		}
+
+		k, has := idx[root]
+		if !has {
+			idx[root] = len(wc)
+			wc = append(wc, s.rd.ovr.override(root, pp))
+			continue
+		}
+
+		// The root already declared properties for this project; if they've
+		// been overridden, the override wins, as always. Otherwise, they
+		// must be compatible with the tool's.
+		c := wc[k]
+		if !c.overrConstraint {
+			ic := c.Constraint.Intersect(pp.Constraint)
+			if ic == none {
+				return nil, badOptsFailure(fmt.Sprintf("constraint %s on tool %s is disjoint with the root's constraint %s on %s", pp.Constraint, tool, c.Constraint, root))
+			}
+			c.Constraint = ic
+		}
+		if !c.overrNet && pp.Source != "" {
+			if c.Ident.Source != "" && c.Ident.Source != pp.Source {
+				return nil, badOptsFailure(fmt.Sprintf("source %s for tool %s conflicts with the root's source %s for %s", pp.Source, tool, c.Ident.Source, root))
+			}
+			c.Ident.Source = pp.Source
+		}
+		wc[k] = c
+	}
+
+	return wc, nil
+}
+
 func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []completeDep, error) {
 	var err error
 
@@ -503,11 +782,21 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 		return nil, nil, err
 	}
 
+	// Main packages can't be imported, so they're left out, except for any
+	// that the root has declared as tools.
 	rm, em := ptree.ToReachMap(false, false, true, s.rd.ig)
+	s.rd.addToolReach(a.pl, ptree, rm, em)
 	// Use maps to dedupe the unique internal and external packages.
 	exmap, inmap := make(map[string]struct{}), make(map[string]struct{})
 
-	for _, pkg := range a.pl {
+	// Any of the project's packages matched by a required package pattern are
+	// required in addition to those explicitly listed in the atom.
+	apl := a.pl
+	if rpl := s.rd.requiredPackagesIn(rm); len(rpl) > 0 {
+		apl = dedupeStrings(a.pl, rpl)
+	}
+
+	for _, pkg := range apl {
 		inmap[pkg] = struct{}{}
 		for _, ipkg := range rm[pkg].Internal {
 			inmap[ipkg] = struct{}{}
@@ -517,8 +806,8 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 	var pl []string
 	// If lens are the same, then the map must have the same contents as the
 	// slice; no need to build a new one.
-	if len(inmap) == len(a.pl) {
-		pl = a.pl
+	if len(inmap) == len(apl) {
+		pl = apl
 	} else {
 		pl = make([]string, 0, len(inmap))
 		for pkg := range inmap {
@@ -529,9 +818,9 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 
 	// Add to the list those packages that are reached by the packages
 	// explicitly listed in the atom
-	for _, pkg := range a.pl {
+	for _, pkg := range apl {
 		// Skip ignored packages
-		if s.rd.ig[pkg] {
+		if s.rd.isIgnored(pkg) {
 			continue
 		}
 
@@ -540,6 +829,20 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 			// Missing package here *should* only happen if the target pkg was
 			// poisoned. Check the errors map
 			if importErr, eexists := em[pkg]; eexists {
+				if ierr, is := importErr.Err.(*InternalImportError); is {
+					return nil, nil, &internalImportFailure{
+						goal: a.a,
+						pkg:  pkg,
+						err:  ierr,
+					}
+				}
+				if cerr, is := importErr.Err.(*CgoRequiredError); is {
+					return nil, nil, &cgoRequiredFailure{
+						goal: a.a,
+						pkg:  pkg,
+						err:  cerr,
+					}
+				}
 				return nil, nil, importErr
 			}
 
@@ -622,10 +925,12 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 		}
 	}
 
-	// Dump all the deps from the map into the expected return slice
+	// Dump all the deps from the map into the expected return slice, applying
+	// each project's pre-release policy to its constraint
 	cdeps := make([]completeDep, len(dmap))
 	k := 0
-	for _, cdep := range dmap {
+	for pr, cdep := range dmap {
+		cdep.Constraint = withPrereleasePolicy(cdep.Constraint, s.rd.prereleasePolicy(pr))
 		cdeps[k] = cdep
 		k++
 	}
@@ -720,6 +1025,9 @@ func (s *solver) createVersionQueue(bmi bimodalIdentifier) (*versionQueue, error
 		return nil, err
 	}
 
+	// Retracted versions are skipped by findValidVersion, unless locked.
+	q.retracted = s.b.retractions(id)
+
 	// Hack in support for revisions.
 	//
 	// By design, revs aren't returned from ListVersion(). Thus, if the dep in
@@ -767,13 +1075,29 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 	for {
 		cur := q.current()
 		s.traceInfo("try %s@%s", q.id.errString(), cur)
-		err := s.check(atomWithPackages{
-			a: atom{
-				id: q.id,
-				v:  cur,
-			},
-			pl: pl,
-		}, false)
+
+		var err error
+		if rt, is := q.retractionOf(cur); is && cur != q.lockv {
+			// Retracted versions are skipped without checking them, unless
+			// they're what's in the root lock.
+			err = &retractedVersionFailure{
+				goal: atom{id: q.id, v: cur},
+				root: rt.root,
+			}
+			s.traceInfo(err)
+		} else if err = s.checkPrerelease(atom{id: q.id, v: cur}); err != nil {
+			s.traceInfo(err)
+		} else if err = s.checkCutoff(q, cur); err != nil {
+			s.traceInfo(err)
+		} else {
+			err = s.check(atomWithPackages{
+				a: atom{
+					id: q.id,
+					v:  cur,
+				},
+				pl: pl,
+			}, false)
+		}
 		if err == nil {
 			// we have a good version, can return safely
 			return nil
@@ -799,6 +1123,44 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 	}
 }
 
+// checkPrerelease returns a prereleaseNotAllowedFailure if the atom's version is
+// a pre-release that its project's PrereleasePolicy does not permit, given the
+// current constraint on the project.
+//
+// Pre-release policy is also applied to semver range constraints themselves,
+// but this check covers the cases they can't, such as an unconstrained project.
+func (s *solver) checkPrerelease(a atom) error {
+	p := s.rd.prereleasePolicy(a.id.ProjectRoot)
+	if prereleasePermitted(p, s.sel.getConstraint(a.id), a.v) {
+		return nil
+	}
+
+	return &prereleaseNotAllowedFailure{
+		goal: a,
+		pol:  p,
+	}
+}
+
+// checkCutoff returns a versionTooNewFailure if the version was committed after
+// the effective cutoff time for the solve. The version from the root lock is
+// exempt, as are versions whose commit time is unknown.
+func (s *solver) checkCutoff(q *versionQueue, v Version) error {
+	if s.rd.before.IsZero() || v == q.lockv {
+		return nil
+	}
+
+	t, has := s.b.versionTime(q.id, v)
+	if !has || !t.After(s.rd.before) {
+		return nil
+	}
+
+	return &versionTooNewFailure{
+		goal:   atom{id: q.id, v: v},
+		t:      t,
+		cutoff: s.rd.before,
+	}
+}
+
 // getLockVersionIfValid finds an atom for the given ProjectIdentifier from the
 // root lock, assuming:
 //
@@ -866,6 +1228,15 @@ func (s *solver) getLockVersionIfValid(id ProjectIdentifier) (Version, error) {
 			//}
 		}
 
+		// Locks don't record whether a branch is the default, so a locked
+		// branch is checked again as the source marks it.
+		if !found {
+			if dv, ok := s.lockedDefaultBranch(id, v); ok && constraint.Matches(dv) {
+				v = dv
+				found = true
+			}
+		}
+
 		if !found {
 			// No match found, which means we're going to be breaking the lock
 			s.b.breakLock()
@@ -876,6 +1247,30 @@ func (s *solver) getLockVersionIfValid(id ProjectIdentifier) (Version, error) {
 	return v, nil
 }
 
+// lockedDefaultBranch returns the given locked version marked as the default
+// branch, if it is a branch, and the source reports it as the project's default
+// branch. The locked revision, if any, is kept.
+func (s *solver) lockedDefaultBranch(id ProjectIdentifier, v Version) (Version, bool) {
+	var r Revision
+	if pv, ok := v.(versionPair); ok {
+		v, r = pv.v, pv.r
+	}
+	bv, ok := v.(branchVersion)
+	if !ok {
+		return nil, false
+	}
+
+	dv, err := s.b.DefaultBranch(id)
+	if err != nil || !dv.Unpair().Matches(bv) {
+		return nil, false
+	}
+
+	if r != "" {
+		return dv.Unpair().Is(r), true
+	}
+	return dv.Unpair(), true
+}
+
 // backtrack works backwards from the current failed solution to find the next
 // solution to try.
 func (s *solver) backtrack() bool {
@@ -1070,6 +1465,9 @@ func (s *solver) selectAtom(a atomWithPackages, pkgonly bool) {
 	// selection stack
 	a.pl = pl
 	s.sel.pushSelection(a, pkgonly)
+	if ptree, err := s.b.ListPackages(a.a.id, a.a.v); err == nil {
+		s.pg.add(a.a.id, ptree, pl, s.rd.isIgnored)
+	}
 
 	// If this atom has a lock, pull it out so that we can potentially inject
 	// preferred versions into any bmis we enqueue
@@ -1142,6 +1540,7 @@ func (s *solver) selectAtom(a atomWithPackages, pkgonly bool) {
 func (s *solver) unselectLast() (atomWithPackages, bool) {
 	s.mtr.push("unselect")
 	awp, first := s.sel.popSelection()
+	s.pg.remove(awp.pl)
 	heap.Push(s.unsel, bimodalIdentifier{id: awp.a.id, pl: awp.pl})
 
 	_, deps, err := s.getImportsAndConstraintsOf(awp)
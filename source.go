@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 )
 
 // sourceExistence values represent the extent to which a project "exists."
@@ -50,6 +51,8 @@ type source interface {
 	getManifestAndLock(ProjectRoot, Version) (Manifest, Lock, error)
 	listPackages(ProjectRoot, Version) (PackageTree, error)
 	listVersions() ([]Version, error)
+	versionTimes() (map[UnpairedVersion]time.Time, error)
+	commitsBetween(from, to Revision) (int, error)
 	revisionPresentIn(Revision) (bool, error)
 }
 
@@ -59,6 +62,9 @@ type sourceMetaCache struct {
 	ptrees map[Revision]PackageTree
 	vMap   map[UnpairedVersion]Revision
 	rMap   map[Revision][]UnpairedVersion
+	// Commit times of revisions. Unlike the version maps, these can never go
+	// stale, so they're kept across version list refreshes.
+	times map[Revision]time.Time
 	// TODO(sdboyer) mutexes. actually probably just one, b/c complexity
 }
 
@@ -82,6 +88,7 @@ func newMetaCache() *sourceMetaCache {
 		ptrees: make(map[Revision]PackageTree),
 		vMap:   make(map[UnpairedVersion]Revision),
 		rMap:   make(map[Revision][]UnpairedVersion),
+		times:  make(map[Revision]time.Time),
 	}
 }
 
@@ -104,6 +111,11 @@ type baseVCSSource struct {
 	// their listVersions func into the baseSource, for use as needed.
 	lvfunc func() (vlist []Version, err error)
 
+	// rtfunc allows the other vcs source types that embed this type to inject
+	// the func that reads commit times for a set of revisions from the local
+	// repository.
+	rtfunc func(revs []Revision) (map[Revision]time.Time, error)
+
 	// Mutex to ensure only one listVersions runs at a time
 	//
 	// TODO(sdboyer) this is a horrible one-off hack, and must be removed once
@@ -248,6 +260,49 @@ func (bs *baseVCSSource) revisionPresentIn(r Revision) (bool, error) {
 	return bs.crepo.r.IsReference(string(r)), nil
 }
 
+// versionTimes reports the time at which the revision underlying each of the
+// source's versions was committed.
+//
+// Times are read from the local repository, so it is fully synced first to
+// ensure it contains every revision in the version list. Versions whose
+// revision time can't be read are omitted.
+func (bs *baseVCSSource) versionTimes() (map[UnpairedVersion]time.Time, error) {
+	if err := bs.syncLocal(); err != nil {
+		return nil, err
+	}
+
+	bs.lvmut.Lock()
+	defer bs.lvmut.Unlock()
+
+	var revs []Revision
+	for r := range bs.dc.rMap {
+		if _, has := bs.dc.times[r]; !has {
+			revs = append(revs, r)
+		}
+	}
+
+	if len(revs) > 0 {
+		bs.crepo.mut.RLock()
+		rt, err := bs.rtfunc(revs)
+		bs.crepo.mut.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+
+		for r, t := range rt {
+			bs.dc.times[r] = t
+		}
+	}
+
+	vt := make(map[UnpairedVersion]time.Time, len(bs.dc.vMap))
+	for v, r := range bs.dc.vMap {
+		if t, has := bs.dc.times[r]; has {
+			vt[v] = t
+		}
+	}
+	return vt, nil
+}
+
 func (bs *baseVCSSource) ensureCacheExistence() error {
 	// Technically, methods could could attempt to return straight from the
 	// metadata cache even if the repo cache doesn't exist on disk. But that
@@ -37,6 +37,18 @@ type SourceManager interface {
 	// repository name.
 	ListVersions(ProjectIdentifier) ([]Version, error)
 
+	// VersionTimes reports, for each of a repository's versions, the time at
+	// which the revision it is paired with was committed.
+	VersionTimes(ProjectIdentifier) (map[UnpairedVersion]time.Time, error)
+
+	// CommitsBetween counts the commits in a repository that are reachable
+	// from the second revision, but not from the first.
+	CommitsBetween(id ProjectIdentifier, from, to Revision) (int, error)
+
+	// DefaultBranch returns the default branch of a repository, paired with
+	// the revision at its head.
+	DefaultBranch(ProjectIdentifier) (PairedVersion, error)
+
 	// RevisionPresentIn indicates whether the provided Version is present in
 	// the given repository.
 	RevisionPresentIn(ProjectIdentifier, Revision) (bool, error)
@@ -393,6 +405,111 @@ func (sm *SourceMgr) ListVersions(id ProjectIdentifier) ([]Version, error) {
 	return src.listVersions()
 }
 
+// VersionTimes reports, for each of the available versions of a given
+// repository, the time at which the revision underlying it was committed. The
+// map is keyed by the unpaired form of each version returned from
+// ListVersions().
+//
+// Commit times are read from the local cache of the repository, which is
+// fully synced on the first call if it wasn't already. Versions whose time
+// couldn't be determined are omitted.
+func (sm *SourceMgr) VersionTimes(id ProjectIdentifier) (map[UnpairedVersion]time.Time, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return nil, smIsReleased{}
+	}
+	atomic.AddInt32(&sm.opcount, 1)
+	sm.glock.RLock()
+	defer func() {
+		sm.glock.RUnlock()
+		atomic.AddInt32(&sm.opcount, -1)
+	}()
+
+	src, err := sm.getSourceFor(id)
+	if err != nil {
+		// TODO(sdboyer) More-er proper-er errors
+		return nil, err
+	}
+
+	return src.versionTimes()
+}
+
+// CommitsBetween counts the commits in the given repository that are reachable
+// from the to revision, but not from the from revision. When to is a later
+// revision on the same line of history as from, this is the number of commits
+// by which to is ahead.
+//
+// The local cache of the repository is fully synced on the first call, if it
+// wasn't already.
+func (sm *SourceMgr) CommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return 0, smIsReleased{}
+	}
+	atomic.AddInt32(&sm.opcount, 1)
+	sm.glock.RLock()
+	defer func() {
+		sm.glock.RUnlock()
+		atomic.AddInt32(&sm.opcount, -1)
+	}()
+
+	src, err := sm.getSourceFor(id)
+	if err != nil {
+		// TODO(sdboyer) More-er proper-er errors
+		return 0, err
+	}
+
+	return src.commitsBetween(from, to)
+}
+
+// DefaultBranch returns the default branch of the given repository, paired
+// with the revision at its head. Which branch is the default is determined
+// by the type of source: for git, it's the branch that upstream's HEAD refers
+// to; for hg, the "default" branch, unless there's an "@" bookmark; and for
+// bzr, the trunk. For gopkg.in, it's the newest branch matching the major
+// version in the import path.
+//
+// An error is returned if the repository has no default branch.
+func (sm *SourceMgr) DefaultBranch(id ProjectIdentifier) (PairedVersion, error) {
+	if atomic.CompareAndSwapInt32(&sm.releasing, 1, 1) {
+		return nil, smIsReleased{}
+	}
+	atomic.AddInt32(&sm.opcount, 1)
+	sm.glock.RLock()
+	defer func() {
+		sm.glock.RUnlock()
+		atomic.AddInt32(&sm.opcount, -1)
+	}()
+
+	src, err := sm.getSourceFor(id)
+	if err != nil {
+		// TODO(sdboyer) More-er proper-er errors
+		return nil, err
+	}
+
+	vl, err := src.listVersions()
+	if err != nil {
+		return nil, err
+	}
+	return defaultBranchIn(id, vl)
+}
+
+// defaultBranchIn finds the default branch in a project's version list. If
+// more than one branch is marked as the default, it picks the one the solver
+// would prefer.
+func defaultBranchIn(id ProjectIdentifier, vl []Version) (PairedVersion, error) {
+	var defs []Version
+	for _, v := range vl {
+		if pv, ok := v.(PairedVersion); ok && DefaultBranchConstraint().Matches(pv) {
+			defs = append(defs, pv)
+		}
+	}
+
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("%s has no default branch", id.errString())
+	}
+	SortForUpgrade(defs)
+	return defs[0].(PairedVersion), nil
+}
+
 // RevisionPresentIn indicates whether the provided Revision is present in the given
 // repository.
 func (sm *SourceMgr) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
@@ -498,7 +615,16 @@ func (sm *SourceMgr) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 		atomic.AddInt32(&sm.opcount, -1)
 	}()
 
-	if prefix, root, has := sm.rootxt.LongestPrefix(ip); has {
+	prefix, root, has := sm.rootxt.LongestPrefix(ip)
+	if has && !strings.HasPrefix(string(root), "gopkg.in/") {
+		// A root already known for a repository doesn't apply to an import
+		// path that adds a major version suffix to it, as that's a distinct
+		// project.
+		if _, _, suffixed := majorVersionSuffix(string(root), ip); suffixed {
+			has = false
+		}
+	}
+	if has {
 		// The non-matching tail of the import path could still be malformed.
 		// Validate just that part, if it exists
 		if prefix != ip {
@@ -3,9 +3,14 @@ package gps
 import (
 	"io/ioutil"
 	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestGitSourceInteractions(t *testing.T) {
@@ -109,6 +114,198 @@ func TestGitSourceInteractions(t *testing.T) {
 	}
 }
 
+// mkLocalGitUpstream creates a small upstream git repository with known commit
+// times in the given directory, and returns its URL. Its first commit, from
+// 2016-01-01, is tagged v1.0.0 and nonsemver, and is the head of the dev
+// branch. The second, from 2016-06-01, has an annotated v1.1.0 tag. The third
+// and fourth, from 2016-08-01 and 2016-09-01, are tagged v2.0.0 and v2.1.0,
+// and the fourth is the head of git's initial branch, of trunk (the default
+// branch) and of mirror.
+func mkLocalGitUpstream(t *testing.T, up string) *url.URL {
+	git := func(date string, args ...string) {
+		c := exec.Command("git", args...)
+		c.Dir = up
+		c.Env = mergeEnvLists([]string{
+			"GIT_AUTHOR_NAME=gps", "GIT_AUTHOR_EMAIL=gps@example.com", "GIT_AUTHOR_DATE=" + date,
+			"GIT_COMMITTER_NAME=gps", "GIT_COMMITTER_EMAIL=gps@example.com", "GIT_COMMITTER_DATE=" + date,
+		}, os.Environ())
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %s\n%s", args, err, out)
+		}
+	}
+	if err := os.MkdirAll(up, 0777); err != nil {
+		t.Fatal(err)
+	}
+	git("", "init", "-q")
+	git("2016-01-01T00:00:00Z", "commit", "-q", "--allow-empty", "-m", "first")
+	git("", "tag", "v1.0.0")
+	git("", "tag", "nonsemver")
+	git("2016-06-01T00:00:00Z", "commit", "-q", "--allow-empty", "-m", "second")
+	git("2016-07-01T00:00:00Z", "tag", "-a", "-m", "annotated", "v1.1.0")
+	git("2016-08-01T00:00:00Z", "commit", "-q", "--allow-empty", "-m", "third")
+	git("", "tag", "v2.0.0")
+	git("2016-09-01T00:00:00Z", "commit", "-q", "--allow-empty", "-m", "fourth")
+	git("", "tag", "v2.1.0")
+	git("", "branch", "-f", "dev", "v1.0.0")
+	// Make the default branch one that shares its head with other branches,
+	// including git's own initial branch, so that only HEAD's symref can tell
+	// which is the default.
+	git("", "checkout", "-q", "-b", "trunk")
+	git("", "branch", "-f", "mirror", "trunk")
+
+	u, err := url.Parse("file://" + filepath.ToSlash(up))
+	if err != nil {
+		t.Fatalf("Bad URL: %s", err)
+	}
+	return u
+}
+
+// TestLocalGitSource exercises the parts of gitSource that work from the local
+// cache repository, using a small upstream repository created on the fly.
+func TestLocalGitSource(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "localgit")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer removeAll(tmp)
+
+	u := mkLocalGitUpstream(t, filepath.Join(tmp, "upstream"))
+	isrc, _, err := maybeGitSource{url: u}.try(filepath.Join(tmp, "cache"), naiveAnalyzer{})
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
+	}
+
+	vt, err := isrc.versionTimes()
+	if err != nil {
+		t.Fatalf("Unexpected error getting version times: %s", err)
+	}
+
+	first := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	fourth := time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC)
+	// Annotated tags report the time of the commit, not the tag
+	evt := map[UnpairedVersion]time.Time{
+		NewVersion("v1.0.0"):    first,
+		NewVersion("nonsemver"): first,
+		NewVersion("v1.1.0"):    second,
+		NewVersion("v2.0.0"):    time.Date(2016, 8, 1, 0, 0, 0, 0, time.UTC),
+		NewVersion("v2.1.0"):    fourth,
+		NewBranch("dev"):        first,
+	}
+	for v, et := range evt {
+		if got, has := vt[v]; !has {
+			t.Errorf("Expected a time for %s, but got none", v)
+		} else if !got.Equal(et) {
+			t.Errorf("Expected time %s for %s, got %s", et, v, got)
+		}
+	}
+	// The initial branch is named by git's own default, so just check it's there
+	for v, got := range vt {
+		if bv, ok := v.(branchVersion); ok && bv.name != "dev" && !got.Equal(fourth) {
+			t.Errorf("Expected time %s for branch %s, got %s", fourth, v, got)
+		}
+	}
+	if len(vt) != 9 {
+		t.Errorf("Expected times for nine versions, got %v", vt)
+	}
+
+	vlist, err := isrc.listVersions()
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+	revs := make(map[string]Revision)
+	for _, v := range vlist {
+		pv := v.(PairedVersion)
+		revs[pv.Unpair().String()] = pv.Underlying()
+		if bv, ok := pv.Unpair().(branchVersion); ok && bv.isDefault != (bv.name == "trunk") {
+			t.Errorf("Expected only trunk to be marked as the default branch, but %s has isDefault %v", bv, bv.isDefault)
+		}
+	}
+
+	id := mkPI("localgit")
+	if dv, err := defaultBranchIn(id, vlist); err != nil {
+		t.Errorf("Unexpected error finding default branch: %s", err)
+	} else if dv.String() != "trunk" || dv.Underlying() != revs["trunk"] {
+		t.Errorf("Expected trunk at %s as the default branch, got %s at %s", revs["trunk"], dv, dv.Underlying())
+	}
+
+	if n, err := isrc.commitsBetween(revs["dev"], revs["v1.1.0"]); err != nil {
+		t.Errorf("Unexpected error counting commits: %s", err)
+	} else if n != 1 {
+		t.Errorf("Expected v1.1.0 to be one commit ahead of dev, got %v", n)
+	}
+	if n, err := isrc.commitsBetween(revs["v1.1.0"], revs["dev"]); err != nil {
+		t.Errorf("Unexpected error counting commits: %s", err)
+	} else if n != 0 {
+		t.Errorf("Expected dev to be no commits ahead of v1.1.0, got %v", n)
+	}
+	if _, err := isrc.commitsBetween(Revision("0123456789abcdef0123456789abcdef01234567"), revs["dev"]); err == nil {
+		t.Errorf("Expected an error counting commits from a nonexistent revision")
+	}
+}
+
+func TestMajorVersionSource(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "majorgit")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer removeAll(tmp)
+
+	u := mkLocalGitUpstream(t, filepath.Join(tmp, "upstream"))
+	mb := maybeMajorSource{mb: maybeGitSource{url: u}, major: 2}
+	isrc, ident, err := mb.try(filepath.Join(tmp, "cache"), naiveAnalyzer{})
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up major version source for test repo: %s", err)
+	}
+
+	if want := u.String() + " (v2)"; ident != want {
+		t.Errorf("Expected %q as the source ident, got %q", want, ident)
+	}
+
+	vlist, err := isrc.listVersions()
+	if err != nil {
+		t.Fatalf("Unexpected error listing versions: %s", err)
+	}
+
+	var tags []string
+	var branches int
+	for _, v := range vlist {
+		switch tv := v.(PairedVersion).Unpair().(type) {
+		case semVersion:
+			tags = append(tags, tv.String())
+		case branchVersion:
+			branches++
+		default:
+			t.Errorf("Unexpected version %s of type %T in major version source", v, tv)
+		}
+	}
+	sort.Strings(tags)
+	if !reflect.DeepEqual(tags, []string{"v2.0.0", "v2.1.0"}) {
+		t.Errorf("Expected only the v2 tags, got %v", tags)
+	}
+	// dev, trunk and mirror, plus git's own initial branch
+	if branches != 4 {
+		t.Errorf("Expected all branches to be kept, got %v", branches)
+	}
+}
+
+func TestParseRevisionTimes(t *testing.T) {
+	out := []byte("abc123 1451606400\nnot-a-line\ndef456 1464739200 -7200\n\nghi789 notanumber\n")
+	rt := parseRevisionTimes(out)
+
+	ert := map[Revision]time.Time{
+		"abc123": time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		"def456": time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(rt, ert) {
+		t.Errorf("Unexpected revision times:\n\t(GOT): %v\n\t(WNT): %v", rt, ert)
+	}
+}
+
 func TestGopkginSourceInteractions(t *testing.T) {
 	// This test is slowish, skip it on -short
 	if testing.Short() {
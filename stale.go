@@ -0,0 +1,78 @@
+package gps
+
+import "fmt"
+
+// A StaleBranch describes a project that is locked to a branch whose head has
+// moved on from the revision recorded in the lock.
+type StaleBranch struct {
+	// Ident identifies the project.
+	Ident ProjectIdentifier
+
+	// Branch is the branch to which the project is locked.
+	Branch UnpairedVersion
+
+	// Locked is the revision of the branch recorded in the lock.
+	Locked Revision
+
+	// Head is the current head revision of the branch upstream. It is empty
+	// if the branch no longer exists.
+	Head Revision
+
+	// Commits is the number of commits on the branch since the locked
+	// revision. It is -1 if the number could not be determined - for example,
+	// if the branch has been deleted, or the locked revision is no longer
+	// present upstream.
+	Commits int
+}
+
+// StaleBranches checks each project in the lock that is locked to a branch,
+// and reports those whose branch head has moved since the lock was written.
+// Projects locked to a tag or a bare revision are not considered.
+//
+// The current branch heads are taken from the SourceManager's ListVersions(),
+// so they are only as fresh as its version lists. The results are sorted by
+// ProjectRoot.
+func StaleBranches(sm SourceManager, l Lock) ([]StaleBranch, error) {
+	lps := make([]LockedProject, len(l.Projects()))
+	copy(lps, l.Projects())
+	SortLockedProjects(lps)
+
+	var stale []StaleBranch
+	for _, lp := range lps {
+		bv, ok := lp.v.(branchVersion)
+		if !ok || lp.r == "" {
+			continue
+		}
+
+		vl, err := sm.ListVersions(lp.pi)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s: %s", lp.pi.errString(), err)
+		}
+
+		sb := StaleBranch{
+			Ident:   lp.pi,
+			Branch:  bv,
+			Locked:  lp.r,
+			Commits: -1,
+		}
+		for _, v := range vl {
+			if pv, ok := v.(PairedVersion); ok && pv.Matches(bv) {
+				sb.Head = pv.Underlying()
+				break
+			}
+		}
+
+		if sb.Head == lp.r {
+			continue
+		}
+
+		if sb.Head != "" {
+			if n, err := sm.CommitsBetween(lp.pi, lp.r, sb.Head); err == nil {
+				sb.Commits = n
+			}
+		}
+		stale = append(stale, sb)
+	}
+
+	return stale, nil
+}
@@ -0,0 +1,82 @@
+package gps
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// countSM is a SourceManager that counts commits between revisions from a
+// fixed table, rather than from real repositories.
+type countSM struct {
+	*depspecSourceManager
+	counts map[[2]Revision]int
+}
+
+func (sm *countSM) CommitsBetween(id ProjectIdentifier, from, to Revision) (int, error) {
+	if n, has := sm.counts[[2]Revision{from, to}]; has {
+		return n, nil
+	}
+	return 0, fmt.Errorf("revision %s not present in %s", from, id.errString())
+}
+
+func TestStaleBranches(t *testing.T) {
+	sm := &countSM{
+		depspecSourceManager: newdepspecSM([]depspec{
+			mkDepspec("root 0.0.0"),
+			mkDepspec("foo bmaster foorev3"),
+			mkDepspec("foo 1.0.0 foorev1"),
+			mkDepspec("bar bdev barrev2"),
+			mkDepspec("baz 1.0.0 bazrev2"),
+			mkDepspec("qux bmaster quxrev1"),
+			mkDepspec("quux bmaster quuxrev9"),
+		}, nil),
+		counts: map[[2]Revision]int{
+			{"foorev1", "foorev3"}: 2,
+		},
+	}
+
+	l := SimpleLock{
+		NewLockedProject(mkPI("quux"), NewBranch("master").Is("quuxrev5"), nil),
+		NewLockedProject(mkPI("foo"), NewBranch("master").Is("foorev1"), nil),
+		NewLockedProject(mkPI("bar"), NewBranch("dev").Is("barrev2"), nil),
+		NewLockedProject(mkPI("baz"), NewVersion("1.0.0").Is("bazrev1"), nil),
+		NewLockedProject(mkPI("qux"), NewBranch("gone").Is("quxrev1"), nil),
+	}
+
+	stale, err := StaleBranches(sm, l)
+	if err != nil {
+		t.Fatalf("Unexpected error checking for stale branches: %s", err)
+	}
+
+	expect := []StaleBranch{
+		{
+			Ident:   mkPI("foo"),
+			Branch:  NewBranch("master"),
+			Locked:  "foorev1",
+			Head:    "foorev3",
+			Commits: 2,
+		},
+		{
+			Ident:   mkPI("quux"),
+			Branch:  NewBranch("master"),
+			Locked:  "quuxrev5",
+			Head:    "quuxrev9",
+			Commits: -1,
+		},
+		{
+			Ident:   mkPI("qux"),
+			Branch:  NewBranch("gone"),
+			Locked:  "quxrev1",
+			Commits: -1,
+		},
+	}
+	if !reflect.DeepEqual(stale, expect) {
+		t.Errorf("Unexpected stale branches:\n\t(GOT): %v\n\t(WNT): %v", stale, expect)
+	}
+
+	l = append(l, NewLockedProject(mkPI("nope"), NewBranch("master").Is("nooperev"), nil))
+	if _, err = StaleBranches(sm, l); err == nil {
+		t.Errorf("Expected an error for a locked project that can't be found")
+	}
+}
@@ -0,0 +1,107 @@
+package gps
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// toolBuildTimeout is the amount of time a tool build may go without producing
+// any output before it is killed.
+const toolBuildTimeout = 2 * time.Minute
+
+// InstallTools builds the binaries for the provided tool packages (typically,
+// the keys of ToolManifest.ToolDependencies()) from the dependency tree
+// previously written to basedir by WriteDepTree, and places them in bindir. A
+// tool's binary is named for the last element of its import path.
+//
+// Tools are built with the go tool in GOPATH mode, from within basedir, so that
+// they are compiled against the exported versions of their own dependencies.
+// basedir must therefore be inside the src directory of one of the workspaces
+// in GOPATH - typically, as the vendor directory of a project in a GOPATH - and
+// an error is returned if it is not. The go tool is run with GOPATH set to that
+// workspace, and with module mode disabled.
+//
+// bindir is created if it does not already exist; existing binaries for the
+// tools are replaced.
+func InstallTools(basedir, bindir string, tools []string) error {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	basedir, err := filepath.Abs(basedir)
+	if err != nil {
+		return err
+	}
+	gopath, has := gopathContaining(basedir)
+	if !has {
+		return fmt.Errorf("cannot build tools from %s, as it is not within the src directory of a GOPATH workspace", basedir)
+	}
+
+	bindir, err = filepath.Abs(bindir)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(bindir, 0777); err != nil {
+		return err
+	}
+
+	sorted := make([]string, len(tools))
+	copy(sorted, tools)
+	sort.Strings(sorted)
+
+	env := mergeEnvLists([]string{"GOPATH=" + gopath, "GO111MODULE=off"}, os.Environ())
+	for _, tool := range sorted {
+		dir := filepath.Join(basedir, filepath.FromSlash(tool))
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("tool %s is not present in the dependency tree at %s", tool, basedir)
+		}
+
+		bin := filepath.Join(bindir, path.Base(tool))
+		if runtime.GOOS == "windows" {
+			bin += ".exe"
+		}
+
+		cmd := exec.Command("go", "build", "-o", bin, ".")
+		cmd.Dir = dir
+		cmd.Env = env
+		if out, err := newMonitoredCmd(cmd, toolBuildTimeout).combinedOutput(); err != nil {
+			return fmt.Errorf("failed to build tool %s: %s\n%s", tool, err, out)
+		}
+	}
+
+	return nil
+}
+
+// gopathContaining returns the GOPATH workspace whose src directory contains
+// the provided absolute path. GOPATH is read from the environment, falling back
+// to the go tool's default.
+func gopathContaining(dir string) (string, bool) {
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		gopath = build.Default.GOPATH
+	}
+
+	for _, gp := range filepath.SplitList(gopath) {
+		if gp == "" {
+			continue
+		}
+		gp, err := filepath.Abs(gp)
+		if err != nil {
+			continue
+		}
+
+		src := filepath.Join(gp, "src")
+		if rel, err := filepath.Rel(src, dir); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return gp, true
+		}
+	}
+	return "", false
+}
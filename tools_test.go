@@ -0,0 +1,63 @@
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestInstallTools(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "installtools")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Tools can only be built from within a GOPATH
+	defer os.Setenv("GOPATH", os.Getenv("GOPATH"))
+	os.Setenv("GOPATH", tmp)
+	bindir := filepath.Join(tmp, "bin")
+
+	err = InstallTools(filepath.Join(tmp, "vendor"), bindir, []string{"example.com/tool/cmd/tool"})
+	if err == nil {
+		t.Error("Expected error when installing tools from outside a GOPATH")
+	} else if !strings.Contains(err.Error(), "not within the src directory of a GOPATH workspace") {
+		t.Errorf("Unexpected error when installing tools from outside a GOPATH: %s", err)
+	}
+
+	basedir := filepath.Join(tmp, "src", "example.com", "proj", "vendor")
+	err = InstallTools(basedir, bindir, []string{"example.com/tool/cmd/nope"})
+	if err == nil {
+		t.Error("Expected error when installing a tool not in the dependency tree")
+	} else if !strings.Contains(err.Error(), "is not present in the dependency tree") {
+		t.Errorf("Unexpected error when installing a missing tool: %s", err)
+	}
+
+	if testing.Short() {
+		t.Skip("Skipping tool build test in short mode")
+	}
+
+	tooldir := filepath.Join(basedir, "example.com", "tool", "cmd", "tool")
+	if err = os.MkdirAll(tooldir, 0777); err != nil {
+		t.Fatalf("Failed to create tool dir: %s", err)
+	}
+	src := "package main\n\nfunc main() {}\n"
+	if err = ioutil.WriteFile(filepath.Join(tooldir, "main.go"), []byte(src), 0666); err != nil {
+		t.Fatalf("Failed to write tool source: %s", err)
+	}
+
+	if err = InstallTools(basedir, bindir, []string{"example.com/tool/cmd/tool"}); err != nil {
+		t.Fatalf("Unexpected error installing tool: %s", err)
+	}
+
+	bin := filepath.Join(bindir, "tool")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	if _, err = os.Stat(bin); err != nil {
+		t.Errorf("Expected tool binary at %s: %s", bin, err)
+	}
+}
@@ -165,12 +165,58 @@ type ProjectProperties struct {
 
 // Package represents a Go package. It contains a subset of the information
 // go/build.Package does.
+//
+// A directory that contains only non-Go source files - for example, C headers
+// included by a cgo package elsewhere - can't be imported, and so is reported
+// as a *build.NoGoError in its PackageOrErr. A Package with only ImportPath and
+// OtherFiles populated accompanies the error.
 type Package struct {
 	Name        string   // Package name, as declared in the package statement
 	ImportPath  string   // Full import path, including the prefix provided to ListPackages()
 	CommentPath string   // Import path given in the comment on the package statement
-	Imports     []string // Imports from all go and cgo files
+	Imports     []string // Imports from all go and cgo files, excluding "C"
 	TestImports []string // Imports from all go test files (in go/build parlance: both TestImports and XTestImports)
+
+	Cgo         bool     // Whether any of the package's non-test files import "C"
+	RequiresCgo bool     // Whether the package has no non-test files that can be built with cgo disabled
+	OtherFiles  []string // Non-Go source files the go tool may build (C, assembly, etc.), sorted
+
+	// The build constraints under which each conditional import in Imports
+	// and TestImports, respectively, applies. Imports that apply in every
+	// build do not appear; if there are no conditional imports, these are nil.
+	ImportConstraints     map[string]BuildConstraint
+	TestImportConstraints map[string]BuildConstraint
+
+	// Per-file information about the package's source files, sorted by file
+	// name. This is only populated by ListPackagesWithFiles; it is nil
+	// otherwise.
+	Files []SourceFile
+}
+
+// SourceFile describes a single Go source file within a Package.
+type SourceFile struct {
+	Name       string          // File name, relative to the package's directory
+	Imports    []string        // Imports made by the file, sorted
+	Constraint BuildConstraint // Build constraints from +build lines and the file name
+	Test       bool            // Whether the file is a _test.go file
+	XTest      bool            // Whether the file is in the external (_test suffixed) test package
+	Cgo        bool            // Whether the file imports "C"
+}
+
+// FilesImporting returns the names of the package's files that import the
+// provided path. Only the files recorded in Files are considered, so this
+// always returns nil for Packages created without per-file information.
+func (p Package) FilesImporting(path string) []string {
+	var names []string
+	for _, f := range p.Files {
+		for _, imp := range f.Imports {
+			if imp == path {
+				names = append(names, f.Name)
+				break
+			}
+		}
+	}
+	return names
 }
 
 // bimodalIdentifiers are used to track work to be done in the unselected queue.
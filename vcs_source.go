@@ -6,8 +6,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/Masterminds/vcs"
@@ -141,7 +143,12 @@ func (s *gitSource) listVersions() (vlist []Version, err error) {
 func (s *gitSource) doListVersions() (vlist []Version, err error) {
 	r := s.crepo.r
 	var out []byte
-	c := exec.Command("git", "ls-remote", r.Remote())
+	// The name of the default branch, if we can find out what it is
+	var defbranch string
+	// --symref has ls-remote report the branch that HEAD refers to, which is
+	// the upstream default branch. Versions of git too old to support it fail
+	// here, and fall back to a local listing.
+	c := exec.Command("git", "ls-remote", "--symref", r.Remote())
 	// Ensure no prompting for PWs
 	c.Env = mergeEnvLists([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ())
 	out, err = c.CombinedOutput()
@@ -171,6 +178,13 @@ func (s *gitSource) doListVersions() (vlist []Version, err error) {
 
 		s.crepo.mut.RLock()
 		out, err = r.RunFromDir("git", "show-ref", "--dereference")
+		if err == nil {
+			// The clone's record of upstream's HEAD names the default branch.
+			// Failing to read it isn't fatal; we just fall back to guessing.
+			if ref, rerr := r.RunFromDir("git", "symbolic-ref", "refs/remotes/origin/HEAD"); rerr == nil {
+				defbranch = strings.TrimPrefix(string(bytes.TrimSpace(ref)), "refs/remotes/origin/")
+			}
+		}
 		s.crepo.mut.RUnlock()
 		if err != nil {
 			// TODO(sdboyer) More-er proper-er error
@@ -187,9 +201,21 @@ func (s *gitSource) doListVersions() (vlist []Version, err error) {
 	s.ex.s |= existsUpstream
 	s.ex.f |= existsUpstream
 
-	// Pull out the HEAD rev (it's always first) so we know what branches to
-	// mark as default. This is, perhaps, not the best way to glean this, but it
-	// was good enough for git itself until 1.8.5. Also, the alternative is
+	// With --symref, ls-remote's first line names the branch HEAD refers to.
+	if bytes.HasPrefix(all[0], []byte("ref: refs/heads/")) {
+		if idx := bytes.IndexByte(all[0], '\t'); idx > 0 {
+			defbranch = string(all[0][len("ref: refs/heads/"):idx])
+		}
+		all = all[1:]
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no versions available for %s (this is weird)", r.Remote())
+	}
+
+	// If we know the name of the default branch, it's the one marked as
+	// default. Otherwise, pull out the HEAD rev (it's always first) so we know
+	// what branches to mark as default. This is, perhaps, not the best way to
+	// glean this, but it was good enough for git itself until 1.8.5. Also, the alternative is
 	// sniffing data out of the pack protocol, which is a separate request, and
 	// also waaaay more than we want to do right now.
 	//
@@ -220,12 +246,20 @@ func (s *gitSource) doListVersions() (vlist []Version, err error) {
 	uniq := 0
 	vlist = make([]Version, len(all)-1) // less 1, because always ignore HEAD
 	for _, pair := range all {
+		// Lines too short to name a branch or tag, like HEAD's, are skipped
+		if len(pair) < 52 {
+			continue
+		}
+
 		var v PairedVersion
 		if string(pair[46:51]) == "heads" {
 			rev := Revision(pair[:40])
 
-			isdef := rev == headrev
 			n := string(pair[52:])
+			isdef := rev == headrev
+			if defbranch != "" {
+				isdef = n == defbranch
+			}
 			if isdef {
 				if onedef {
 					multidef = true
@@ -283,6 +317,38 @@ func (s *gitSource) doListVersions() (vlist []Version, err error) {
 	return
 }
 
+// revisionTimes reads the commit times of the given revisions from the local
+// repository.
+func (s *gitSource) revisionTimes(revs []Revision) (map[Revision]time.Time, error) {
+	args := []string{"show", "-s", "--format=%H %ct"}
+	for _, r := range revs {
+		args = append(args, string(r))
+	}
+
+	out, err := s.crepo.r.RunFromDir("git", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, string(out))
+	}
+	return parseRevisionTimes(out), nil
+}
+
+// commitsBetween counts the commits reachable from the to revision, but not
+// from the from revision.
+func (s *gitSource) commitsBetween(from, to Revision) (int, error) {
+	if err := s.syncLocal(); err != nil {
+		return 0, err
+	}
+
+	s.crepo.mut.RLock()
+	out, err := s.crepo.r.RunFromDir("git", "rev-list", "--count", string(from)+".."+string(to))
+	s.crepo.mut.RUnlock()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", err, string(out))
+	}
+
+	return strconv.Atoi(string(bytes.TrimSpace(out)))
+}
+
 // gopkginSource is a specialized git source that performs additional filtering
 // according to the input URL.
 type gopkginSource struct {
@@ -379,6 +445,37 @@ func (s *gopkginSource) listVersions() (vlist []Version, err error) {
 	return
 }
 
+// majorVersionSource restricts a source to the versions belonging to a single
+// major version, for import paths with a /vN major version suffix. Semver tags
+// with another major version, and non-semver tags, are omitted; all branches
+// are kept, as it's common for development of the newest major version to
+// happen on the default branch.
+type majorVersionSource struct {
+	source
+	major uint64
+}
+
+func (s *majorVersionSource) listVersions() ([]Version, error) {
+	ovlist, err := s.source.listVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	vlist := make([]Version, 0, len(ovlist))
+	for _, v := range ovlist {
+		// all source versions will always be paired
+		switch tv := v.(PairedVersion).Unpair().(type) {
+		case semVersion:
+			if tv.sv.Major() == s.major {
+				vlist = append(vlist, v)
+			}
+		case branchVersion:
+			vlist = append(vlist, v)
+		}
+	}
+	return vlist, nil
+}
+
 // bzrSource is a generic bzr repository implementation that should work with
 // all standard bazaar remotes.
 type bzrSource struct {
@@ -467,6 +564,48 @@ func (s *bzrSource) listVersions() (vlist []Version, err error) {
 	return
 }
 
+// revisionTimes reads the commit times of the given revisions from the local
+// repository.
+//
+// bzr can't report on more than one arbitrary revision at a time, so this
+// asks about each revision in turn.
+func (s *bzrSource) revisionTimes(revs []Revision) (map[Revision]time.Time, error) {
+	rt := make(map[Revision]time.Time, len(revs))
+	for _, r := range revs {
+		out, err := s.crepo.r.RunFromDir("bzr", "version-info", "--custom", "--template={date}", "--revision=revid:"+string(r))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", err, string(out))
+		}
+
+		t, err := time.Parse("2006-01-02 15:04:05 -0700", string(bytes.TrimSpace(out)))
+		if err != nil {
+			continue
+		}
+		rt[r] = t.UTC()
+	}
+	return rt, nil
+}
+
+// commitsBetween counts the commits reachable from the to revision, but not
+// from the from revision.
+//
+// bzr includes the from revision in the range it logs, so it's subtracted
+// from the count.
+func (s *bzrSource) commitsBetween(from, to Revision) (int, error) {
+	if err := s.syncLocal(); err != nil {
+		return 0, err
+	}
+
+	s.crepo.mut.RLock()
+	out, err := s.crepo.r.RunFromDir("bzr", "log", "--line", "-n0", "--revision=revid:"+string(from)+"..revid:"+string(to))
+	s.crepo.mut.RUnlock()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", err, string(out))
+	}
+
+	return countLines(out) - 1, nil
+}
+
 // hgSource is a generic hg repository implementation that should work with
 // all standard mercurial servers.
 type hgSource struct {
@@ -622,6 +761,69 @@ func (s *hgSource) listVersions() (vlist []Version, err error) {
 	return
 }
 
+// revisionTimes reads the commit times of the given revisions from the local
+// repository.
+func (s *hgSource) revisionTimes(revs []Revision) (map[Revision]time.Time, error) {
+	args := []string{"log", "--template", "{node} {date|hgdate}\n"}
+	for _, r := range revs {
+		args = append(args, "-r", string(r))
+	}
+
+	out, err := s.crepo.r.RunFromDir("hg", args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, string(out))
+	}
+	return parseRevisionTimes(out), nil
+}
+
+// commitsBetween counts the commits reachable from the to revision, but not
+// from the from revision.
+func (s *hgSource) commitsBetween(from, to Revision) (int, error) {
+	if err := s.syncLocal(); err != nil {
+		return 0, err
+	}
+
+	s.crepo.mut.RLock()
+	out, err := s.crepo.r.RunFromDir("hg", "log", "--template", "{node}\n", "-r", fmt.Sprintf("only(%s, %s)", to, from))
+	s.crepo.mut.RUnlock()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", err, string(out))
+	}
+
+	return countLines(out), nil
+}
+
+// countLines counts the non-empty lines in command output.
+func countLines(out []byte) int {
+	var n int
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// parseRevisionTimes parses lines of the form "<revision> <unix time> ...", as
+// produced by the git and hg commands that report on revision times. Lines
+// that don't fit the form are skipped.
+func parseRevisionTimes(out []byte) map[Revision]time.Time {
+	rt := make(map[Revision]time.Time)
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		f := strings.Fields(string(line))
+		if len(f) < 2 {
+			continue
+		}
+
+		sec, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		rt[Revision(f[0])] = time.Unix(sec, 0).UTC()
+	}
+	return rt
+}
+
 type repo struct {
 	// Path to the root of the default working copy (NOT the repo itself)
 	rpath string
@@ -673,10 +875,18 @@ NextVar:
 }
 
 func stripVendor(path string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+
 	if info.Name() == "vendor" {
 		if _, err := os.Lstat(path); err == nil {
 			if info.IsDir() {
-				return removeAll(path)
+				if err := removeAll(path); err != nil {
+					return err
+				}
+				// Don't try to walk into the dir we just removed
+				return filepath.SkipDir
 			}
 		}
 	}
@@ -3,6 +3,7 @@ package gps
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/Masterminds/semver"
 )
@@ -150,6 +151,8 @@ func (r Revision) MatchesAny(c Constraint) bool {
 		return false
 	case versionTypeUnion:
 		return tc.MatchesAny(r)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.MatchesAny(r)
 	case Revision:
 		return r == tc
 	case versionPair:
@@ -170,6 +173,8 @@ func (r Revision) Intersect(c Constraint) Constraint {
 		return none
 	case versionTypeUnion:
 		return tc.Intersect(r)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(r)
 	case Revision:
 		if r == tc {
 			return r
@@ -218,6 +223,8 @@ func (v branchVersion) MatchesAny(c Constraint) bool {
 		return false
 	case versionTypeUnion:
 		return tc.MatchesAny(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.MatchesAny(v)
 	case branchVersion:
 		return v.name == tc.name
 	case versionPair:
@@ -237,6 +244,8 @@ func (v branchVersion) Intersect(c Constraint) Constraint {
 		return none
 	case versionTypeUnion:
 		return tc.Intersect(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(v)
 	case branchVersion:
 		if v.name == tc.name {
 			return v
@@ -291,6 +300,8 @@ func (v plainVersion) MatchesAny(c Constraint) bool {
 		return false
 	case versionTypeUnion:
 		return tc.MatchesAny(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.MatchesAny(v)
 	case plainVersion:
 		return v == tc
 	case versionPair:
@@ -310,6 +321,8 @@ func (v plainVersion) Intersect(c Constraint) Constraint {
 		return none
 	case versionTypeUnion:
 		return tc.Intersect(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(v)
 	case plainVersion:
 		if v == tc {
 			return v
@@ -370,6 +383,8 @@ func (v semVersion) MatchesAny(c Constraint) bool {
 		return false
 	case versionTypeUnion:
 		return tc.MatchesAny(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.MatchesAny(v)
 	case semVersion:
 		return v.sv.Equal(tc.sv)
 	case semverConstraint:
@@ -391,6 +406,8 @@ func (v semVersion) Intersect(c Constraint) Constraint {
 		return none
 	case versionTypeUnion:
 		return tc.Intersect(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(v)
 	case semVersion:
 		if v.sv.Equal(tc.sv) {
 			return v
@@ -474,6 +491,8 @@ func (v versionPair) Intersect(c2 Constraint) Constraint {
 		return none
 	case versionTypeUnion:
 		return tc.Intersect(v)
+	case unionConstraint, exclusionConstraint, schemeConstraint, defaultBranchConstraint:
+		return tc.Intersect(v)
 	case versionPair:
 		if v.r == tc.r {
 			return v.r
@@ -579,6 +598,103 @@ func typedVersionString(v Version) string {
 	return fmt.Sprintf("%s-%s", prefix, v.String())
 }
 
+// ParseVersion parses a string in the typed form produced by
+// typedVersionString (as used in input hashes) back into the Version it
+// represents. The form is "<type>-<body>", where type is one of:
+//
+//  b:  a branch, e.g. "b-master"
+//  pv: a plain, non-semver version, e.g. "pv-foo"
+//  sv: a semver version, e.g. "sv-v1.0.0"
+//  r:  a revision, e.g. "r-f6e74e8d"
+//
+// A PairedVersion is written as its unpaired version, followed by "-" and its
+// revision: "sv-v1.0.0-r-f6e74e8d".
+//
+// Because branch names, plain versions and semver prereleases may themselves
+// contain "-r-", that separator can be ambiguous. If a version list is
+// provided (as from SourceManager.ListVersions()), the interpretation that
+// corresponds to a version in the list is chosen; otherwise, or if none does,
+// the string is split into a PairedVersion at the last "-r-".
+//
+// Branches are never parsed as the source's default branch.
+func ParseVersion(s string, vl []Version) (Version, error) {
+	var cands []Version
+	for i := len(s); i > 0; {
+		i = strings.LastIndex(s[:i], "-r-")
+		if i < 0 {
+			break
+		}
+		if rev := s[i+3:]; rev != "" {
+			if uv, err := parseUnpairedVersion(s[:i]); err == nil {
+				cands = append(cands, uv.Is(Revision(rev)))
+			}
+		}
+	}
+
+	if strings.HasPrefix(s, "r-") && len(s) > 2 {
+		cands = append(cands, Revision(s[2:]))
+	} else if uv, err := parseUnpairedVersion(s); err == nil {
+		cands = append(cands, uv)
+	}
+
+	if len(cands) == 0 {
+		return nil, fmt.Errorf("%q is not a valid typed version string", s)
+	}
+
+	if len(cands) > 1 {
+		for _, c := range cands {
+			if versionInList(c, vl) {
+				return c, nil
+			}
+		}
+	}
+	return cands[0], nil
+}
+
+// parseUnpairedVersion parses the typed string form of an UnpairedVersion.
+func parseUnpairedVersion(s string) (UnpairedVersion, error) {
+	switch {
+	case strings.HasPrefix(s, "b-") && len(s) > 2:
+		return NewBranch(s[2:]), nil
+	case strings.HasPrefix(s, "pv-") && len(s) > 3:
+		return plainVersion(s[3:]), nil
+	case strings.HasPrefix(s, "sv-"):
+		sv, err := semver.NewVersion(s[3:])
+		if err != nil {
+			return nil, err
+		}
+		return semVersion{sv: sv}, nil
+	}
+	return nil, fmt.Errorf("%q is not a valid typed unpaired version string", s)
+}
+
+// versionInList indicates whether the provided version corresponds to one in
+// the list. Unpaired versions correspond to either paired or unpaired versions
+// in the list with the same type and name; paired versions must also have the
+// same revision.
+func versionInList(v Version, vl []Version) bool {
+	same := func(a, b Version) bool {
+		return a.Type() == b.Type() && a.String() == b.String()
+	}
+
+	for _, lv := range vl {
+		switch tv := v.(type) {
+		case PairedVersion:
+			if plv, ok := lv.(PairedVersion); ok && plv.Underlying() == tv.Underlying() && same(plv.Unpair(), tv.Unpair()) {
+				return true
+			}
+		case UnpairedVersion:
+			if plv, ok := lv.(PairedVersion); ok {
+				lv = plv.Unpair()
+			}
+			if same(lv, tv) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SortForUpgrade sorts a slice of []Version in roughly descending order, so
 // that presumably newer versions are visited first. The rules are:
 //
@@ -19,6 +19,7 @@ type versionQueue struct {
 	failed       bool
 	allLoaded    bool
 	adverr       error
+	retracted    []retraction
 }
 
 func newVersionQueue(id ProjectIdentifier, lockv, prefv Version, b sourceBridge) (*versionQueue, error) {
@@ -132,6 +133,17 @@ func (vq *versionQueue) advance(fail error) error {
 	return nil
 }
 
+// retractionOf returns the retraction applying to the provided version, if the
+// version has been retracted.
+func (vq *versionQueue) retractionOf(v Version) (retraction, bool) {
+	for _, rt := range vq.retracted {
+		if rt.v.Matches(v) {
+			return rt, true
+		}
+	}
+	return retraction{}, false
+}
+
 // isExhausted indicates whether or not the queue has definitely been exhausted,
 // in which case it will return true.
 //
@@ -0,0 +1,370 @@
+package gps
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A VersionScheme defines how the version tags of a project that doesn't use
+// semver are recognized and ordered. This allows such projects to be given
+// range constraints (see NewSchemeConstraint), and to have their versions
+// sorted sensibly when upgrading or downgrading.
+//
+// The scheme for a project may be declared by its own manifest, by
+// implementing SchemeManifest, or by the root manifest, by implementing
+// VersionSchemeManifest. The root's declaration takes precedence.
+type VersionScheme interface {
+	// Name identifies the scheme. It appears in input hashes and typed
+	// constraint strings, and is used to look up registered schemes, so it
+	// must be unique.
+	Name() string
+
+	// Valid indicates whether the string is a version in the scheme.
+	Valid(v string) bool
+
+	// Compare orders two strings that are valid in the scheme, returning -1,
+	// 0 or 1 as a is older than, equivalent to, or newer than b.
+	Compare(a, b string) int
+}
+
+var (
+	// CalVer is the scheme for calendar versions made up of dot-separated
+	// numbers, such as 2026.04.1. Components are compared numerically, so
+	// 2026.04.1 and 2026.4.1 are equivalent.
+	CalVer = NumericScheme("calver", "")
+
+	// ReleaseNumbers is the scheme for versions that number releases in
+	// sequence with a "release-" prefix, such as release-12.
+	ReleaseNumbers = NumericScheme("release", "release-")
+)
+
+var (
+	schemes = map[string]VersionScheme{
+		CalVer.Name():         CalVer,
+		ReleaseNumbers.Name(): ReleaseNumbers,
+	}
+	schemesmut sync.RWMutex
+)
+
+// RegisterVersionScheme makes a VersionScheme available by name, so that
+// constraints using it can be parsed by ParseConstraint. CalVer and
+// ReleaseNumbers are always registered.
+//
+// Scheme names must be non-empty, and may not contain "-". An error is
+// returned if the name is invalid, or a different scheme is already registered
+// under it.
+func RegisterVersionScheme(vs VersionScheme) error {
+	if vs.Name() == "" || strings.Contains(vs.Name(), "-") {
+		return fmt.Errorf("invalid version scheme name %q", vs.Name())
+	}
+
+	schemesmut.Lock()
+	defer schemesmut.Unlock()
+
+	if vs2, has := schemes[vs.Name()]; has && vs2 != vs {
+		return fmt.Errorf("a version scheme named %q is already registered", vs.Name())
+	}
+	schemes[vs.Name()] = vs
+	return nil
+}
+
+// versionSchemeNamed returns the registered VersionScheme with the given name.
+func versionSchemeNamed(name string) (VersionScheme, bool) {
+	schemesmut.RLock()
+	defer schemesmut.RUnlock()
+
+	vs, has := schemes[name]
+	return vs, has
+}
+
+// NumericScheme returns a VersionScheme for versions made up of a fixed
+// prefix, followed by one or more dot-separated decimal numbers. Versions are
+// ordered by comparing their numbers in turn, with missing trailing numbers
+// taken to be zero.
+func NumericScheme(name, prefix string) VersionScheme {
+	return numericScheme{name: name, prefix: prefix}
+}
+
+type numericScheme struct {
+	name, prefix string
+}
+
+func (s numericScheme) Name() string {
+	return s.name
+}
+
+func (s numericScheme) Valid(v string) bool {
+	_, ok := s.parts(v)
+	return ok
+}
+
+func (s numericScheme) Compare(a, b string) int {
+	ap, _ := s.parts(a)
+	bp, _ := s.parts(b)
+
+	for i := 0; i < len(ap) || i < len(bp); i++ {
+		var an, bn uint64
+		if i < len(ap) {
+			an = ap[i]
+		}
+		if i < len(bp) {
+			bn = bp[i]
+		}
+
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+	}
+	return 0
+}
+
+// parts splits a version into its numbers, indicating whether it was valid.
+func (s numericScheme) parts(v string) ([]uint64, bool) {
+	if !strings.HasPrefix(v, s.prefix) || len(v) == len(s.prefix) {
+		return nil, false
+	}
+
+	strs := strings.Split(v[len(s.prefix):], ".")
+	parts := make([]uint64, len(strs))
+	for k, str := range strs {
+		n, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		parts[k] = n
+	}
+	return parts, true
+}
+
+// schemeString returns the string against which a version is checked for
+// validity in a VersionScheme. Only tag-like versions can be in a scheme; for
+// branches and revisions, it returns false.
+func schemeString(v Version) (string, bool) {
+	if pv, ok := v.(versionPair); ok {
+		v = pv.v
+	}
+
+	switch tv := v.(type) {
+	case plainVersion, semVersion:
+		return tv.String(), true
+	}
+	return "", false
+}
+
+// NewSchemeConstraint parses a range constraint on versions in the given
+// VersionScheme.
+//
+// The body is a comma-separated list of comparisons, each of which is one of
+// the operators =, >, >=, < or <= followed by a version in the scheme. A bare
+// version is the same as =, and "*" allows any version in the scheme. Thus,
+// for CalVer, ">=2026.04, <2027" allows every version released from April 2026
+// through the end of that year.
+func NewSchemeConstraint(vs VersionScheme, body string) (Constraint, error) {
+	c := schemeConstraint{vs: vs}
+	if strings.TrimSpace(body) == "*" {
+		return c, nil
+	}
+
+	for _, cmp := range strings.Split(body, ",") {
+		cmp = strings.TrimSpace(cmp)
+
+		var op string
+		for _, o := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(cmp, o) {
+				op = o
+				break
+			}
+		}
+
+		v := strings.TrimSpace(cmp[len(op):])
+		if !vs.Valid(v) {
+			return nil, fmt.Errorf("%q is not a valid version in the %s scheme", v, vs.Name())
+		}
+
+		var rc Constraint
+		switch op {
+		case ">=", ">":
+			rc = c.Intersect(schemeConstraint{vs: vs, lo: v, loIncl: op == ">="})
+		case "<=", "<":
+			rc = c.Intersect(schemeConstraint{vs: vs, hi: v, hiIncl: op == "<="})
+		default:
+			rc = c.Intersect(schemeConstraint{vs: vs, lo: v, loIncl: true, hi: v, hiIncl: true})
+		}
+
+		if rc == none {
+			return none, nil
+		}
+		c = rc.(schemeConstraint)
+	}
+
+	return c, nil
+}
+
+// schemeConstraint is a range of versions in a VersionScheme. Empty bounds are
+// unbounded.
+type schemeConstraint struct {
+	vs             VersionScheme
+	lo, hi         string
+	loIncl, hiIncl bool
+}
+
+func (c schemeConstraint) String() string {
+	if c.lo != "" && c.lo == c.hi {
+		return c.lo
+	}
+
+	var parts []string
+	if c.lo != "" {
+		if c.loIncl {
+			parts = append(parts, ">="+c.lo)
+		} else {
+			parts = append(parts, ">"+c.lo)
+		}
+	}
+	if c.hi != "" {
+		if c.hiIncl {
+			parts = append(parts, "<="+c.hi)
+		} else {
+			parts = append(parts, "<"+c.hi)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "*"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// admits indicates whether the string is a version in the scheme, and within
+// the constraint's range.
+func (c schemeConstraint) admits(v string) bool {
+	if !c.vs.Valid(v) {
+		return false
+	}
+
+	if c.lo != "" {
+		if cmp := c.vs.Compare(v, c.lo); cmp < 0 || (cmp == 0 && !c.loIncl) {
+			return false
+		}
+	}
+	if c.hi != "" {
+		if cmp := c.vs.Compare(v, c.hi); cmp > 0 || (cmp == 0 && !c.hiIncl) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c schemeConstraint) Matches(v Version) bool {
+	if tv, ok := v.(versionTypeUnion); ok {
+		for _, elem := range tv {
+			if c.Matches(elem) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, ok := schemeString(v)
+	return ok && c.admits(s)
+}
+
+func (c schemeConstraint) MatchesAny(c2 Constraint) bool {
+	return c.Intersect(c2) != none
+}
+
+func (c schemeConstraint) Intersect(c2 Constraint) Constraint {
+	switch tc := c2.(type) {
+	case anyConstraint:
+		return c
+	case noneConstraint:
+		return none
+	case unionConstraint, exclusionConstraint, defaultBranchConstraint:
+		return tc.Intersect(c)
+	case versionTypeUnion:
+		for _, elem := range tc {
+			if rc := c.Intersect(elem); rc != none {
+				return rc
+			}
+		}
+	case schemeConstraint:
+		if tc.vs.Name() != c.vs.Name() {
+			return none
+		}
+
+		// Take the tighter of each pair of bounds
+		rc := c
+		switch {
+		case tc.lo == "":
+		case rc.lo == "" || c.vs.Compare(tc.lo, rc.lo) > 0:
+			rc.lo, rc.loIncl = tc.lo, tc.loIncl
+		case c.vs.Compare(tc.lo, rc.lo) == 0:
+			rc.loIncl = rc.loIncl && tc.loIncl
+		}
+		switch {
+		case tc.hi == "":
+		case rc.hi == "" || c.vs.Compare(tc.hi, rc.hi) < 0:
+			rc.hi, rc.hiIncl = tc.hi, tc.hiIncl
+		case c.vs.Compare(tc.hi, rc.hi) == 0:
+			rc.hiIncl = rc.hiIncl && tc.hiIncl
+		}
+
+		if rc.lo != "" && rc.hi != "" {
+			if cmp := c.vs.Compare(rc.lo, rc.hi); cmp > 0 || (cmp == 0 && !(rc.loIncl && rc.hiIncl)) {
+				return none
+			}
+		}
+		return rc
+	case Version:
+		if c.Matches(tc) {
+			return tc
+		}
+	}
+
+	return none
+}
+
+func (schemeConstraint) _private() {}
+
+// sortInScheme stably moves the versions that are valid in the scheme to the
+// front of the list, ordered newest first for upgrades, or oldest first for
+// downgrades. The relative order of the remaining versions is unchanged.
+func sortInScheme(vl []Version, vs VersionScheme, down bool) {
+	sort.Stable(schemeVersionSorter{vl: vl, vs: vs, down: down})
+}
+
+type schemeVersionSorter struct {
+	vl   []Version
+	vs   VersionScheme
+	down bool
+}
+
+func (s schemeVersionSorter) Len() int {
+	return len(s.vl)
+}
+
+func (s schemeVersionSorter) Swap(i, j int) {
+	s.vl[i], s.vl[j] = s.vl[j], s.vl[i]
+}
+
+func (s schemeVersionSorter) Less(i, j int) bool {
+	l, lok := schemeString(s.vl[i])
+	r, rok := schemeString(s.vl[j])
+	lok = lok && s.vs.Valid(l)
+	rok = rok && s.vs.Valid(r)
+
+	if !lok || !rok {
+		// Versions in the scheme come first; others keep their order
+		return lok && !rok
+	}
+
+	if s.down {
+		return s.vs.Compare(l, r) < 0
+	}
+	return s.vs.Compare(l, r) > 0
+}
@@ -0,0 +1,206 @@
+package gps
+
+import "testing"
+
+func TestNumericScheme(t *testing.T) {
+	valid := map[string][]string{
+		"calver":  {"2026", "2026.04", "2026.04.1", "2026.4.1"},
+		"release": {"release-1", "release-12", "release-2.1"},
+	}
+	invalid := map[string][]string{
+		"calver":  {"", "v2026.04", "2026.04-rc1", "2026..1", "master"},
+		"release": {"release-", "12", "release-x", "release--1"},
+	}
+
+	for _, vs := range []VersionScheme{CalVer, ReleaseNumbers} {
+		for _, v := range valid[vs.Name()] {
+			if !vs.Valid(v) {
+				t.Errorf("%q should be valid in the %s scheme", v, vs.Name())
+			}
+		}
+		for _, v := range invalid[vs.Name()] {
+			if vs.Valid(v) {
+				t.Errorf("%q should not be valid in the %s scheme", v, vs.Name())
+			}
+		}
+	}
+
+	cmps := []struct {
+		vs   VersionScheme
+		a, b string
+		r    int
+	}{
+		{CalVer, "2026.04.1", "2026.4.1", 0},
+		{CalVer, "2026.04", "2026.04.0", 0},
+		{CalVer, "2026.04.1", "2026.10", -1},
+		{CalVer, "2027", "2026.12.31", 1},
+		{ReleaseNumbers, "release-9", "release-11", -1},
+		{ReleaseNumbers, "release-12", "release-2", 1},
+	}
+	for _, fix := range cmps {
+		if r := fix.vs.Compare(fix.a, fix.b); r != fix.r {
+			t.Errorf("Compare(%q, %q) in %s should be %v, got %v", fix.a, fix.b, fix.vs.Name(), fix.r, r)
+		}
+	}
+}
+
+func TestRegisterVersionScheme(t *testing.T) {
+	if err := RegisterVersionScheme(CalVer); err != nil {
+		t.Errorf("Re-registering the same scheme should not error, got %s", err)
+	}
+	if err := RegisterVersionScheme(NumericScheme("calver", "cal-")); err == nil {
+		t.Errorf("Registering a different scheme under a taken name should error")
+	}
+	if err := RegisterVersionScheme(NumericScheme("cal-ver", "")); err == nil {
+		t.Errorf("Registering a scheme with a name containing \"-\" should error")
+	}
+
+	vs := NumericScheme("testbuild", "build")
+	if err := RegisterVersionScheme(vs); err != nil {
+		t.Fatalf("Unexpected error registering scheme: %s", err)
+	}
+	if got, has := versionSchemeNamed("testbuild"); !has || got != vs {
+		t.Errorf("Registered scheme should be found by name")
+	}
+}
+
+func TestSchemeConstraintOps(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	c1, err := NewSchemeConstraint(CalVer, ">=2026.04, <2027")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing scheme constraint: %s", err)
+	}
+
+	if s := c1.String(); s != ">=2026.04, <2027" {
+		t.Errorf("Unexpected string for scheme constraint: %q", s)
+	}
+
+	// Parsing
+	parses := map[string]string{
+		"*":                               "*",
+		"2026.04.1":                       "2026.04.1",
+		"=2026.04.1":                      "2026.04.1",
+		"> 2026.04, <= 2026.09":           ">2026.04, <=2026.09",
+		">=2026, >=2026.04, <2028, <2027": ">=2026.04, <2027",
+	}
+	for in, out := range parses {
+		c, err := NewSchemeConstraint(CalVer, in)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", in, err)
+			continue
+		}
+		if c.String() != out {
+			t.Errorf("Expected %q to parse to %q, got %q", in, out, c.String())
+		}
+	}
+	if c, err := NewSchemeConstraint(CalVer, ">2027, <2026"); err != nil || c != none {
+		t.Errorf("Disjoint comparisons should parse to none, got %v (err %v)", c, err)
+	}
+	for _, in := range []string{"", ">=", "~2026.04", ">=release-2", "2026.04 || 2027"} {
+		if _, err := NewSchemeConstraint(CalVer, in); err == nil {
+			t.Errorf("Expected error parsing %q", in)
+		}
+	}
+
+	// Matches
+	matches := map[Version]bool{
+		NewVersion("2026.04.1"):          true,
+		NewVersion("2026.4"):             true,
+		NewVersion("2026.12.31").Is(rev): true,
+		NewVersion("2026.03"):            false,
+		NewVersion("2027"):               false,
+		NewVersion("release-12"):         false,
+		NewBranch("2026.05"):             false,
+		rev:                              false,
+	}
+	for v, want := range matches {
+		if got := c1.Matches(v); got != want {
+			t.Errorf("Matches(%s) should be %v, got %v", v, want, got)
+		}
+	}
+
+	// Intersect
+	c2, _ := NewSchemeConstraint(CalVer, ">2026.06")
+	if rc := c1.Intersect(c2); rc.String() != ">2026.06, <2027" {
+		t.Errorf("Unexpected intersection of scheme constraints: %s", rc)
+	}
+	c3, _ := NewSchemeConstraint(CalVer, "<=2026.04")
+	if rc := c1.Intersect(c3); rc.String() != "2026.04" {
+		t.Errorf("Intersection touching at an inclusive bound should be that version, got %s", rc)
+	}
+	c4, _ := NewSchemeConstraint(CalVer, "<2026.04")
+	if rc := c1.Intersect(c4); rc != none {
+		t.Errorf("Intersection touching at an exclusive bound should be none, got %s", rc)
+	}
+	c5, _ := NewSchemeConstraint(ReleaseNumbers, "*")
+	if c1.MatchesAny(c5) {
+		t.Errorf("Constraints in different schemes should not match any")
+	}
+	if rc := c1.Intersect(NewVersion("2026.05")); rc != NewVersion("2026.05") {
+		t.Errorf("Intersection with a matching version should be the version, got %s", rc)
+	}
+	if rc := NewVersion("2026.05").Intersect(c1); rc != NewVersion("2026.05") {
+		t.Errorf("Reverse intersection with a matching version should be the version, got %s", rc)
+	}
+	if !c1.MatchesAny(any) || c1.MatchesAny(none) || c1.MatchesAny(NewBranch("master")) {
+		t.Errorf("Unexpected MatchesAny results against any, none or a branch")
+	}
+
+	// Unions and exclusions compose with scheme constraints
+	uc := NewUnionConstraint(c1, NewBranch("master"))
+	if !uc.Matches(NewVersion("2026.05")) || !uc.Matches(NewBranch("master")) {
+		t.Errorf("Union with a scheme constraint should match either member")
+	}
+	ec := NewExclusionConstraint(c1, NewVersion("2026.05"))
+	if ec.Matches(NewVersion("2026.05")) || !ec.Matches(NewVersion("2026.06")) {
+		t.Errorf("Exclusion from a scheme constraint should match all but the excluded version")
+	}
+}
+
+func TestSchemeConstraintTypedString(t *testing.T) {
+	c, _ := NewSchemeConstraint(ReleaseNumbers, ">=release-10, <release-12")
+	ts := typedConstraintString(c)
+	if ts != "vs-release->=release-10, <release-12" {
+		t.Errorf("Unexpected typed string: %q", ts)
+	}
+
+	c2, err := ParseConstraint(ts, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing typed string: %s", err)
+	}
+	if c2 != c {
+		t.Errorf("Typed string should round-trip, got %s", c2)
+	}
+
+	if _, err := ParseConstraint("vs-nonesuch-*", nil); err == nil {
+		t.Errorf("Expected error parsing constraint for an unknown scheme")
+	}
+}
+
+func TestSortInScheme(t *testing.T) {
+	vl := []Version{
+		NewBranch("master"),
+		NewVersion("release-2"),
+		NewVersion("1.0.0"),
+		NewVersion("release-11"),
+		NewVersion("release-9"),
+	}
+
+	sortInScheme(vl, ReleaseNumbers, false)
+	want := []string{"release-11", "release-9", "release-2", "master", "1.0.0"}
+	for k, v := range vl {
+		if v.String() != want[k] {
+			t.Errorf("Expected upgrade order %v, got %v", want, vl)
+			break
+		}
+	}
+
+	sortInScheme(vl, ReleaseNumbers, true)
+	want = []string{"release-2", "release-9", "release-11", "master", "1.0.0"}
+	for k, v := range vl {
+		if v.String() != want[k] {
+			t.Errorf("Expected downgrade order %v, got %v", want, vl)
+			break
+		}
+	}
+}